@@ -0,0 +1,219 @@
+// Package catalog describes the branches and signing tokens IPC-Toyz offers,
+// so other branches can use the tool without rebuilding it.
+package catalog
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the catalog file name, locally and on the update share
+const FileName = "catalog.json"
+
+// SignatureName holds the hex encoded ed25519 signature of FileName on the
+// share, made with the key that signs the update manifest
+const SignatureName = "catalog.sig"
+
+// ErrBadSignature is returned when the catalog on the share is unsigned or
+// its signature does not verify
+var ErrBadSignature = errors.New("catalog signature is missing or invalid")
+
+// Branch is a branch code with its network settings
+type Branch struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	DNS     string `json:"dns"`
+	Domain  string `json:"domain"`
+	Printer string `json:"printer"`
+	// UpdateSource is the Bin folder on the share IPCAS2 is updated from
+	UpdateSource string `json:"update_source"`
+	// Picture is the share mapped as U: for scanned pictures
+	Picture string `json:"picture"`
+}
+
+// Token is a signing token driver selectable in [TOKENSETUP]
+type Token struct {
+	ID    string `json:"id"`
+	DLL   string `json:"dll"`
+	Label string `json:"label"`
+}
+
+// String returns the label shown in the token select
+func (t Token) String() string {
+	return t.ID + " - " + t.Label
+}
+
+// Catalog is the content of catalog.json
+type Catalog struct {
+	// DefaultBranch is preselected when nothing is configured yet
+	DefaultBranch string   `json:"default_branch"`
+	DefaultToken  string   `json:"default_token"`
+	Branches      []Branch `json:"branches"`
+	Tokens        []Token  `json:"tokens"`
+}
+
+// Default returns the catalog of Agribank Tây Nghệ An, used when no
+// catalog file exists
+func Default() *Catalog {
+	c := &Catalog{DefaultBranch: "3611", DefaultToken: "TOKEN7"}
+	for _, code := range []string{"3611", "3612", "3613", "3614", "3616", "3617", "3618", "3619", "3620"} {
+		c.Branches = append(c.Branches, Branch{
+			Code:         code,
+			DNS:          "10.0.58.11",
+			Domain:       "corp.agribank.com.vn",
+			Printer:      "INSOTK",
+			UpdateSource: `\\10.32.128.12\IPCAS2\Bin`,
+			Picture:      `\\10.32.128.12\Picture`,
+		})
+	}
+	c.Tokens = []Token{
+		{"TOKEN1", "./SecureMetric_PKI_csp11.dll", "SecureMetric PKI"},
+		{"TOKEN2", "./eToken.dll", "USB Đỏ (eToken)"},
+		{"TOKEN3", "./acospkcs11.dll", "ACOS"},
+		{"TOKEN4", "./st3csp11.dll", "ST3"},
+		{"TOKEN5", "./dkck201.dll", "DKCK"},
+		{"TOKEN6", "./gclib.dll", "Thẻ PKI Smart Card"},
+		{"TOKEN7", "./agribank_csp11_v1.dll", "USB Đen (Agribank)"},
+	}
+	return c
+}
+
+// Load reads the catalog at path, returning Default if it does not exist
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes and validates a catalog
+func Parse(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks that branches and tokens are listed once and the
+// defaults refer to them
+func (c *Catalog) Validate() error {
+	if len(c.Branches) == 0 || len(c.Tokens) == 0 {
+		return errors.New("catalog needs branches and tokens")
+	}
+	codes := make(map[string]bool)
+	for _, b := range c.Branches {
+		if b.Code == "" || codes[b.Code] {
+			return fmt.Errorf("branch code %q is empty or repeated", b.Code)
+		}
+		codes[b.Code] = true
+	}
+	ids := make(map[string]bool)
+	for _, t := range c.Tokens {
+		if t.ID == "" || ids[strings.ToUpper(t.ID)] {
+			return fmt.Errorf("token %q is empty or repeated", t.ID)
+		}
+		ids[strings.ToUpper(t.ID)] = true
+	}
+	if _, ok := c.Branch(c.DefaultBranch); !ok {
+		return fmt.Errorf("default branch %q is not listed", c.DefaultBranch)
+	}
+	if _, ok := c.Token(c.DefaultToken); !ok {
+		return fmt.Errorf("default token %q is not listed", c.DefaultToken)
+	}
+	return nil
+}
+
+// Codes returns the branch codes in catalog order
+func (c *Catalog) Codes() []string {
+	var codes []string
+	for _, b := range c.Branches {
+		codes = append(codes, b.Code)
+	}
+	return codes
+}
+
+// Branch returns the branch with code
+func (c *Catalog) Branch(code string) (Branch, bool) {
+	for _, b := range c.Branches {
+		if b.Code == code {
+			return b, true
+		}
+	}
+	return Branch{}, false
+}
+
+// Token returns the token with id, ignoring case
+func (c *Catalog) Token(id string) (Token, bool) {
+	for _, t := range c.Tokens {
+		if strings.EqualFold(t.ID, id) {
+			return t, true
+		}
+	}
+	return Token{}, false
+}
+
+// Fetch copies catalog.json from the update share dir to localPath when it
+// exists there and is valid. The catalog decides where updates come from,
+// so when key is not nil it must carry a valid signature. It reports
+// whether the local copy changed.
+func Fetch(dir, localPath string, key ed25519.PublicKey) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if key != nil {
+		sig, err := os.ReadFile(filepath.Join(dir, SignatureName))
+		if err != nil {
+			return false, ErrBadSignature
+		}
+		raw, err := hex.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || !ed25519.Verify(key, data, raw) {
+			return false, ErrBadSignature
+		}
+	}
+	if _, err := Parse(data); err != nil {
+		return false, fmt.Errorf("%s on share: %w", FileName, err)
+	}
+	if old, err := os.ReadFile(localPath); err == nil && string(old) == string(data) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(localPath, data, 0644)
+}
+
+// Sign validates the catalog.json in dir and writes its signature next to it
+func Sign(dir string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return err
+	}
+	if _, err := Parse(data); err != nil {
+		return fmt.Errorf("%s: %w", FileName, err)
+	}
+	sig := hex.EncodeToString(ed25519.Sign(key, data))
+	return os.WriteFile(filepath.Join(dir, SignatureName), []byte(sig), 0644)
+}
@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCatalog(t *testing.T, dir string, c *Catalog) {
+	t.Helper()
+	data, _ := json.Marshal(c)
+	if err := os.WriteFile(filepath.Join(dir, FileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchVerifiesSignature(t *testing.T) {
+	share := t.TempDir()
+	local := filepath.Join(t.TempDir(), FileName)
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	writeCatalog(t, share, Default())
+
+	if changed, err := Fetch(share, local, pub); !errors.Is(err, ErrBadSignature) || changed {
+		t.Fatalf("unsigned catalog: changed = %v, err = %v", changed, err)
+	}
+
+	if err := Sign(share, priv); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := Fetch(share, local, pub); err != nil || !changed {
+		t.Fatalf("signed catalog: changed = %v, err = %v", changed, err)
+	}
+	if changed, _ := Fetch(share, local, pub); changed {
+		t.Error("unchanged catalog reported as changed")
+	}
+
+	// Redirecting the update source breaks the signature
+	c := Default()
+	c.Branches[0].UpdateSource = `\\evil\Bin`
+	writeCatalog(t, share, c)
+	if _, err := Fetch(share, local, pub); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered catalog: err = %v", err)
+	}
+	if got, _ := Load(local); got.Branches[0].UpdateSource == `\\evil\Bin` {
+		t.Error("tampered catalog was copied")
+	}
+}
+
+func TestFetchWithoutKey(t *testing.T) {
+	share := t.TempDir()
+	local := filepath.Join(t.TempDir(), FileName)
+	if changed, err := Fetch(share, local, nil); err != nil || changed {
+		t.Errorf("missing catalog: changed = %v, err = %v", changed, err)
+	}
+	writeCatalog(t, share, Default())
+	if changed, err := Fetch(share, local, nil); err != nil || !changed {
+		t.Errorf("changed = %v, err = %v", changed, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.DefaultToken = "TOKEN9"
+	if err := c.Validate(); err == nil {
+		t.Error("unknown default token accepted")
+	}
+	c = Default()
+	c.Branches = append(c.Branches, c.Branches[0])
+	if err := c.Validate(); err == nil {
+		t.Error("repeated branch accepted")
+	}
+}
@@ -0,0 +1,176 @@
+// Package cleaner finds junk files under the Picture folder with a rule
+// set. The cleanup removes only files the preview listed, rechecked
+// against a fresh plan so files changed since the preview are kept.
+package cleaner
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ipcas2-scanner/walk"
+)
+
+// Item is a junk file found under the Picture folder
+type Item struct {
+	Path    string    `json:"path"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Reason  string    `json:"reason"` // label of the rule
+	Why     string    `json:"why"`    // what made the file qualify
+	Error   string    `json:"error,omitempty"`
+}
+
+// Plan lists the junk files under Root
+type Plan struct {
+	Root       string    `json:"root"`
+	Time       time.Time `json:"time"`
+	Scanned    int       `json:"scanned"`
+	Unreadable int       `json:"unreadable,omitempty"` // folders and files skipped, their junk is missed
+	Items      []Item    `json:"items"`
+}
+
+// Bytes returns the total size of the planned files
+func (p *Plan) Bytes() int64 {
+	var n int64
+	for _, it := range p.Items {
+		n += it.Size
+	}
+	return n
+}
+
+// Result summarizes a preview or cleanup run
+type Result struct {
+	Root       string `json:"root"`
+	Scanned    int    `json:"scanned"`
+	Unreadable int    `json:"unreadable,omitempty"`
+	Junk       []Item `json:"junk"`
+	Deleted    []Item `json:"deleted"`
+	Failed     []Item `json:"failed,omitempty"`
+}
+
+// NewPlan walks fsys and evaluates rs on every file as of now. root is the
+// OS path fsys was opened on and prefixes the item paths. Unreadable
+// folders are skipped and counted in Unreadable. Items are sorted by path.
+// When ctx is cancelled the plan is incomplete and ctx.Err() is returned.
+func NewPlan(ctx context.Context, fsys fs.FS, root string, rs *RuleSet, now time.Time) (*Plan, error) {
+	p := &Plan{Root: root, Time: now}
+	var (
+		mu         sync.Mutex
+		candidates []candidate
+	)
+	st, err := walk.Walk(ctx, fsys, 0, func(f walk.File) {
+		for i, r := range rs.Rules {
+			ok, why := r.match(f.Rel, f.Info.Size())
+			if !ok {
+				continue
+			}
+			c := candidate{rel: f.Rel, rule: i, matched: why, file: Item{
+				Path:    filepath.Join(root, filepath.FromSlash(f.Rel)),
+				Name:    f.Info.Name(),
+				Size:    f.Info.Size(),
+				ModTime: f.Info.ModTime(),
+				Reason:  r.Reason,
+			}}
+			mu.Lock()
+			candidates = append(candidates, c)
+			mu.Unlock()
+			break
+		}
+	})
+	p.Scanned = int(st.Files)
+	p.Unreadable = int(st.Errors)
+
+	// The walk finds files in no particular order
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].rel < candidates[j].rel })
+	rankNewest(candidates)
+	cal := newCalendar(rs.Holidays)
+	for _, c := range candidates {
+		keep, why := rs.Rules[c.rule].retain(c, now, cal)
+		if keep {
+			continue
+		}
+		c.file.Why = strings.Join(append(c.matched, why...), ", ")
+		p.Items = append(p.Items, c.file)
+	}
+	return p, err
+}
+
+// rankNewest numbers the candidates of each rule and folder from the
+// newest
+func rankNewest(candidates []candidate) {
+	groups := make(map[string][]*candidate)
+	for i := range candidates {
+		c := &candidates[i]
+		groups[c.folder()] = append(groups[c.folder()], c)
+	}
+	for _, g := range groups {
+		sort.SliceStable(g, func(i, j int) bool { return g[i].file.ModTime.After(g[j].file.ModTime) })
+		for i, c := range g {
+			c.rank = i + 1
+		}
+	}
+}
+
+// PlanDir plans the cleanup of the folder root
+func PlanDir(ctx context.Context, root string, rs *RuleSet) (*Plan, error) {
+	if _, err := os.Stat(root); err != nil {
+		return &Plan{Root: root, Time: time.Now()}, err
+	}
+	return NewPlan(ctx, os.DirFS(root), root, rs, time.Now())
+}
+
+// Recheck returns the items of p that current, a newer plan of the same
+// root, still lists with the same size and modification time. Cleaning up
+// with it never removes a file the preview did not show, nor one that was
+// changed or became kept by retention since.
+func (p *Plan) Recheck(current *Plan) *Plan {
+	now := make(map[string]Item, len(current.Items))
+	for _, it := range current.Items {
+		now[strings.ToLower(it.Path)] = it
+	}
+	out := &Plan{Root: p.Root, Time: current.Time, Scanned: current.Scanned, Unreadable: current.Unreadable}
+	for _, it := range p.Items {
+		c, ok := now[strings.ToLower(it.Path)]
+		if ok && c.Size == it.Size && c.ModTime.Equal(it.ModTime) {
+			out.Items = append(out.Items, c)
+		}
+	}
+	return out
+}
+
+// RemoveFunc disposes of a junk file, e.g. by moving it to quarantine
+type RemoveFunc func(item Item) error
+
+// Execute passes every planned file to remove. A nil remove makes the
+// result a preview.
+func (p *Plan) Execute(remove RemoveFunc) *Result {
+	res := &Result{Root: p.Root, Scanned: p.Scanned, Unreadable: p.Unreadable, Junk: p.Items}
+	if remove == nil {
+		return res
+	}
+	for _, it := range p.Items {
+		if err := remove(it); err != nil {
+			it.Error = err.Error()
+			res.Failed = append(res.Failed, it)
+			continue
+		}
+		res.Deleted = append(res.Deleted, it)
+	}
+	return res
+}
+
+// Run plans the cleanup of root with rs and executes it with remove
+func Run(ctx context.Context, root string, rs *RuleSet, remove RemoveFunc) (*Result, error) {
+	p, err := PlanDir(ctx, root, rs)
+	if err != nil {
+		return p.Execute(nil), err
+	}
+	return p.Execute(remove), nil
+}
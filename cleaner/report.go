@@ -0,0 +1,131 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"ipcas2-scanner/scanner"
+)
+
+// Report is the record of an unattended cleanup
+type Report struct {
+	Time       time.Time     `json:"time"`
+	Root       string        `json:"root"`
+	Trigger    string        `json:"trigger"` // schedule, cli, ...
+	Skipped    string        `json:"skipped,omitempty"`
+	Scanned    int           `json:"scanned"`
+	Unreadable int           `json:"unreadable,omitempty"` // folders and files skipped
+	Deleted    int           `json:"deleted"`
+	BytesFreed int64         `json:"bytes_freed"`
+	Errors     []string      `json:"errors,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Result     *Result       `json:"result,omitempty"`
+}
+
+// Unattended cleans root with rs like Run, but records the outcome instead
+// of failing: an unreachable root skips the run.
+func Unattended(ctx context.Context, root string, rs *RuleSet, remove RemoveFunc, trigger string) *Report {
+	r := &Report{Time: time.Now(), Root: root, Trigger: trigger}
+	defer func() { r.Duration = time.Since(r.Time) }()
+
+	if _, err := os.Stat(root); err != nil {
+		r.Skipped = err.Error()
+		return r
+	}
+	res, err := Run(ctx, root, rs, remove)
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	r.Result = res
+	r.Scanned = res.Scanned
+	r.Unreadable = res.Unreadable
+	r.Deleted = len(res.Deleted)
+	for _, it := range res.Deleted {
+		r.BytesFreed += it.Size
+	}
+	for _, it := range res.Failed {
+		r.Errors = append(r.Errors, it.Path+": "+it.Error)
+	}
+	return r
+}
+
+// reportPrefix starts the file names of saved reports
+const reportPrefix = "clean_"
+
+// SaveReport writes r to dir as clean_<time>.json and returns the path.
+// The name carries milliseconds and moves to the next one when taken, so a
+// scheduled run and a manual one never overwrite each other's report.
+func SaveReport(dir string, r *Report) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	for at := r.Time; ; at = at.Add(time.Millisecond) {
+		path := filepath.Join(dir, reportName(at))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// reportName names the report of a run at t; names sort by time
+func reportName(t time.Time) string {
+	return fmt.Sprintf("%s%s_%03d.json", reportPrefix, t.Format("20060102_150405"), t.Nanosecond()/int(time.Millisecond))
+}
+
+// LastReport returns the newest report saved in dir, nil when there is none
+func LastReport(dir string) (*Report, error) {
+	names, err := filepath.Glob(filepath.Join(dir, reportPrefix+"*.json"))
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	sort.Strings(names)
+	data, err := os.ReadFile(names[len(names)-1])
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Summary describes the report in one line for the status labels
+func (r *Report) Summary() string {
+	at := r.Time.Format("02/01 15:04")
+	if r.Skipped != "" {
+		return at + ": bỏ qua, không truy cập được " + r.Root
+	}
+	s := fmt.Sprintf("%s: đã quét %d file, chuyển %d file vào cách ly (%s)", at, r.Scanned, r.Deleted, scanner.FormatSize(r.BytesFreed))
+	if r.Unreadable > 0 {
+		s += fmt.Sprintf(", %d thư mục/file không đọc được", r.Unreadable)
+	}
+	if len(r.Errors) > 0 {
+		s += fmt.Sprintf(", %d lỗi", len(r.Errors))
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// brokenFS fails to list the folder bad
+type brokenFS struct {
+	fstest.MapFS
+	bad string
+}
+
+func (f brokenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.bad {
+		return nil, errors.New("access denied")
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestNewPlanCountsUnreadable(t *testing.T) {
+	fsys := brokenFS{MapFS: fstest.MapFS{
+		"a.env":        {},
+		"locked/b.env": {},
+	}, bad: "locked"}
+	p, err := NewPlan(context.Background(), fsys, "root", DefaultRules(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Unreadable != 1 || len(p.Items) != 1 {
+		t.Fatalf("unreadable %d, items %+v", p.Unreadable, p.Items)
+	}
+	res := p.Execute(nil)
+	if res.Unreadable != 1 {
+		t.Errorf("result unreadable = %d", res.Unreadable)
+	}
+	r := &Report{Time: time.Now(), Root: "root", Scanned: res.Scanned, Unreadable: res.Unreadable}
+	if !strings.Contains(r.Summary(), "1 thư mục/file không đọc được") {
+		t.Errorf("summary %q does not mention the skipped folder", r.Summary())
+	}
+}
+
+func TestSaveReportKeepsEveryRun(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2024, 10, 14, 17, 30, 0, 0, time.Local)
+	first, err := SaveReport(dir, &Report{Time: at, Root: `U:\`, Trigger: "schedule"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SaveReport(dir, &Report{Time: at, Root: `U:\`, Trigger: "cli"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("both reports saved as %s", first)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, reportPrefix+"*.json")); len(names) != 2 {
+		t.Errorf("saved %v", names)
+	}
+
+	last, err := LastReport(dir)
+	if err != nil || last == nil || last.Trigger != "cli" {
+		t.Errorf("last report = %+v, %v", last, err)
+	}
+}
+
+func TestNewPlanCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p, err := NewPlan(ctx, fstest.MapFS{"a.env": {}, "b/c.env": {}}, "root", DefaultRules(), time.Now())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(p.Items) != 0 {
+		t.Errorf("cancelled plan lists %+v", p.Items)
+	}
+}
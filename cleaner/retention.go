@@ -0,0 +1,117 @@
+package cleaner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Retention keeps files a rule selects. A file is junk only when none of
+// the set policies keeps it.
+type Retention struct {
+	// KeepDays keeps files modified since the start of the day that many
+	// calendar days ago; 1 keeps today's files
+	KeepDays int `json:"keep_days,omitempty"`
+	// KeepBusinessDays is KeepDays counted in business days, skipping
+	// weekends and the holidays of the rule set
+	KeepBusinessDays int `json:"keep_business_days,omitempty"`
+	// KeepNewest keeps the newest files of each folder
+	KeepNewest int `json:"keep_newest,omitempty"`
+	// KeepMinutes keeps files modified in the last minutes, e.g. a picture
+	// being scanned
+	KeepMinutes int `json:"keep_minutes,omitempty"`
+}
+
+// dateLayout is the format of holidays and of the dates in explanations
+const dateLayout = "2006-01-02"
+
+// calendar tells business days apart
+type calendar struct {
+	holidays map[string]bool
+}
+
+func newCalendar(holidays []string) calendar {
+	c := calendar{holidays: make(map[string]bool)}
+	for _, h := range holidays {
+		c.holidays[h] = true
+	}
+	return c
+}
+
+// businessDay reports whether t falls on a working day
+func (c calendar) businessDay(t time.Time) bool {
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return !c.holidays[t.Format(dateLayout)]
+}
+
+// startOfDay returns midnight of the day days before t
+func startOfDay(t time.Time, days int) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d-days, 0, 0, 0, 0, t.Location())
+}
+
+// businessCutoff returns midnight of the n-th most recent business day,
+// counting today when it is one
+func (c calendar) businessCutoff(now time.Time, n int) time.Time {
+	day := startOfDay(now, 0)
+	for {
+		if c.businessDay(day) {
+			n--
+			if n <= 0 {
+				return day
+			}
+		}
+		day = startOfDay(day, 1)
+	}
+}
+
+// candidate is a file selected by a rule, before retention
+type candidate struct {
+	rel     string // slash separated, below the root
+	file    Item
+	rule    int
+	matched []string // what the rule matched
+	rank    int      // 1 for the newest file of its folder under the same rule
+}
+
+// folder is the key KeepNewest groups candidates by
+func (c candidate) folder() string {
+	return fmt.Sprint(c.rule, "|", strings.ToLower(path.Dir(c.rel)))
+}
+
+// retain returns whether the retention keeps c and, when it does not, why
+// the file qualifies for removal
+func (p Retention) retain(c candidate, now time.Time, cal calendar) (bool, []string) {
+	mod := c.file.ModTime
+	var why []string
+	if p.KeepMinutes > 0 {
+		if now.Sub(mod) < time.Duration(p.KeepMinutes)*time.Minute {
+			return true, nil
+		}
+		why = append(why, fmt.Sprintf("sửa hơn %d phút trước", p.KeepMinutes))
+	}
+	if p.KeepDays > 0 {
+		cutoff := startOfDay(now, p.KeepDays-1)
+		if !mod.Before(cutoff) {
+			return true, nil
+		}
+		why = append(why, fmt.Sprintf("sửa %s, trước %s (giữ %d ngày)", mod.Format(dateLayout), cutoff.Format(dateLayout), p.KeepDays))
+	}
+	if p.KeepBusinessDays > 0 {
+		cutoff := cal.businessCutoff(now, p.KeepBusinessDays)
+		if !mod.Before(cutoff) {
+			return true, nil
+		}
+		why = append(why, fmt.Sprintf("sửa %s, trước %s (giữ %d ngày làm việc)", mod.Format(dateLayout), cutoff.Format(dateLayout), p.KeepBusinessDays))
+	}
+	if p.KeepNewest > 0 {
+		if c.rank <= p.KeepNewest {
+			return true, nil
+		}
+		why = append(why, fmt.Sprintf("mới thứ %d trong thư mục (giữ %d file mới nhất)", c.rank, p.KeepNewest))
+	}
+	return false, why
+}
@@ -0,0 +1,158 @@
+package cleaner
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// day returns 9:00 local time of the YYYY-MM-DD date s
+func day(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.ParseInLocation(dateLayout, s, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.Add(9 * time.Hour)
+}
+
+func TestBusinessCutoff(t *testing.T) {
+	for _, tc := range []struct {
+		now      string // 2024-10-14 is a Monday
+		n        int
+		holidays []string
+		want     string
+	}{
+		{"2024-10-16", 1, nil, "2024-10-16"},
+		{"2024-10-16", 2, nil, "2024-10-15"},
+		{"2024-10-14", 2, nil, "2024-10-11"},                    // Monday keeps Friday
+		{"2024-10-14", 2, []string{"2024-10-11"}, "2024-10-10"}, // Friday off
+		{"2024-10-14", 3, nil, "2024-10-10"},
+		{"2024-10-12", 1, nil, "2024-10-11"}, // Saturday
+		{"2024-10-13", 2, nil, "2024-10-10"}, // Sunday
+		{"2024-09-03", 2, []string{"2024-09-02", "2024-09-03"}, "2024-08-29"},
+	} {
+		got := newCalendar(tc.holidays).businessCutoff(day(t, tc.now), tc.n)
+		if want := day(t, tc.want).Add(-9 * time.Hour); !got.Equal(want) {
+			t.Errorf("businessCutoff(%s, %d, %v) = %s, want %s", tc.now, tc.n, tc.holidays, got, want)
+		}
+	}
+}
+
+func TestRetain(t *testing.T) {
+	now := day(t, "2024-10-14")
+	cal := newCalendar(nil)
+	for _, tc := range []struct {
+		name string
+		p    Retention
+		mod  time.Time
+		rank int
+		keep bool
+	}{
+		{"nothing set", Retention{}, now.AddDate(-1, 0, 0), 5, false},
+		{"minutes recent", Retention{KeepMinutes: 30}, now.Add(-10 * time.Minute), 1, true},
+		{"minutes old", Retention{KeepMinutes: 30}, now.Add(-31 * time.Minute), 1, false},
+		{"days today", Retention{KeepDays: 1}, now.Add(-8 * time.Hour), 1, true},
+		{"days yesterday", Retention{KeepDays: 1}, now.Add(-10 * time.Hour), 1, false},
+		{"days yesterday kept", Retention{KeepDays: 2}, now.Add(-10 * time.Hour), 1, true},
+		{"business friday", Retention{KeepBusinessDays: 2}, day(t, "2024-10-11"), 1, true},
+		{"business thursday", Retention{KeepBusinessDays: 2}, day(t, "2024-10-10"), 1, false},
+		{"newest kept", Retention{KeepNewest: 2}, now.AddDate(0, -1, 0), 2, true},
+		{"newest dropped", Retention{KeepNewest: 2}, now.AddDate(0, -1, 0), 3, false},
+		{"any policy keeps", Retention{KeepBusinessDays: 2, KeepNewest: 1}, day(t, "2024-10-01"), 1, true},
+		{"every policy drops", Retention{KeepBusinessDays: 2, KeepMinutes: 30}, day(t, "2024-10-10"), 1, false},
+	} {
+		c := candidate{rel: "a.jpg", file: Item{ModTime: tc.mod}, rank: tc.rank}
+		keep, why := tc.p.retain(c, now, cal)
+		if keep != tc.keep {
+			t.Errorf("%s: keep = %v, want %v (%v)", tc.name, keep, tc.keep, why)
+		}
+		if keep && why != nil {
+			t.Errorf("%s: kept file explained: %v", tc.name, why)
+		}
+	}
+}
+
+func TestNewPlanDefaultRules(t *testing.T) {
+	monday := day(t, "2024-10-14")
+	fsys := fstest.MapFS{
+		"Thumbs.db":          {Data: []byte("x"), ModTime: monday},
+		"scan/a.env":         {Data: []byte("x"), ModTime: monday},
+		"scan/friday.jpg":    {Data: []byte("x"), ModTime: day(t, "2024-10-11")},
+		"scan/thursday.JPG":  {Data: []byte("x"), ModTime: day(t, "2024-10-10")},
+		"scan/scanning.jpg":  {Data: []byte("x"), ModTime: monday.Add(-time.Minute)},
+		"scan/keep/note.txt": {Data: []byte("x"), ModTime: day(t, "2020-01-01")},
+	}
+	p, err := NewPlan(context.Background(), fsys, `U:\`, DefaultRules(), monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Scanned != len(fsys) {
+		t.Errorf("scanned %d files, want %d", p.Scanned, len(fsys))
+	}
+	var got []string
+	for _, it := range p.Items {
+		got = append(got, it.Name)
+	}
+	want := []string{"Thumbs.db", "a.env", "thursday.JPG"}
+	if len(got) != len(want) {
+		t.Fatalf("planned %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("planned %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestNewPlanKeepNewestPerFolder(t *testing.T) {
+	now := day(t, "2024-10-14")
+	fsys := fstest.MapFS{
+		"a/1.log": {ModTime: now.Add(-3 * time.Hour)},
+		"a/2.log": {ModTime: now.Add(-2 * time.Hour)},
+		"a/3.log": {ModTime: now.Add(-1 * time.Hour)},
+		"b/1.log": {ModTime: now.Add(-5 * time.Hour)},
+	}
+	rs := &RuleSet{Rules: []Rule{{Reason: "log", Extensions: []string{".log"}, Retention: Retention{KeepNewest: 2}}}}
+	p, err := NewPlan(context.Background(), fsys, "root", rs, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Items) != 1 || p.Items[0].Name != "1.log" || p.Items[0].ModTime != now.Add(-3*time.Hour) {
+		t.Errorf("planned %+v, want a/1.log only", p.Items)
+	}
+}
+
+func TestRecheckKeepsChangedFiles(t *testing.T) {
+	monday := day(t, "2024-10-14")
+	rs := &RuleSet{Rules: []Rule{{Reason: "ảnh cũ", Extensions: []string{".jpg"}, Retention: Retention{KeepMinutes: 30}}}}
+	fsys := fstest.MapFS{
+		"a.jpg": {Data: []byte("x"), ModTime: monday.Add(-time.Hour)},
+		"b.jpg": {Data: []byte("x"), ModTime: monday.Add(-time.Hour)},
+		"c.jpg": {Data: []byte("x"), ModTime: monday.Add(-time.Hour)},
+	}
+	preview, err := NewPlan(context.Background(), fsys, "root", rs, monday)
+	if err != nil || len(preview.Items) != 3 {
+		t.Fatalf("preview %+v, %v", preview, err)
+	}
+
+	// After the preview a.jpg is scanned again, c.jpg grows and d.jpg turns up
+	later := monday.Add(10 * time.Minute)
+	fsys["a.jpg"] = &fstest.MapFile{Data: []byte("x"), ModTime: later.Add(-time.Minute)}
+	fsys["c.jpg"] = &fstest.MapFile{Data: []byte("xx"), ModTime: monday.Add(-time.Hour)}
+	fsys["d.jpg"] = &fstest.MapFile{Data: []byte("x"), ModTime: monday.Add(-time.Hour)}
+	current, err := NewPlan(context.Background(), fsys, "root", rs, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := preview.Recheck(current)
+	if len(p.Items) != 1 || p.Items[0].Name != "b.jpg" {
+		t.Errorf("rechecked %+v, want b.jpg only", p.Items)
+	}
+	if p.Scanned != 4 || !p.Time.Equal(later) {
+		t.Errorf("rechecked plan scanned %d at %s", p.Scanned, p.Time)
+	}
+}
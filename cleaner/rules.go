@@ -0,0 +1,141 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Rule describes a kind of junk file. Every condition that is set must
+// hold, except Extensions and Names: a file listed in either matches.
+// The retention then keeps some of the matching files.
+type Rule struct {
+	// Reason labels the files the rule selects
+	Reason string `json:"reason"`
+	// Extensions such as ".env", compared case-insensitively
+	Extensions []string `json:"extensions,omitempty"`
+	// Names are exact file names, compared case-insensitively
+	Names []string `json:"names,omitempty"`
+	// Path is a glob on the slash separated path below the root, e.g. "scan/*.jpg"
+	Path string `json:"path,omitempty"`
+	// MinSize and MaxSize bound the file size in bytes, 0 for no bound
+	MinSize int64 `json:"min_size,omitempty"`
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	Retention
+}
+
+// RuleSet is the content of the clean rules file. The first rule that
+// matches a file decides, even when its retention keeps the file.
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+	// Holidays are the YYYY-MM-DD dates skipped by keep_business_days
+	Holidays []string `json:"holidays,omitempty"`
+}
+
+// DefaultRules removes system files, .env/.enk leftovers and pictures
+// older than the previous business day
+func DefaultRules() *RuleSet {
+	return &RuleSet{Rules: []Rule{
+		{Reason: "file hệ thống", Names: []string{"thumbs.db", "desktop.ini"}, Extensions: []string{".db"}},
+		{Reason: "file rác", Extensions: []string{".env", ".enk"}},
+		{Reason: "ảnh cũ", Extensions: []string{".jpg", ".jpeg"}, Retention: Retention{KeepBusinessDays: 2, KeepMinutes: 30}},
+	}}
+}
+
+// LoadRules reads a rule set from a JSON file. A missing file yields
+// DefaultRules.
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultRules(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rs RuleSet
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &rs, nil
+}
+
+// Validate checks that every rule can be evaluated and selects something
+// narrower than every file
+func (rs *RuleSet) Validate() error {
+	if len(rs.Rules) == 0 {
+		return errors.New("no rules")
+	}
+	for _, r := range rs.Rules {
+		if r.Reason == "" {
+			return errors.New("every rule needs a reason")
+		}
+		if len(r.Extensions) == 0 && len(r.Names) == 0 && r.Path == "" {
+			return fmt.Errorf("rule %q needs extensions, names or a path", r.Reason)
+		}
+		if _, err := path.Match(strings.ToLower(r.Path), ""); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Reason, err)
+		}
+		if r.KeepDays < 0 || r.KeepBusinessDays < 0 || r.KeepNewest < 0 || r.KeepMinutes < 0 {
+			return fmt.Errorf("rule %q: retention is negative", r.Reason)
+		}
+		if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+			return fmt.Errorf("rule %q: min_size is larger than max_size", r.Reason)
+		}
+	}
+	for _, h := range rs.Holidays {
+		if _, err := time.Parse(dateLayout, h); err != nil {
+			return fmt.Errorf("holiday %q is not YYYY-MM-DD", h)
+		}
+	}
+	return nil
+}
+
+// match reports whether the rule selects the file at rel (slash
+// separated, below the root) and describes what matched
+func (r *Rule) match(rel string, size int64) (bool, []string) {
+	var why []string
+	name := strings.ToLower(path.Base(rel))
+	if len(r.Extensions) > 0 || len(r.Names) > 0 {
+		switch {
+		case containsFold(r.Names, name):
+			why = append(why, "tên "+path.Base(rel))
+		case containsFold(r.Extensions, path.Ext(name)):
+			why = append(why, "đuôi "+path.Ext(name))
+		default:
+			return false, nil
+		}
+	}
+	if r.Path != "" {
+		if ok, _ := path.Match(strings.ToLower(r.Path), strings.ToLower(rel)); !ok {
+			return false, nil
+		}
+		why = append(why, "khớp "+r.Path)
+	}
+	if size < r.MinSize || (r.MaxSize > 0 && size > r.MaxSize) {
+		return false, nil
+	}
+	if r.MinSize > 0 || r.MaxSize > 0 {
+		why = append(why, fmt.Sprintf("cỡ %d byte", size))
+	}
+	return true, why
+}
+
+// containsFold reports whether list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
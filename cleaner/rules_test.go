@@ -0,0 +1,126 @@
+package cleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRuleMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rule Rule
+		rel  string
+		size int64
+		ok   bool
+		why  []string
+	}{
+		{"extension", Rule{Extensions: []string{".ENV"}}, "scan/a.env", 1, true, []string{"đuôi .env"}},
+		{"extension other", Rule{Extensions: []string{".env"}}, "scan/a.jpg", 1, false, nil},
+		{"name", Rule{Names: []string{"thumbs.db"}, Extensions: []string{".db"}}, "Thumbs.db", 1, true, []string{"tên Thumbs.db"}},
+		{"name or extension", Rule{Names: []string{"thumbs.db"}, Extensions: []string{".db"}}, "cache.DB", 1, true, []string{"đuôi .db"}},
+		{"path", Rule{Path: "scan/*.jpg"}, "Scan/A.JPG", 1, true, []string{"khớp scan/*.jpg"}},
+		{"path deeper", Rule{Path: "scan/*.jpg"}, "scan/x/a.jpg", 1, false, nil},
+		{"extension and path", Rule{Extensions: []string{".jpg"}, Path: "tmp/*"}, "scan/a.jpg", 1, false, nil},
+		{"min size", Rule{Extensions: []string{".log"}, MinSize: 10}, "a.log", 9, false, nil},
+		{"size range", Rule{Extensions: []string{".log"}, MinSize: 10, MaxSize: 20}, "a.log", 20, true, []string{"đuôi .log", "cỡ 20 byte"}},
+		{"max size", Rule{Extensions: []string{".log"}, MaxSize: 20}, "a.log", 21, false, nil},
+	} {
+		ok, why := tc.rule.match(tc.rel, tc.size)
+		if ok != tc.ok || !reflect.DeepEqual(why, tc.why) {
+			t.Errorf("%s: match(%q) = %v %q, want %v %q", tc.name, tc.rel, ok, why, tc.ok, tc.why)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultRules().Validate(); err != nil {
+		t.Errorf("default rules: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		rs   RuleSet
+		err  string
+	}{
+		{"empty", RuleSet{}, "no rules"},
+		{"no reason", RuleSet{Rules: []Rule{{Extensions: []string{".env"}}}}, "reason"},
+		{"every file", RuleSet{Rules: []Rule{{Reason: "all"}}}, "needs extensions"},
+		{"bad glob", RuleSet{Rules: []Rule{{Reason: "x", Path: "scan/[a"}}}, "syntax error"},
+		{"negative", RuleSet{Rules: []Rule{{Reason: "x", Path: "*", Retention: Retention{KeepDays: -1}}}}, "negative"},
+		{"sizes", RuleSet{Rules: []Rule{{Reason: "x", Path: "*", MinSize: 5, MaxSize: 4}}}, "min_size"},
+		{"holiday", RuleSet{Rules: []Rule{{Reason: "x", Path: "*"}}, Holidays: []string{"02/09/2024"}}, "YYYY-MM-DD"},
+	} {
+		err := tc.rs.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	rs, err := LoadRules(filepath.Join(dir, "missing.json"))
+	if err != nil || !reflect.DeepEqual(rs, DefaultRules()) {
+		t.Errorf("missing file = %+v, %v", rs, err)
+	}
+
+	path := filepath.Join(dir, "clean_rules.json")
+	os.WriteFile(path, []byte(`{"rules": [{"reason": "log", "extensions": [".log"], "keep_newest": 3}], "holidays": ["2024-09-02"]}`), 0644)
+	rs, err = LoadRules(path)
+	want := &RuleSet{
+		Rules:    []Rule{{Reason: "log", Extensions: []string{".log"}, Retention: Retention{KeepNewest: 3}}},
+		Holidays: []string{"2024-09-02"},
+	}
+	if err != nil || !reflect.DeepEqual(rs, want) {
+		t.Errorf("rules = %+v, %v", rs, err)
+	}
+
+	os.WriteFile(path, []byte(`{"rules": [{"reason": "all"}]}`), 0644)
+	if _, err := LoadRules(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("invalid rules err = %v", err)
+	}
+	os.WriteFile(path, []byte(`{"rules": `), 0644)
+	if _, err := LoadRules(path); err == nil {
+		t.Error("truncated rules accepted")
+	}
+}
+
+func TestExecuteRemovesPreview(t *testing.T) {
+	now := day(t, "2024-10-14")
+	fsys := fstest.MapFS{
+		"a.env":     {ModTime: now},
+		"b/c.enk":   {ModTime: now},
+		"b/d.jpg":   {ModTime: now},
+		"Thumbs.db": {ModTime: now},
+	}
+	p, err := NewPlan(context.Background(), fsys, "root", DefaultRules(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := p.Execute(nil)
+	if len(preview.Deleted) != 0 || len(preview.Junk) != 3 {
+		t.Fatalf("preview %+v", preview)
+	}
+
+	var removed []Item
+	res := p.Execute(func(it Item) error {
+		removed = append(removed, it)
+		if it.Name == "c.enk" {
+			return os.ErrPermission
+		}
+		return nil
+	})
+	if !reflect.DeepEqual(removed, preview.Junk) {
+		t.Errorf("removed %+v, previewed %+v", removed, preview.Junk)
+	}
+	if len(res.Deleted) != 2 || len(res.Failed) != 1 || res.Failed[0].Error == "" {
+		t.Errorf("deleted %+v, failed %+v", res.Deleted, res.Failed)
+	}
+	if res.Scanned != 4 || res.Root != "root" {
+		t.Errorf("result %+v", res)
+	}
+}
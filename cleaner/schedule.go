@@ -0,0 +1,159 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schedule runs the cleanup of Path unattended at the given times
+type Schedule struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+	// Times are HH:MM in local time
+	Times []string `json:"times"`
+	// Weekdays limits the runs to these days, 0 for Sunday; empty is every day
+	Weekdays []int `json:"weekdays,omitempty"`
+}
+
+// DefaultSchedule cleans U:\ after business hours, disabled until the
+// user turns it on
+var DefaultSchedule = Schedule{
+	Path:     `U:\`,
+	Times:    []string{"17:30"},
+	Weekdays: []int{1, 2, 3, 4, 5},
+}
+
+// LoadSchedule reads the schedule file. A missing file yields
+// DefaultSchedule.
+func LoadSchedule(path string) (Schedule, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultSchedule, nil
+	}
+	if err != nil {
+		return DefaultSchedule, err
+	}
+	var s Schedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return DefaultSchedule, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return DefaultSchedule, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// SaveSchedule writes s to path
+func SaveSchedule(path string, s Schedule) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Validate checks the times and weekdays
+func (s Schedule) Validate() error {
+	if s.Enabled && (s.Path == "" || len(s.Times) == 0) {
+		return errors.New("schedule needs a path and times")
+	}
+	for _, t := range s.Times {
+		if _, err := time.Parse("15:04", t); err != nil {
+			return fmt.Errorf("time %q is not HH:MM", t)
+		}
+	}
+	for _, d := range s.Weekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("weekday %d is not 0-6", d)
+		}
+	}
+	return nil
+}
+
+// ParseTimes reads a comma separated list of HH:MM
+func ParseTimes(s string) ([]string, error) {
+	var times []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", f)
+		if err != nil {
+			return nil, fmt.Errorf("time %q is not HH:MM", f)
+		}
+		times = append(times, t.Format("15:04"))
+	}
+	sort.Strings(times)
+	return times, nil
+}
+
+// runDay reports whether the schedule runs on the day of t
+func (s Schedule) runDay(t time.Time) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range s.Weekdays {
+		if time.Weekday(d) == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// runs returns the scheduled times of the day of t
+func (s Schedule) runs(t time.Time) []time.Time {
+	if !s.runDay(t) {
+		return nil
+	}
+	var runs []time.Time
+	y, m, d := t.Date()
+	for _, hm := range s.Times {
+		at, err := time.Parse("15:04", hm)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, t.Location()))
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Before(runs[j]) })
+	return runs
+}
+
+// Due reports whether a run was scheduled after last and up to now
+func (s Schedule) Due(last, now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	for day := startOfDay(last, 0); !day.After(now); day = startOfDay(day, -1) {
+		for _, r := range s.runs(day) {
+			if r.After(last) && !r.After(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Next returns the first run after now within a week
+func (s Schedule) Next(now time.Time) (time.Time, bool) {
+	if !s.Enabled {
+		return time.Time{}, false
+	}
+	for i := 0; i < 8; i++ {
+		for _, r := range s.runs(startOfDay(now, -i)) {
+			if r.After(now) {
+				return r, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
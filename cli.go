@@ -0,0 +1,780 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"ipcas2-scanner/catalog"
+	"ipcas2-scanner/cleaner"
+	"ipcas2-scanner/doctor"
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/probe"
+	"ipcas2-scanner/quarantine"
+	"ipcas2-scanner/region"
+	"ipcas2-scanner/report"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/server"
+	"ipcas2-scanner/update"
+	"ipcas2-scanner/usage"
+)
+
+// Exit codes of the command line mode
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitUsage   = 2
+	exitPending = 3 // update --check found files to update
+)
+
+const cliUsage = `Cách dùng: IPC-Toyz <lệnh> [tham số]
+
+  update --check [--source PATH]          Kiểm tra bản cập nhật (mã thoát 3 nếu cần cập nhật)
+  update --apply [--backup] [--source P]  Cập nhật IPCAS2
+         [--allow-unsigned]               Bỏ qua kiểm tra chữ ký manifest (không có update_key.pub)
+  scan [--delete] [--all-users]           Tìm (và cách ly) file theo quy tắc quét
+  ini get                                 Đọc sys_brcd và ACTIVE
+  ini set [--brcd 3612] [--token TOKEN7]  Ghi IPCAS2.ini
+  ini tokens                              Kiểm tra DLL của từng token
+  ini env [--set TEST|LIVE]               Xem / chuyển môi trường wsnaddr
+  ini history                             Lịch sử thay đổi IPCAS2.ini
+  ini revert --version IPCAS2_....ini     Khôi phục bản lưu trong lịch sử
+  region show | region apply              Xem / áp dụng định dạng ngày, số
+  clean --path U:\ [--dry-run]            Dọn file rác thư mục Picture (vào cách ly)
+  clean --scheduled [--path U:\]          Dọn theo lịch, ghi báo cáo vào C:\IPCAS2\Logs\clean
+  drive list                              Liệt kê ổ mạng (trạng thái, cố định, nhà cung cấp)
+  drive reconnect --drive U:              Kết nối lại ổ mạng bị mất
+  drive map --drive Z: --path \\host\share
+  drive unmap --drive Z:
+  quarantine list                         Liệt kê file trong thư mục cách ly
+  quarantine restore --id ID | --all      Khôi phục file về vị trí cũ
+  quarantine purge [--days 30]            Xóa hẳn file cách ly quá hạn
+  probe [--addr host:port]                Kết nối TCP tới wsnaddr và SMB 445 server cập nhật
+  monitor --duration 1h [--interval 30s] [--dns IP] [--csv PATH]
+                                          Giám sát kết nối, ghi lịch sử ra CSV
+  usage [--path U:\] [--top 20] [--timeout 10m]
+                                          Phân tích dung lượng U:\, C:\IPCAS2 và VirtualStore
+  doctor [--fix]                          Kiểm tra toàn bộ máy trạm (mã thoát 1 nếu có lỗi)
+  serve [--addr 127.0.0.1:8765] [--open]  Mở giao diện web thay cho cửa sổ ứng dụng
+
+scan, clean, update --apply và quarantine restore nhận thêm --report FILE.csv|.json|.html
+để ghi báo cáo đầy đủ từng file.
+
+Kết quả in ra stdout dạng JSON. Mã thoát: 0 thành công, 1 lỗi, 2 sai cú pháp.
+`
+
+// errUsage is returned by commands when their arguments are invalid
+var errUsage = errors.New("usage")
+
+// runCLI runs a headless command and returns the process exit code
+func runCLI(args []string) int {
+	commands := map[string]func([]string) (interface{}, int, error){
+		"update":     cliUpdate,
+		"scan":       cliScan,
+		"ini":        cliINI,
+		"region":     cliRegion,
+		"clean":      cliClean,
+		"drive":      cliDrive,
+		"serve":      cliServe,
+		"quarantine": cliQuarantine,
+		"doctor":     cliDoctor,
+		"probe":      cliProbe,
+		"monitor":    cliMonitor,
+		"usage":      cliDiskUsage,
+	}
+
+	run, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+
+	out, code, err := run(args[1:])
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+	if err != nil {
+		printJSON(map[string]interface{}{"error": err.Error(), "result": out})
+		return exitFailed
+	}
+	if out != nil {
+		printJSON(out)
+	}
+	return code
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// newFlags returns a flag set that reports errors instead of exiting
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {}
+	return fs
+}
+
+// writeReport exports r to path, in the format of its extension, when
+// --report was given
+func writeReport(path string, r *report.Report) error {
+	if path == "" {
+		return nil
+	}
+	return r.WriteFile(path)
+}
+
+// flagSet reports whether the flag name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func cliUpdate(args []string) (interface{}, int, error) {
+	fs := newFlags("update")
+	check := fs.Bool("check", false, "")
+	apply := fs.Bool("apply", false, "")
+	backup := fs.Bool("backup", false, "")
+	source := fs.String("source", "", "")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "")
+	reportPath := fs.String("report", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+	if *check == *apply {
+		return nil, exitUsage, errUsage
+	}
+
+	paths := updatePaths()
+	if *allowUnsigned {
+		paths.KeyFile = ""
+	}
+	src := paths.SourcePath()
+	if *source != "" {
+		src = *source
+	}
+
+	m, changes, published, err := update.Check(src, paths.Target, paths.KeyFile)
+	if err != nil {
+		return nil, exitFailed, err
+	}
+	key, _ := update.LoadKey(paths.KeyFile)
+	catalogUpdated, _ := catalog.Fetch(src, catalogFile, key)
+
+	if *check {
+		code := exitOK
+		if len(changes) > 0 {
+			code = exitPending
+		}
+		return map[string]interface{}{
+			"source":          src,
+			"installed":       update.ReadInstalled(paths.StateFile).Version,
+			"available":       m.Version,
+			"published":       published,
+			"catalog_updated": catalogUpdated,
+			"changes":         changes,
+		}, code, nil
+	}
+
+	out := map[string]interface{}{"source": src}
+	if len(changes) == 0 {
+		out["result"] = &update.Result{Version: m.Version}
+		return out, exitOK, nil
+	}
+
+	name, res, err := update.Install(m, changes, update.Options{SourceDir: src}, paths, *backup)
+	if name != "" {
+		out["backup"] = name
+	}
+	out["result"] = res
+	// A failed backup leaves no result: its error is the one to show
+	if *reportPath != "" && res != nil {
+		if rerr := writeReport(*reportPath, report.FromUpdate(changes, res)); err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return out, exitFailed, err
+	}
+	return out, exitOK, nil
+}
+
+func cliScan(args []string) (interface{}, int, error) {
+	fs := newFlags("scan")
+	del := fs.Bool("delete", false, "")
+	allUsers := fs.Bool("all-users", false, "")
+	reportPath := fs.String("report", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+
+	opts, err := scanOptions()
+	if err != nil {
+		return nil, exitFailed, err
+	}
+	if *allUsers {
+		if !scanner.IsElevated() {
+			return nil, exitFailed, errors.New("--all-users requires running as administrator")
+		}
+		if opts.Profiles, err = scanner.Profiles(scanner.UsersRoot()); err != nil {
+			return nil, exitFailed, err
+		}
+	}
+	sum, err := scanner.Scan(context.Background(), opts, nil)
+	if err != nil {
+		return nil, exitFailed, err
+	}
+
+	files := sum.Files
+	out := map[string]interface{}{"files": files, "progress": sum.Progress, "errors": sum.Errors}
+	if *allUsers {
+		out["by_user"] = sum.ByUser()
+	}
+	if !*del {
+		if err := writeReport(*reportPath, report.FromScan(files, nil)); err != nil {
+			return out, exitFailed, err
+		}
+		return out, exitOK, nil
+	}
+
+	deleted := []string{}
+	failed := []update.Failure{}
+	removed := make(map[string]error)
+	for _, f := range files {
+		_, err := quarantineStore.Add(f.Path, f.Rule)
+		removed[f.Path] = err
+		if err != nil {
+			failed = append(failed, update.Failure{Path: f.Path, Error: err.Error()})
+			continue
+		}
+		deleted = append(deleted, f.Path)
+	}
+	out["deleted"] = deleted
+	out["failed"] = failed
+	if err := writeReport(*reportPath, report.FromScan(files, removed)); err != nil {
+		return out, exitFailed, err
+	}
+	if len(failed) > 0 {
+		return out, exitFailed, fmt.Errorf("%d file could not be deleted", len(failed))
+	}
+	return out, exitOK, nil
+}
+
+func cliINI(args []string) (interface{}, int, error) {
+	if len(args) == 0 {
+		return nil, exitUsage, errUsage
+	}
+
+	switch args[0] {
+	case "get":
+		cfg, err := ipcasini.Read(ipcasini.Path)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		return cfg, exitOK, nil
+
+	case "set":
+		fs := newFlags("ini set")
+		brcd := fs.String("brcd", "", "")
+		token := fs.String("token", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, exitUsage, err
+		}
+
+		cfg, err := ipcasini.Read(ipcasini.Path)
+		if err != nil {
+			cfg = ipcasini.DefaultSettings
+		}
+		if *brcd != "" {
+			cfg.Branch = *brcd
+		}
+		if *token != "" {
+			cfg.Token = strings.ToUpper(*token)
+		}
+		if err := cfg.Validate(); err != nil {
+			return cfg, exitFailed, err
+		}
+		if err := ipcasini.Write(ipcasini.Path, cfg); err != nil {
+			return cfg, exitFailed, err
+		}
+		return cfg, exitOK, nil
+
+	case "tokens":
+		statuses := ipcasini.CheckTokens(ipcasini.Path)
+		out := map[string]interface{}{"tokens": statuses, "suggested": nil}
+		if t, ok := ipcasini.SuggestToken(statuses); ok {
+			out["suggested"] = t.ID
+		}
+		if cfg, err := ipcasini.Read(ipcasini.Path); err == nil {
+			out["active"] = cfg.Token
+			if st, ok := ipcasini.FindStatus(statuses, cfg.Token); !ok || !st.Present {
+				return out, exitFailed, fmt.Errorf("DLL of active token %s is missing", cfg.Token)
+			}
+		}
+		return out, exitOK, nil
+
+	case "history":
+		versions, err := ipcasini.History()
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		if versions == nil {
+			versions = []ipcasini.Version{}
+		}
+		return versions, exitOK, nil
+
+	case "revert":
+		fs := newFlags("ini revert")
+		version := fs.String("version", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, exitUsage, err
+		}
+		if *version == "" {
+			return nil, exitUsage, errUsage
+		}
+		e, err := ipcasini.PlanRevert(ipcasini.Path, *version)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		out := map[string]interface{}{"version": *version, "changes": e.Changes()}
+		if err := e.Apply(); err != nil {
+			return out, exitFailed, err
+		}
+		return out, exitOK, nil
+
+	case "env":
+		fs := newFlags("ini env")
+		set := fs.String("set", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, exitUsage, err
+		}
+
+		envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		if *set != "" {
+			env, ok := ipcasini.FindEnvironment(envs, *set)
+			if !ok {
+				return nil, exitFailed, fmt.Errorf("unknown environment %q", *set)
+			}
+			if err := ipcasini.SwitchEnvironment(ipcasini.Path, env, envs); err != nil {
+				return nil, exitFailed, err
+			}
+		}
+		env, ok, err := ipcasini.CurrentEnvironment(ipcasini.Path, envs)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		out := map[string]interface{}{"environments": envs, "current": nil}
+		if ok {
+			out["current"] = env
+		}
+		return out, exitOK, nil
+	}
+	return nil, exitUsage, errUsage
+}
+
+func cliRegion(args []string) (interface{}, int, error) {
+	if len(args) != 1 {
+		return nil, exitUsage, errUsage
+	}
+
+	switch args[0] {
+	case "show":
+		cur := region.Read()
+		return map[string]interface{}{"current": cur, "ipcas2": cur == region.IPCAS2}, exitOK, nil
+	case "apply":
+		err := region.ApplyIPCAS2()
+		cur := region.Read()
+		return map[string]interface{}{"current": cur, "restart_required": true}, exitOK, err
+	}
+	return nil, exitUsage, errUsage
+}
+
+func cliClean(args []string) (interface{}, int, error) {
+	fs := newFlags("clean")
+	path := fs.String("path", `U:\`, "")
+	dryRun := fs.Bool("dry-run", false, "")
+	scheduled := fs.Bool("scheduled", false, "")
+	reportPath := fs.String("report", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+
+	// Task Scheduler runs clean --scheduled: the schedule gives the path
+	// unless --path is set, and an unreachable share is not an error
+	if *scheduled {
+		if !flagSet(fs, "path") {
+			sched, err := cleaner.LoadSchedule(cleanScheduleFile)
+			if err != nil {
+				return nil, exitFailed, err
+			}
+			*path = sched.Path
+		}
+		r, err := unattendedClean(*path, "cli")
+		if err == nil && r.Result != nil {
+			err = writeReport(*reportPath, report.FromClean(r.Result))
+		}
+		if err != nil {
+			return r, exitFailed, err
+		}
+		return r, exitOK, nil
+	}
+
+	rules, err := cleaner.LoadRules(cleanRulesFile)
+	if err != nil {
+		return nil, exitFailed, err
+	}
+	var remove cleaner.RemoveFunc
+	if !*dryRun {
+		remove = quarantineJunk
+	}
+	res, err := cleaner.Run(context.Background(), *path, rules, remove)
+	if err == nil {
+		err = writeReport(*reportPath, report.FromClean(res))
+	}
+	if err != nil {
+		return res, exitFailed, err
+	}
+	return res, exitOK, nil
+}
+
+func cliDrive(args []string) (interface{}, int, error) {
+	if len(args) == 0 {
+		return nil, exitUsage, errUsage
+	}
+
+	fs := newFlags("drive " + args[0])
+	drive := fs.String("drive", "", "")
+	path := fs.String("path", "", "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, exitUsage, err
+	}
+
+	switch args[0] {
+	case "list":
+		return netdrive.List(), exitOK, nil
+	case "map":
+		if *drive == "" || *path == "" {
+			return nil, exitUsage, errUsage
+		}
+		if err := netdrive.Map(*drive, *path); err != nil {
+			return nil, exitFailed, err
+		}
+		return netdrive.Mapping{Drive: *drive, Remote: *path}, exitOK, nil
+	case "unmap":
+		if *drive == "" {
+			return nil, exitUsage, errUsage
+		}
+		if err := netdrive.Unmap(*drive); err != nil {
+			return nil, exitFailed, err
+		}
+		return netdrive.Mapping{Drive: *drive}, exitOK, nil
+	case "reconnect":
+		m, ok := netdrive.Find(netdrive.List(), *drive)
+		if !ok {
+			return nil, exitFailed, fmt.Errorf("%s is not mapped", *drive)
+		}
+		if err := netdrive.Reconnect(m); err != nil {
+			return m, exitFailed, err
+		}
+		return m, exitOK, nil
+	}
+	return nil, exitUsage, errUsage
+}
+
+// cliServe runs the HTTP mode until the listener fails
+func cliServe(args []string) (interface{}, int, error) {
+	fs := newFlags("serve")
+	addr := fs.String("addr", "127.0.0.1:8765", "")
+	token := fs.String("token", "", "")
+	open := fs.Bool("open", false, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+	if *token == "" {
+		*token = server.NewToken()
+	}
+
+	l, err := server.Listen(*addr)
+	if err != nil {
+		return nil, exitFailed, err
+	}
+	url := fmt.Sprintf("http://%s/?token=%s", l.Addr(), *token)
+	printJSON(map[string]string{"url": url})
+	if *open {
+		exec.Command("cmd", "/C", "start", "", url).Start()
+	}
+
+	return nil, exitFailed, server.New(*token, server.Config{
+		Update:     updatePaths(),
+		ScanRules:  scanRulesFile,
+		Quarantine: quarantineStore,
+	}).Serve(l)
+}
+
+func cliQuarantine(args []string) (interface{}, int, error) {
+	if len(args) == 0 {
+		return nil, exitUsage, errUsage
+	}
+
+	fs := newFlags("quarantine " + args[0])
+	id := fs.String("id", "", "")
+	all := fs.Bool("all", false, "")
+	days := fs.Int("days", quarantineDays, "")
+	reportPath := fs.String("report", "", "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, exitUsage, err
+	}
+
+	switch args[0] {
+	case "list":
+		entries, err := quarantineStore.List()
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		if entries == nil {
+			entries = []quarantine.Entry{}
+		}
+		return entries, exitOK, nil
+
+	case "restore":
+		if (*id == "") == !*all {
+			return nil, exitUsage, errUsage
+		}
+		ids := []string{*id}
+		if *all {
+			entries, err := quarantineStore.List()
+			if err != nil {
+				return nil, exitFailed, err
+			}
+			ids = nil
+			for _, e := range entries {
+				ids = append(ids, e.ID)
+			}
+		}
+
+		restored := []quarantine.Entry{}
+		failed := []update.Failure{}
+		known, _ := quarantineStore.List()
+		var done []quarantine.Entry
+		errs := make(map[string]error)
+		for _, id := range ids {
+			e, err := quarantineStore.Restore(id)
+			if err != nil {
+				failed = append(failed, update.Failure{Path: id, Error: err.Error()})
+				errs[id] = err
+				for _, k := range known {
+					if k.ID == id {
+						done = append(done, k)
+					}
+				}
+				continue
+			}
+			restored = append(restored, *e)
+			done = append(done, *e)
+		}
+		out := map[string]interface{}{"restored": restored, "failed": failed}
+		if err := writeReport(*reportPath, report.FromQuarantine(done, errs)); err != nil {
+			return out, exitFailed, err
+		}
+		if len(failed) > 0 {
+			return out, exitFailed, fmt.Errorf("%d file could not be restored", len(failed))
+		}
+		return out, exitOK, nil
+
+	case "purge":
+		purged, err := quarantineStore.Purge(time.Duration(*days) * 24 * time.Hour)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		if purged == nil {
+			purged = []quarantine.Entry{}
+		}
+		return purged, exitOK, nil
+	}
+	return nil, exitUsage, errUsage
+}
+
+// cliDoctor audits the workstation and with --fix repairs what it can
+func cliDoctor(args []string) (interface{}, int, error) {
+	fs := newFlags("doctor")
+	fix := fs.Bool("fix", false, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+
+	checks := doctorChecks()
+	report := doctor.Run(context.Background(), checks)
+	out := map[string]interface{}{"report": report}
+	if *fix {
+		fixErrs := make(map[string]string)
+		for id, err := range doctor.FixAll(checks, report) {
+			fixErrs[id] = err.Error()
+		}
+		report = doctor.Run(context.Background(), checks)
+		out["report"] = report
+		out["fix_errors"] = fixErrs
+	}
+	if report.Worst() == doctor.Fail {
+		return out, exitFailed, nil
+	}
+	return out, exitOK, nil
+}
+
+// cliProbe connects to the IPCAS2 servers, or to --addr host:port
+func cliProbe(args []string) (interface{}, int, error) {
+	fs := newFlags("probe")
+	addr := fs.String("addr", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+
+	var targets []probe.Target
+	if *addr != "" {
+		targets = []probe.Target{{Name: "TCP", Addr: *addr}}
+	} else {
+		envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+		if err != nil {
+			return nil, exitFailed, err
+		}
+		targets = probe.Targets(ipcasini.Path, envs, updatePaths().SourcePath())
+	}
+	if len(targets) == 0 {
+		return nil, exitFailed, errors.New("no wsnaddr or update share to probe")
+	}
+
+	results := probe.Default.ProbeAll(context.Background(), targets)
+	for _, r := range results {
+		if !r.OK {
+			return results, exitFailed, nil
+		}
+	}
+	return results, exitOK, nil
+}
+
+// cliMonitor probes the monitored targets until --duration ends and writes
+// the history to --csv
+func cliMonitor(args []string) (interface{}, int, error) {
+	fs := newFlags("monitor")
+	duration := fs.Duration("duration", 0, "")
+	interval := fs.Duration("interval", 0, "")
+	dns := fs.String("dns", "", "")
+	csvPath := fs.String("csv", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+	if *duration <= 0 {
+		return nil, exitUsage, errUsage
+	}
+
+	targets, every, err := monitorTargets(*dns)
+	if err != nil {
+		return nil, exitFailed, err
+	}
+	if len(targets) == 0 {
+		return nil, exitFailed, errors.New("no target to monitor")
+	}
+	if *interval > 0 {
+		every = *interval
+	}
+
+	type change struct {
+		Time time.Time `json:"time"`
+		probe.Target
+		Up bool `json:"up"`
+	}
+	var changes []change
+	m := probe.NewMonitor(targets, every)
+	m.OnChange = func(t probe.Target, up bool) {
+		changes = append(changes, change{time.Now(), t, up})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	m.Run(ctx)
+
+	type summary struct {
+		probe.Target
+		Up      bool    `json:"up"`
+		Samples int     `json:"samples"`
+		Loss    float64 `json:"loss"`
+	}
+	out := map[string]interface{}{"changes": changes}
+	var sums []summary
+	code := exitOK
+	for _, st := range m.Snapshot() {
+		sums = append(sums, summary{st.Target, st.Up, len(st.Samples), st.Loss()})
+		if !st.Up {
+			code = exitFailed
+		}
+	}
+	out["targets"] = sums
+
+	if *csvPath != "" {
+		f, err := os.Create(*csvPath)
+		if err != nil {
+			return out, exitFailed, err
+		}
+		err = m.WriteCSV(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return out, exitFailed, err
+		}
+		out["csv"] = *csvPath
+	}
+	return out, code, nil
+}
+
+// cliDiskUsage analyzes the disk usage of --path, or of the default roots,
+// giving up after --timeout. Unreachable default roots are only reported.
+func cliDiskUsage(args []string) (interface{}, int, error) {
+	fs := newFlags("usage")
+	path := fs.String("path", "", "")
+	top := fs.Int("top", usage.DefaultTop, "")
+	timeout := fs.Duration("timeout", 0, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, exitUsage, err
+	}
+
+	roots := usage.Roots()
+	if *path != "" {
+		roots = []string{*path}
+	}
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	out := usage.AnalyzeAll(ctx, roots, *top, nil)
+	reached := 0
+	for _, a := range out {
+		if a.Stopped {
+			return out, exitFailed, nil
+		}
+		if a.Error == "" {
+			reached++
+		}
+	}
+	if reached == 0 {
+		return out, exitFailed, nil
+	}
+	return out, exitOK, nil
+}
@@ -0,0 +1,82 @@
+// Command ipcas2-manifest publishes the update manifest for an IPCAS2 Bin
+// share so that IPC-Toyz clients can check for updates without hashing it.
+// A catalog.json in the same folder is signed with the same key.
+//
+//	ipcas2-manifest -genkey update_key
+//	ipcas2-manifest -dir \\10.32.128.12\IPCAS2\Bin -version 2024.10.1 -key update_key
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"ipcas2-scanner/catalog"
+	"ipcas2-scanner/update"
+)
+
+func main() {
+	dir := flag.String("dir", "", "IPCAS2 Bin directory to publish")
+	version := flag.String("version", "", "release version")
+	keyFile := flag.String("key", "", "hex encoded ed25519 private key used to sign the manifest")
+	genKey := flag.String("genkey", "", "generate a key pair as <name> and <name>.pub, then exit")
+	flag.Parse()
+
+	if *genKey != "" {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(*genKey, []byte(hex.EncodeToString(priv)), 0600); err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(*genKey+".pub", []byte(hex.EncodeToString(pub)), 0644); err != nil {
+			fail(err)
+		}
+		fmt.Println("Copy", *genKey+".pub", "to C:\\IPCAS2\\update_key.pub on every client")
+		return
+	}
+
+	if *dir == "" || *version == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key ed25519.PrivateKey
+	if *keyFile != "" {
+		k, err := update.ReadPrivateKey(*keyFile)
+		if err != nil {
+			fail(err)
+		}
+		key = k
+	}
+
+	m, err := update.BuildManifest(*dir, *version)
+	if err != nil {
+		fail(err)
+	}
+	if err := m.Publish(*dir, key); err != nil {
+		fail(err)
+	}
+	fmt.Printf("Published version %s (%d files)\n", m.Version, len(m.Files))
+
+	if key == nil {
+		return
+	}
+	if err := catalog.Sign(*dir, key); errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		fail(err)
+	}
+	fmt.Println("Signed", catalog.FileName)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
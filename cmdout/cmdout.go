@@ -0,0 +1,213 @@
+// Package cmdout parses the output of Windows commands (ping, net use,
+// reg query) on English and Vietnamese systems. Console output comes in the
+// OEM code page and goes through Decode first. The parsers key on numbers,
+// symbols and column layout rather than on translated words; only the net
+// use status has to be read as a word, see NetUse.State.
+package cmdout
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PingStats is the outcome of a ping run
+type PingStats struct {
+	Sent     int             `json:"sent"`
+	Received int             `json:"received"` // echo replies, not "unreachable" answers
+	Loss     float64         `json:"loss"`     // percent
+	RTTs     []time.Duration `json:"rtts"`
+	Min      time.Duration   `json:"min"`
+	Avg      time.Duration   `json:"avg"`
+	Max      time.Duration   `json:"max"`
+	TTL      int             `json:"ttl"`
+}
+
+// OK reports whether at least one echo reply came back
+func (s PingStats) OK() bool {
+	return s.Received > 0
+}
+
+var (
+	// replyRTT matches time=12ms, time<1ms and thời gian=12ms
+	replyRTT = regexp.MustCompile(`([=<])\s*(\d+)\s*ms`)
+	replyTTL = regexp.MustCompile(`(?i)TTL=(\d+)`)
+	// pingCounts matches Sent = 4, Received = 4, Lost = 0 (0% loss) in
+	// any language
+	pingCounts = regexp.MustCompile(`=\s*(\d+),[^=]*=\s*(\d+),[^=]*=\s*(\d+)\s*\(\D*(\d+)%`)
+)
+
+// ParsePing reads the output of ping.exe. Only lines carrying a round trip
+// time are replies: IPv4 replies end in TTL=, IPv6 replies have a single
+// time=, while the summary lists three. Windows counts "Destination host
+// unreachable" as received, so the loss is computed from the replies rather
+// than taken from the summary.
+func ParsePing(out string) PingStats {
+	var s PingStats
+	for _, line := range lines(out) {
+		ttl := replyTTL.FindStringSubmatch(line)
+		if ttl != nil || len(replyRTT.FindAllString(line, -1)) == 1 {
+			s.Received++
+			if ttl != nil {
+				s.TTL, _ = strconv.Atoi(ttl[1])
+			}
+			if rtt := replyRTT.FindStringSubmatch(line); rtt != nil {
+				ms, _ := strconv.Atoi(rtt[2])
+				if rtt[1] == "<" {
+					ms = 0
+				}
+				s.RTTs = append(s.RTTs, time.Duration(ms)*time.Millisecond)
+			}
+			continue
+		}
+		if m := pingCounts.FindStringSubmatch(line); m != nil {
+			s.Sent, _ = strconv.Atoi(m[1])
+		}
+	}
+	if s.Sent < s.Received {
+		s.Sent = s.Received
+	}
+	if s.Sent > 0 {
+		s.Loss = float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+	}
+
+	var total time.Duration
+	for i, rtt := range s.RTTs {
+		if i == 0 || rtt < s.Min {
+			s.Min = rtt
+		}
+		if rtt > s.Max {
+			s.Max = rtt
+		}
+		total += rtt
+	}
+	if len(s.RTTs) > 0 {
+		s.Avg = total / time.Duration(len(s.RTTs))
+	}
+	return s
+}
+
+// NetUse is one connection listed by net use
+type NetUse struct {
+	Status  string `json:"status"` // as printed, e.g. OK, Disconnected, Đã ngắt kết nối
+	Local   string `json:"local"`  // drive letter, empty for IPC$ and printers
+	Remote  string `json:"remote"`
+	Network string `json:"network"` // provider
+}
+
+// Connection states of a net use row, whatever the Windows language
+const (
+	StateOK           = "OK"
+	StateDisconnected = "Disconnected"
+	StateUnavailable  = "Unavailable"
+)
+
+// netUseStates maps the lower-cased status words of English and Vietnamese
+// Windows, as composed by Decode. A share being reconnected is not usable
+// yet.
+var netUseStates = map[string]string{
+	"ok":               StateOK,
+	"disconnected":     StateDisconnected,
+	"reconnecting":     StateDisconnected,
+	"unavailable":      StateUnavailable,
+	"đã ngắt kết nối":  StateDisconnected,
+	"đang kết nối lại": StateDisconnected,
+	"không khả dụng":   StateUnavailable,
+}
+
+// State returns the status as StateOK, StateDisconnected or
+// StateUnavailable. Unknown words count as unavailable.
+func (u NetUse) State() string {
+	if s, ok := netUseStates[strings.ToLower(strings.Join(strings.Fields(u.Status), " "))]; ok {
+		return s
+	}
+	return StateUnavailable
+}
+
+var (
+	driveLetter = regexp.MustCompile(`^[A-Za-z]:$`)
+	columnGap   = regexp.MustCompile(`\s{2,}`)
+)
+
+// ParseNetUse reads the output of net use without arguments: the rows
+// below the dashed line, with the remote found by its leading \\
+func ParseNetUse(out string) []NetUse {
+	var uses []NetUse
+	table := false
+	for _, line := range lines(out) {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "---") {
+			table = true
+			continue
+		}
+		i := strings.Index(line, `\\`)
+		if !table || i < 0 {
+			continue
+		}
+
+		cols := columnGap.Split(strings.TrimSpace(line[i:]), 2)
+		u := NetUse{Remote: cols[0]}
+		if len(cols) == 2 {
+			u.Network = cols[1]
+		}
+		prefix := strings.Fields(line[:i])
+		if n := len(prefix); n > 0 && driveLetter.MatchString(prefix[n-1]) {
+			u.Local = strings.ToUpper(prefix[n-1])
+			prefix = prefix[:n-1]
+		}
+		u.Status = strings.Join(prefix, " ")
+		uses = append(uses, u)
+	}
+	return uses
+}
+
+// ParseNetUseDrive reads the output of net use X:, a list of label/value
+// rows in a fixed order: local name, remote name, resource type, status.
+// ok is false when the drive is not mapped.
+func ParseNetUseDrive(out string) (NetUse, bool) {
+	var values []string
+	for _, line := range lines(out) {
+		if i := strings.Index(line, `\\`); i >= 0 {
+			values = append(values, strings.TrimSpace(line[i:]))
+			continue
+		}
+		parts := columnGap.Split(strings.TrimSpace(line), 2)
+		if len(parts) == 2 {
+			values = append(values, strings.TrimSpace(parts[1]))
+		}
+	}
+	var u NetUse
+	for i, v := range values {
+		switch {
+		case u.Local == "" && driveLetter.MatchString(v):
+			u.Local = strings.ToUpper(v)
+		case u.Remote == "" && strings.HasPrefix(v, `\\`):
+			u.Remote = v
+			// resource type follows the remote, then the status
+			if i+2 < len(values) {
+				u.Status = values[i+2]
+			}
+		}
+	}
+	return u, u.Remote != ""
+}
+
+// ParseRegQuery returns the data of value name in the output of
+// reg query KEY /v name. Data may contain spaces.
+func ParseRegQuery(out, name string) (string, bool) {
+	for _, line := range lines(out) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], name) || !strings.HasPrefix(fields[1], "REG_") {
+			continue
+		}
+		i := strings.Index(line, fields[1]) + len(fields[1])
+		return strings.TrimSpace(line[i:]), true
+	}
+	return "", false
+}
+
+// lines splits out on LF or CRLF
+func lines(out string) []string {
+	return strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+}
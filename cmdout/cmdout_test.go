@@ -0,0 +1,140 @@
+package cmdout
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture returns the command output saved in testdata, decoded from the
+// OEM code page of the language in its name
+func capture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := 437
+	if strings.Contains(name, "_vi") {
+		cp = 1258
+	}
+	return DecodeCodePage(data, cp)
+}
+
+func TestParsePing(t *testing.T) {
+	ms := time.Millisecond
+	for _, tc := range []struct {
+		file string
+		want PingStats
+	}{
+		{"ping_en.txt", PingStats{Sent: 4, Received: 3, Loss: 25, RTTs: []time.Duration{2 * ms, 0, 3 * ms},
+			Min: 0, Avg: 5 * ms / 3, Max: 3 * ms, TTL: 127}},
+		{"ping_vi.txt", PingStats{Sent: 4, Received: 4, Loss: 0, RTTs: []time.Duration{ms, 2 * ms, 0, ms},
+			Min: 0, Avg: ms, Max: 2 * ms, TTL: 127}},
+		{"ping_unreachable_en.txt", PingStats{Sent: 4, Loss: 100}},
+		{"ping_unreachable_vi.txt", PingStats{Sent: 4, Loss: 100}},
+		{"ping6_en.txt", PingStats{Sent: 4, Received: 4, Loss: 0, RTTs: []time.Duration{0, ms, 4 * ms, ms},
+			Min: 0, Avg: 1500 * time.Microsecond, Max: 4 * ms}},
+		{"ping6_vi.txt", PingStats{Sent: 4, Received: 3, Loss: 25, RTTs: []time.Duration{2 * ms, 2 * ms, 5 * ms},
+			Min: 2 * ms, Avg: 3 * ms, Max: 5 * ms}},
+	} {
+		got := ParsePing(capture(t, tc.file))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.file, got, tc.want)
+		}
+	}
+}
+
+func TestParseNetUse(t *testing.T) {
+	network := "Microsoft Windows Network"
+	for _, tc := range []struct {
+		file   string
+		want   []NetUse
+		states []string
+	}{
+		{"netuse_en.txt", []NetUse{
+			{"OK", "U:", `\\10.32.128.12\Picture`, network},
+			{"Disconnected", "Z:", `\\10.32.128.12\IPCAS2`, network},
+			{"Unavailable", "Y:", `\\10.32.128.13\Scan`, network},
+			{"OK", "T:", `\\10.32.128.12\IPCAS2\Bin\Backup\2024`, ""},
+			{"OK", "", `\\10.32.128.12\IPC$`, network},
+		}, []string{StateOK, StateDisconnected, StateUnavailable, StateOK, StateOK}},
+		{"netuse_vi.txt", []NetUse{
+			{"OK", "U:", `\\10.32.128.12\Picture`, network},
+			{"Đã ngắt kết nối", "Z:", `\\10.32.128.12\IPCAS2`, network},
+			{"Không khả dụng", "Y:", `\\10.32.128.13\Scan`, network},
+			{"OK", "", `\\10.32.128.12\IPC$`, network},
+		}, []string{StateOK, StateDisconnected, StateUnavailable, StateOK}},
+	} {
+		got := ParseNetUse(capture(t, tc.file))
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.file, got, tc.want)
+			continue
+		}
+		for i, u := range got {
+			if s := u.State(); s != tc.states[i] {
+				t.Errorf("%s: %s state = %s, want %s", tc.file, u.Remote, s, tc.states[i])
+			}
+		}
+	}
+}
+
+func TestParseNetUseDrive(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		want  NetUse
+		ok    bool
+		state string
+	}{
+		{"netuse_drive_en.txt", NetUse{Status: "OK", Local: "U:", Remote: `\\10.32.128.12\Picture`}, true, StateOK},
+		{"netuse_drive_vi.txt", NetUse{Status: "Đã ngắt kết nối", Local: "Z:", Remote: `\\10.32.128.12\IPCAS2`}, true, StateDisconnected},
+		{"netuse_drive_missing_en.txt", NetUse{}, false, StateUnavailable},
+	} {
+		got, ok := ParseNetUseDrive(capture(t, tc.file))
+		if ok != tc.ok || got != tc.want || got.State() != tc.state {
+			t.Errorf("%s: got %+v, %v (%s)", tc.file, got, ok, got.State())
+		}
+	}
+}
+
+func TestParseRegQuery(t *testing.T) {
+	for _, tc := range []struct {
+		file, name, want string
+		ok               bool
+	}{
+		{"regquery_en.txt", "sShortDate", "dd/MM/yyyy", true},
+		{"regquery_en.txt", "sLongDate", "dddd, d MMMM, yyyy", true},
+		{"regquery_en.txt", "sshortdate", "dd/MM/yyyy", true},
+		{"regquery_en.txt", "sDecimal", "", false},
+		{"regquery_vi.txt", "sDecimal", ",", true},
+		{"regquery_missing_en.txt", "sShortDate", "", false},
+	} {
+		got, ok := ParseRegQuery(capture(t, tc.file), tc.name)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("%s %s: got %q, %v", tc.file, tc.name, got, ok)
+		}
+	}
+}
+
+func TestDecodeCodePage(t *testing.T) {
+	for _, tc := range []struct {
+		in   []byte
+		cp   int
+		want string
+	}{
+		// Windows-1258 writes ã as a followed by a combining tilde
+		{[]byte("\xd0a\xde ng\xe3\xect k\xea\xect n\xf4\xeci"), 1258, "Đã ngắt kết nối"},
+		{[]byte("Kh\xf4ng kha\xd2 du\xf2ng"), 1258, "Không khả dụng"},
+		// Already UTF-8, e.g. after chcp 65001
+		{[]byte("Đã ngắt kết nối"), 1258, "Đã ngắt kết nối"},
+		{[]byte("OK"), 437, "OK"},
+		{[]byte("Datentr\x84ger"), 850, "Datenträger"},
+	} {
+		if got := DecodeCodePage(tc.in, tc.cp); got != tc.want {
+			t.Errorf("DecodeCodePage(%q, %d) = %q, want %q", tc.in, tc.cp, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package cmdout
+
+// oemCodePage is unknown outside Windows: output is taken as UTF-8
+func oemCodePage() int {
+	return 0
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package cmdout
+
+import "syscall"
+
+var procGetOEMCP = syscall.NewLazyDLL("kernel32.dll").NewProc("GetOEMCP")
+
+// oemCodePage returns the code page console programs write in
+func oemCodePage() int {
+	cp, _, _ := procGetOEMCP.Call()
+	return int(cp)
+}
@@ -0,0 +1,42 @@
+package cmdout
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// codePages are the OEM code pages console output may come in. Vietnamese
+// Windows uses 1258, which writes most tone marks as combining characters.
+var codePages = map[int]encoding.Encoding{
+	437:  charmap.CodePage437,
+	850:  charmap.CodePage850,
+	852:  charmap.CodePage852,
+	858:  charmap.CodePage858,
+	866:  charmap.CodePage866,
+	1250: charmap.Windows1250,
+	1251: charmap.Windows1251,
+	1252: charmap.Windows1252,
+	1258: charmap.Windows1258,
+}
+
+// Decode converts the output of a command to UTF-8, reading it in the OEM
+// code page of the machine
+func Decode(out []byte) string {
+	return DecodeCodePage(out, oemCodePage())
+}
+
+// DecodeCodePage converts out from code page cp. Output that is valid UTF-8
+// already, e.g. after chcp 65001, is kept. Base letters and combining marks
+// are composed so that the text compares equal to the words typed in Go.
+func DecodeCodePage(out []byte, cp int) string {
+	s := string(out)
+	if enc, ok := codePages[cp]; ok && !utf8.Valid(out) {
+		if b, err := enc.NewDecoder().Bytes(out); err == nil {
+			s = string(b)
+		}
+	}
+	return norm.NFC.String(s)
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+// attachConsole is a no-op outside Windows, where the process keeps the
+// console it was started from.
+func attachConsole() {}
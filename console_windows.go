@@ -0,0 +1,28 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// attachParentProcess is ATTACH_PARENT_PROCESS for AttachConsole
+const attachParentProcess = ^uintptr(0)
+
+// attachConsole connects stdout/stderr to the console of the parent process.
+// The release build is linked with -H windowsgui and therefore starts without
+// a console; output that is already redirected to a file or pipe is kept.
+func attachConsole() {
+	if _, err := os.Stdout.Stat(); err == nil {
+		return
+	}
+	proc := syscall.NewLazyDLL("kernel32.dll").NewProc("AttachConsole")
+	if r, _, _ := proc.Call(attachParentProcess); r == 0 {
+		return
+	}
+	if f, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout = f
+		os.Stderr = f
+	}
+}
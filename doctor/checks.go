@@ -0,0 +1,374 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"ipcas2-scanner/catalog"
+	"ipcas2-scanner/ini"
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/probe"
+	"ipcas2-scanner/region"
+	"ipcas2-scanner/update"
+)
+
+// Env is what the standard checks inspect. Everything outside the INI file
+// and its folders goes through a function so tests can pass fakes; a nil
+// function skips the check or its fix.
+type Env struct {
+	INIPath      string
+	Catalog      *catalog.Catalog
+	Environments []ipcasini.Environment
+	// Defaults are written when the INI fix creates a missing IPCAS2.ini
+	Defaults ipcasini.Settings
+
+	// WriteINI stores sys_brcd and ACTIVE into the INI at path
+	WriteINI func(path string, s ipcasini.Settings) error
+	// Tokens resolves the token DLLs named by the INI at path
+	Tokens func(path string) []ipcasini.TokenStatus
+
+	// Writable returns nil when files can be created in dir
+	Writable func(dir string) error
+	// MakeDir creates dir and lets everyone write to it
+	MakeDir func(dir string) error
+
+	Region      func() region.Settings
+	ApplyRegion func() error
+
+	// INICopies returns the stray IPCAS2.ini copies found by the scanner
+	INICopies  func(ctx context.Context) ([]string, error)
+	Quarantine func(path string) error
+
+	// UpdateDiff returns the Bin files that differ from the update share
+	UpdateDiff func() ([]update.Change, error)
+
+	Drives   func() []netdrive.Mapping
+	MapDrive func(drive, remote string) error
+
+	// Dial connects to a host:port address
+	Dial func(ctx context.Context, addr string) error
+}
+
+// PictureDrive is the drive IPCAS2 reads scanned pictures from
+const PictureDrive = "U:"
+
+// Standard returns the checks of a workstation audit, in the order they
+// are shown
+func Standard(env Env) []Check {
+	if env.Catalog == nil {
+		env.Catalog = ipcasini.Catalog
+	}
+	if env.Environments == nil {
+		env.Environments = ipcasini.DefaultEnvironments
+	}
+	if env.Defaults == (ipcasini.Settings{}) {
+		env.Defaults = ipcasini.DefaultSettings
+	}
+	checks := []Check{iniCheck(env), branchCheck(env)}
+	if env.Tokens != nil {
+		checks = append(checks, tokenCheck(env))
+	}
+	for _, d := range folders {
+		checks = append(checks, folderCheck(env, d))
+	}
+	if env.INICopies != nil {
+		checks = append(checks, copiesCheck(env))
+	}
+	if env.Region != nil {
+		checks = append(checks, regionCheck(env))
+	}
+	if env.UpdateDiff != nil {
+		checks = append(checks, updateCheck(env))
+	}
+	if env.Drives != nil {
+		checks = append(checks, driveCheck(env))
+	}
+	if env.Dial != nil {
+		checks = append(checks, wsnaddrCheck(env))
+	}
+	return checks
+}
+
+// loadINI returns the INI at env.INIPath, or the template when missing
+func loadINI(env Env) (*ini.File, bool) {
+	f, err := ini.Load(env.INIPath)
+	if err != nil {
+		return ini.Parse([]byte(fmt.Sprintf(ipcasini.Template, "", ""))), false
+	}
+	return f, true
+}
+
+// branch returns the catalog entry of sys_brcd
+func branch(env Env) (catalog.Branch, bool) {
+	f, _ := loadINI(env)
+	return env.Catalog.Branch(f.Value("IPCAS2", "sys_brcd"))
+}
+
+func iniCheck(env Env) Check {
+	c := Check{
+		ID:   "ini",
+		Name: "File IPCAS2.ini",
+		Run: func(ctx context.Context) (Status, string) {
+			cfg, err := ipcasini.Read(env.INIPath)
+			if os.IsNotExist(err) {
+				return Fail, "Chưa có " + env.INIPath
+			}
+			if err != nil {
+				return Fail, err.Error()
+			}
+			if cfg.Branch == "" || cfg.Token == "" {
+				return Warn, "Thiếu sys_brcd hoặc ACTIVE"
+			}
+			return Pass, env.INIPath
+		},
+	}
+	if env.WriteINI != nil {
+		c.Fix = func() error {
+			if _, err := os.Stat(env.INIPath); err == nil {
+				return fmt.Errorf("%s exists, edit it in the INI tab", env.INIPath)
+			}
+			return env.WriteINI(env.INIPath, env.Defaults)
+		}
+	}
+	return c
+}
+
+func branchCheck(env Env) Check {
+	return Check{
+		ID:   "branch",
+		Name: "Mã chi nhánh",
+		Run: func(ctx context.Context) (Status, string) {
+			f, ok := loadINI(env)
+			if !ok {
+				return Fail, "Chưa có IPCAS2.ini"
+			}
+			code := f.Value("IPCAS2", "sys_brcd")
+			b, ok := env.Catalog.Branch(code)
+			if !ok {
+				return Fail, fmt.Sprintf("sys_brcd=%s không có trong danh mục", code)
+			}
+			return Pass, strings.TrimSpace(b.Code + " " + b.Name)
+		},
+	}
+}
+
+func tokenCheck(env Env) Check {
+	c := Check{
+		ID:   "token",
+		Name: "DLL token",
+		Run: func(ctx context.Context) (Status, string) {
+			cfg, err := ipcasini.Read(env.INIPath)
+			if err != nil {
+				return Fail, "Chưa có IPCAS2.ini"
+			}
+			st, ok := ipcasini.FindStatus(env.Tokens(env.INIPath), cfg.Token)
+			if !ok {
+				return Fail, fmt.Sprintf("ACTIVE=%s không có trong danh mục", cfg.Token)
+			}
+			if !st.Present {
+				return Fail, "Không tìm thấy " + st.Path
+			}
+			return Pass, st.String()
+		},
+	}
+	if env.WriteINI != nil {
+		c.Fix = func() error {
+			cfg, err := ipcasini.Read(env.INIPath)
+			if err != nil {
+				return err
+			}
+			t, ok := suggestToken(env.Tokens(env.INIPath), env.Defaults.Token)
+			if !ok {
+				return fmt.Errorf("no token DLL is installed")
+			}
+			cfg.Token = t.ID
+			return env.WriteINI(env.INIPath, cfg)
+		}
+	}
+	return c
+}
+
+// suggestToken picks the preferred token if its DLL is installed, otherwise
+// the first installed one
+func suggestToken(statuses []ipcasini.TokenStatus, preferred string) (ipcasini.Token, bool) {
+	if st, ok := ipcasini.FindStatus(statuses, preferred); ok && st.Present {
+		return st.Token, true
+	}
+	for _, st := range statuses {
+		if st.Present {
+			return st.Token, true
+		}
+	}
+	return ipcasini.Token{}, false
+}
+
+// folder is an INI key naming a folder IPCAS2 writes to
+type folder struct {
+	id, name, section, key string
+}
+
+var folders = []folder{
+	{"dir:appdir", "Thư mục Bin (appdir)", "TUXEDO", "appdir"},
+	{"dir:eiini", "Thư mục INI (eiini)", "TUXEDO", "eiini"},
+	{"dir:sign", "Thư mục chữ ký (CMSIGN)", "KEBSIGN", "CMSIGN"},
+	{"dir:cache", "Thư mục CACHE", "CACHE", "CACHE"},
+}
+
+func folderCheck(env Env, d folder) Check {
+	dir := func() string {
+		f, _ := loadINI(env)
+		return f.Value(d.section, d.key)
+	}
+	c := Check{
+		ID:   d.id,
+		Name: d.name,
+		Run: func(ctx context.Context) (Status, string) {
+			path := dir()
+			if path == "" {
+				return Fail, fmt.Sprintf("[%s] %s trống", d.section, d.key)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return Fail, "Không có " + path
+			}
+			if !info.IsDir() {
+				return Fail, path + " không phải thư mục"
+			}
+			if env.Writable != nil {
+				if err := env.Writable(path); err != nil {
+					return Fail, "Không ghi được vào " + path
+				}
+			}
+			return Pass, path
+		},
+	}
+	if env.MakeDir != nil {
+		c.Fix = func() error {
+			path := dir()
+			if path == "" {
+				return fmt.Errorf("[%s] %s is empty", d.section, d.key)
+			}
+			return env.MakeDir(path)
+		}
+	}
+	return c
+}
+
+func copiesCheck(env Env) Check {
+	c := Check{
+		ID:   "virtualstore",
+		Name: "IPCAS2.ini ẩn (VirtualStore)",
+		Run: func(ctx context.Context) (Status, string) {
+			paths, err := env.INICopies(ctx)
+			if err != nil {
+				return Warn, err.Error()
+			}
+			if len(paths) > 0 {
+				return Warn, fmt.Sprintf("%d bản sao: %s", len(paths), strings.Join(paths, ", "))
+			}
+			return Pass, "Không có bản sao"
+		},
+	}
+	if env.Quarantine != nil {
+		c.Fix = func() error {
+			paths, err := env.INICopies(context.Background())
+			if err != nil {
+				return err
+			}
+			for _, p := range paths {
+				if err := env.Quarantine(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return c
+}
+
+func regionCheck(env Env) Check {
+	c := Check{
+		ID:   "region",
+		Name: "Định dạng ngày, số",
+		Run: func(ctx context.Context) (Status, string) {
+			cur := env.Region()
+			detail := fmt.Sprintf("%s  %s  %s", cur.ShortDate, cur.Decimal, cur.Thousand)
+			if cur != region.IPCAS2 {
+				return Fail, detail + " (cần dd/MM/yyyy . ,)"
+			}
+			return Pass, detail
+		},
+	}
+	if env.ApplyRegion != nil {
+		c.Fix = env.ApplyRegion
+	}
+	return c
+}
+
+func updateCheck(env Env) Check {
+	return Check{
+		ID:   "update",
+		Name: "Bản cập nhật IPCAS2",
+		Run: func(ctx context.Context) (Status, string) {
+			changes, err := env.UpdateDiff()
+			if err != nil {
+				return Warn, "Không kiểm tra được: " + err.Error()
+			}
+			if len(changes) > 0 {
+				return Warn, fmt.Sprintf("%d file khác bản trên server (dùng tab Update)", len(changes))
+			}
+			return Pass, "Đã cập nhật mới nhất"
+		},
+	}
+}
+
+func driveCheck(env Env) Check {
+	c := Check{
+		ID:   "drive",
+		Name: "Ổ " + PictureDrive + " (Picture)",
+		Run: func(ctx context.Context) (Status, string) {
+			m, ok := netdrive.Find(env.Drives(), PictureDrive)
+			if !ok {
+				return Warn, "Chưa map ổ " + PictureDrive
+			}
+			if m.Status != netdrive.StatusOK {
+				return Warn, m.Remote + " (" + m.Status + ")"
+			}
+			return Pass, m.Remote
+		},
+	}
+	if env.MapDrive != nil {
+		c.Fix = func() error {
+			b, ok := branch(env)
+			if !ok || b.Picture == "" {
+				return fmt.Errorf("the catalog has no picture share for this branch")
+			}
+			return env.MapDrive(PictureDrive, b.Picture)
+		}
+	}
+	return c
+}
+
+func wsnaddrCheck(env Env) Check {
+	return Check{
+		ID:   "wsnaddr",
+		Name: "Kết nối Tuxedo (wsnaddr)",
+		Run: func(ctx context.Context) (Status, string) {
+			e, ok, err := ipcasini.CurrentEnvironment(env.INIPath, env.Environments)
+			if err != nil || !ok {
+				return Fail, "Chưa có wsnaddr"
+			}
+			addr, err := probe.ParseWSNAddr(e.Address)
+			if err != nil {
+				return Fail, err.Error()
+			}
+			if err := env.Dial(ctx, addr); err != nil {
+				return Fail, fmt.Sprintf("%s %s: %v", e.Name, addr, err)
+			}
+			return Pass, e.Name + " " + addr
+		},
+	}
+}
@@ -0,0 +1,149 @@
+// Package doctor audits an IPCAS2 workstation with a list of checks and
+// fixes what the app knows how to fix.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// rank orders statuses from best to worst
+func (s Status) rank() int {
+	switch s {
+	case Pass:
+		return 0
+	case Warn:
+		return 1
+	}
+	return 2
+}
+
+// Check is one diagnostic. Run returns the status and a detail for the
+// user; Fix is nil when the problem has to be solved by hand.
+type Check struct {
+	ID   string
+	Name string
+	Run  func(ctx context.Context) (Status, string)
+	Fix  func() error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Detail   string        `json:"detail"`
+	Fixable  bool          `json:"fixable"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of a whole run
+type Report struct {
+	Time    time.Time `json:"time"`
+	Results []Result  `json:"results"`
+	Pass    int       `json:"pass"`
+	Warn    int       `json:"warn"`
+	Fail    int       `json:"fail"`
+}
+
+// Worst returns the worst status of the report
+func (r *Report) Worst() Status {
+	worst := Pass
+	for _, res := range r.Results {
+		if res.Status.rank() > worst.rank() {
+			worst = res.Status
+		}
+	}
+	return worst
+}
+
+// Timeout bounds every check so one unreachable share cannot stall the run
+var Timeout = 15 * time.Second
+
+// Run runs checks in order. A check that panics or overruns Timeout fails
+// instead of aborting the run.
+func Run(ctx context.Context, checks []Check) *Report {
+	r := &Report{Time: time.Now()}
+	for _, c := range checks {
+		res := RunOne(ctx, c)
+		switch res.Status {
+		case Pass:
+			r.Pass++
+		case Warn:
+			r.Warn++
+		default:
+			r.Fail++
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// RunOne runs a single check
+func RunOne(ctx context.Context, c Check) Result {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	type outcome struct {
+		status Status
+		detail string
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{Fail, fmt.Sprint("lỗi: ", p)}
+			}
+		}()
+		st, detail := c.Run(ctx)
+		done <- outcome{st, detail}
+	}()
+
+	res := Result{ID: c.ID, Name: c.Name, Fixable: c.Fix != nil}
+	select {
+	case o := <-done:
+		res.Status, res.Detail = o.status, o.detail
+	case <-ctx.Done():
+		res.Status, res.Detail = Fail, "quá thời gian chờ"
+	}
+	res.Duration = time.Since(start)
+	return res
+}
+
+// Find returns the check with id
+func Find(checks []Check, id string) (Check, bool) {
+	for _, c := range checks {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// FixAll runs the fix of every failed or warned result that has one and
+// returns the errors by check id
+func FixAll(checks []Check, r *Report) map[string]error {
+	errs := make(map[string]error)
+	for _, res := range r.Results {
+		if res.Status == Pass || !res.Fixable {
+			continue
+		}
+		if c, ok := Find(checks, res.ID); ok {
+			if err := c.Fix(); err != nil {
+				errs[res.ID] = err
+			}
+		}
+	}
+	return errs
+}
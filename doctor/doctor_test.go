@@ -0,0 +1,208 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/scanner"
+)
+
+// testEnv returns an Env around an INI in a temporary folder. Every
+// function is a fake so no check touches the machine.
+func testEnv(t *testing.T, content string) (Env, *[]ipcasini.Settings) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var written []ipcasini.Settings
+	env := Env{
+		INIPath:  path,
+		Defaults: ipcasini.Settings{Branch: "3611", Token: "TOKEN7"},
+		WriteINI: func(path string, s ipcasini.Settings) error {
+			written = append(written, s)
+			return nil
+		},
+		Tokens: func(string) []ipcasini.TokenStatus {
+			return []ipcasini.TokenStatus{
+				{Token: ipcasini.Token{ID: "TOKEN2"}, Path: `C:\ipcas2\Bin\eToken.dll`, Present: true},
+				{Token: ipcasini.Token{ID: "TOKEN7"}, Path: `C:\ipcas2\Bin\agribank_csp11_v1.dll`},
+			}
+		},
+	}
+	return env, &written
+}
+
+func find(t *testing.T, checks []Check, id string) Check {
+	t.Helper()
+	c, ok := Find(checks, id)
+	if !ok {
+		t.Fatalf("no %s check", id)
+	}
+	return c
+}
+
+func TestINICheckCreatesMissingFile(t *testing.T) {
+	env, written := testEnv(t, "")
+	c := find(t, Standard(env), "ini")
+
+	if res := RunOne(context.Background(), c); res.Status != Fail || !res.Fixable {
+		t.Errorf("missing INI: %+v", res)
+	}
+	if err := c.Fix(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*written) != 1 || (*written)[0] != env.Defaults {
+		t.Errorf("written = %v, want the defaults", *written)
+	}
+}
+
+func TestTokenCheck(t *testing.T) {
+	env, written := testEnv(t, fmt.Sprintf(ipcasini.Template, "3611", "TOKEN7"))
+	c := find(t, Standard(env), "token")
+
+	res := RunOne(context.Background(), c)
+	if res.Status != Fail || !strings.Contains(res.Detail, "agribank_csp11_v1.dll") {
+		t.Errorf("missing DLL: %+v", res)
+	}
+	if err := c.Fix(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*written) != 1 || (*written)[0].Token != "TOKEN2" || (*written)[0].Branch != "3611" {
+		t.Errorf("written = %v, want TOKEN2 for branch 3611", *written)
+	}
+
+	env.Tokens = nil
+	if _, ok := Find(Standard(env), "token"); ok {
+		t.Error("token check present without a Tokens function")
+	}
+}
+
+func TestDriveCheck(t *testing.T) {
+	env, _ := testEnv(t, "")
+	for _, tc := range []struct {
+		drives []netdrive.Mapping
+		want   Status
+	}{
+		{nil, Warn},
+		{[]netdrive.Mapping{{Drive: "U:", Remote: `\\host\Picture`, Status: netdrive.StatusOK}}, Pass},
+		{[]netdrive.Mapping{{Drive: "U:", Remote: `\\host\Picture`, Status: netdrive.StatusDisconnected}}, Warn},
+		{[]netdrive.Mapping{{Drive: "U:", Remote: `\\host\Picture`, Status: netdrive.StatusUnavailable}}, Warn},
+	} {
+		drives := tc.drives
+		env.Drives = func() []netdrive.Mapping { return drives }
+		res := RunOne(context.Background(), find(t, Standard(env), "drive"))
+		if res.Status != tc.want {
+			t.Errorf("drives %v: status %s, want %s (%s)", drives, res.Status, tc.want, res.Detail)
+		}
+	}
+}
+
+func TestCopiesCheckQuarantinesFoundCopies(t *testing.T) {
+	env, _ := testEnv(t, "")
+	copies := []string{`C:\Users\a\AppData\Local\VirtualStore\Windows\IPCAS2.ini`}
+	var quarantined []string
+	env.INICopies = func(ctx context.Context) ([]string, error) { return copies, nil }
+	env.Quarantine = func(path string) error {
+		quarantined = append(quarantined, path)
+		return nil
+	}
+	c := find(t, Standard(env), "virtualstore")
+
+	if res := RunOne(context.Background(), c); res.Status != Warn {
+		t.Errorf("copies found: %+v", res)
+	}
+	if err := c.Fix(); err != nil || len(quarantined) != 1 || quarantined[0] != copies[0] {
+		t.Errorf("quarantined = %v, err = %v", quarantined, err)
+	}
+}
+
+func TestINICopiesKeepsOnlyINIFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"vs/Windows/IPCAS2.ini":  {Data: []byte("x")},
+		"vs/kebtmp.ini":          {Data: []byte("x")},
+		"vs/Program Files/a.dll": {Data: []byte("x")},
+	}
+	rules := &scanner.RuleSet{Rules: []scanner.Rule{
+		{Name: "ini", Pattern: "ipcas2.ini", Roots: []string{"vs"}},
+		{Name: "kebtmp", Pattern: "kebtmp.ini", Roots: []string{"vs"}},
+		{Name: "dll", Pattern: "*.dll", Roots: []string{"vs"}},
+	}}
+	opts := scanner.Options{Rules: rules, Attrs: noAttrs{}, Open: func(root string) fs.FS {
+		sub, _ := fs.Sub(fsys, filepath.ToSlash(root))
+		return sub
+	}}
+	paths, err := INICopies(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "IPCAS2.ini" {
+		t.Errorf("copies = %v", paths)
+	}
+}
+
+type noAttrs struct{}
+
+func (noAttrs) IsHidden(string) bool         { return true }
+func (noAttrs) SetHidden(string, bool) error { return nil }
+
+func TestFolderCheck(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "CACHE")
+	content := fmt.Sprintf("[TUXEDO]\nappdir=%s\n[CACHE]\nCACHE=%s\n", dir, missing)
+	env, _ := testEnv(t, content)
+	var made []string
+	env.MakeDir = func(dir string) error {
+		made = append(made, dir)
+		return nil
+	}
+	env.Writable = func(string) error { return nil }
+	checks := Standard(env)
+
+	if res := RunOne(context.Background(), find(t, checks, "dir:appdir")); res.Status != Pass {
+		t.Errorf("appdir: %+v", res)
+	}
+	c := find(t, checks, "dir:cache")
+	if res := RunOne(context.Background(), c); res.Status != Fail {
+		t.Errorf("missing CACHE: %+v", res)
+	}
+	if err := c.Fix(); err != nil || len(made) != 1 || made[0] != missing {
+		t.Errorf("made = %v, err = %v", made, err)
+	}
+}
+
+func TestRunSurvivesPanicsAndTimeouts(t *testing.T) {
+	old := Timeout
+	Timeout = 50 * time.Millisecond
+	defer func() { Timeout = old }()
+
+	checks := []Check{
+		{ID: "ok", Run: func(context.Context) (Status, string) { return Pass, "" }},
+		{ID: "panic", Run: func(context.Context) (Status, string) { panic("boom") }},
+		{ID: "slow", Run: func(ctx context.Context) (Status, string) {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			return Pass, ""
+		}},
+		{ID: "warn", Run: func(context.Context) (Status, string) { return Warn, "" }, Fix: func() error { return errors.New("no") }},
+	}
+	r := Run(context.Background(), checks)
+	if r.Pass != 1 || r.Warn != 1 || r.Fail != 2 || r.Worst() != Fail {
+		t.Errorf("report = %+v", r)
+	}
+	if errs := FixAll(checks, r); len(errs) != 1 || errs["warn"] == nil {
+		t.Errorf("fix errors = %v", errs)
+	}
+}
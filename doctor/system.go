@@ -0,0 +1,93 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/probe"
+	"ipcas2-scanner/region"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/update"
+)
+
+// System returns the Env of this machine. INI copies are found with the
+// built-in IPCAS2.ini rule and are not quarantined; callers set Quarantine
+// to move them away.
+func System(paths update.Paths) Env {
+	envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+	if err != nil {
+		envs = ipcasini.DefaultEnvironments
+	}
+	return Env{
+		INIPath:      ipcasini.Path,
+		Catalog:      ipcasini.Catalog,
+		Environments: envs,
+		Defaults:     ipcasini.DefaultSettings,
+		WriteINI:     ipcasini.Write,
+		Tokens:       ipcasini.CheckTokens,
+		Writable:     writable,
+		MakeDir:      makeDir,
+		Region:       region.Read,
+		ApplyRegion:  region.ApplyIPCAS2,
+		INICopies: func(ctx context.Context) ([]string, error) {
+			return INICopies(ctx, scanner.Options{})
+		},
+		UpdateDiff: func() ([]update.Change, error) {
+			_, changes, _, err := update.Check(paths.SourcePath(), paths.Target, paths.KeyFile)
+			return changes, err
+		},
+		Drives:   netdrive.List,
+		MapDrive: netdrive.Map,
+		Dial: func(ctx context.Context, addr string) error {
+			if res := probe.Default.Probe(ctx, probe.Target{Addr: addr}); !res.OK {
+				return errors.New(res.Error)
+			}
+			return nil
+		},
+	}
+}
+
+// iniName is the file name of the INI copies the doctor looks for
+const iniName = "IPCAS2.ini"
+
+// INICopies scans with opts and returns the IPCAS2.ini copies found. Other
+// files the rules match, such as kebtmp.ini or DLLs, are left out.
+func INICopies(ctx context.Context, opts scanner.Options) ([]string, error) {
+	sum, err := scanner.Scan(ctx, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range sum.Files {
+		if strings.EqualFold(filepath.Base(f.Path), iniName) {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths, nil
+}
+
+// writable creates and removes a temporary file in dir
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ipctoyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// makeDir creates dir and grants Everyone full control like the sign
+// folder fix of the INI tab
+func makeDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	exec.Command("icacls", dir, "/grant", "Everyone:F").Run()
+	return nil
+}
@@ -0,0 +1,157 @@
+package ini
+
+import (
+	"strings"
+)
+
+// Op is the kind of a diff line
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// DiffLine is one line of a line diff
+type DiffLine struct {
+	Op   Op
+	Text string
+}
+
+// Diff returns the line diff turning a into b, using the longest common
+// subsequence. Line endings are ignored.
+func Diff(a, b []byte) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the common length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []DiffLine
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, DiffLine{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Delete, x[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, DiffLine{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		out = append(out, DiffLine{Insert, y[j]})
+	}
+	return out
+}
+
+// FormatDiff renders changed lines prefixed with "+ " or "- " and keeps
+// context unchanged lines around them. Skipped runs are shown as "...".
+func FormatDiff(lines []DiffLine, context int) string {
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == Equal {
+			continue
+		}
+		for k := i - context; k <= i+context; k++ {
+			if k >= 0 && k < len(lines) {
+				keep[k] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	skipped := false
+	for i, l := range lines {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped && b.Len() > 0 {
+			b.WriteString("...\n")
+		}
+		skipped = false
+		switch l.Op {
+		case Insert:
+			b.WriteString("+ ")
+		case Delete:
+			b.WriteString("- ")
+		default:
+			b.WriteString("  ")
+		}
+		b.WriteString(l.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// KeyChange is a key whose value differs between two files. Old or New is
+// empty when the key was added or removed.
+type KeyChange struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+// Changes lists the keys that differ between a and b, in the order of b
+// followed by keys only present in a
+func Changes(a, b *File) []KeyChange {
+	var changes []KeyChange
+	seen := make(map[string]bool)
+	for _, section := range b.Sections() {
+		for _, key := range b.Keys(section) {
+			id := strings.ToLower(section + "." + key)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			old, _ := a.Get(section, key)
+			if v := b.Value(section, key); v != old {
+				changes = append(changes, KeyChange{section, key, old, v})
+			}
+		}
+	}
+	for _, section := range a.Sections() {
+		for _, key := range a.Keys(section) {
+			id := strings.ToLower(section + "." + key)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if _, ok := b.Get(section, key); !ok {
+				changes = append(changes, KeyChange{section, key, a.Value(section, key), ""})
+			}
+		}
+	}
+	return changes
+}
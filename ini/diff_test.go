@@ -0,0 +1,52 @@
+package ini
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	a := "[IPCAS2]\r\nsys_brcd=3612\r\ncacheflag=N\r\n[LIVE]\r\nwsnaddr=//a:1\r\n"
+	b := "[IPCAS2]\nsys_brcd=3600\ncacheflag=N\n[LIVE]\nwsnaddr=//a:1\nextra=1\n"
+
+	want := []DiffLine{
+		{Equal, "[IPCAS2]"},
+		{Delete, "sys_brcd=3612"},
+		{Insert, "sys_brcd=3600"},
+		{Equal, "cacheflag=N"},
+		{Equal, "[LIVE]"},
+		{Equal, "wsnaddr=//a:1"},
+		{Insert, "extra=1"},
+	}
+	got := Diff([]byte(a), []byte(b))
+	if len(got) != len(want) {
+		t.Fatalf("Diff = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if d := Diff(nil, []byte("a=1\n")); len(d) != 1 || d[0].Op != Insert {
+		t.Errorf("Diff from nothing = %v", d)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	lines := []DiffLine{
+		{Equal, "a"}, {Equal, "b"}, {Delete, "c=1"}, {Insert, "c=2"},
+		{Equal, "d"}, {Equal, "e"}, {Equal, "f"}, {Insert, "g"},
+	}
+	want := "  b\n- c=1\n+ c=2\n  d\n...\n  f\n+ g\n"
+	if got := FormatDiff(lines, 1); got != want {
+		t.Errorf("FormatDiff =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	a := Parse([]byte("[S]\nx=1\ny=2\n"))
+	b := Parse([]byte("[S]\nx=1\ny=3\nz=4\n"))
+	got := Changes(a, b)
+	want := []KeyChange{{"S", "y", "2", "3"}, {"S", "z", "", "4"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Changes = %v, want %v", got, want)
+	}
+}
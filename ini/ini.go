@@ -0,0 +1,326 @@
+// Package ini reads and edits Windows INI files without reformatting them.
+// Unchanged files are written back byte for byte; Set only rewrites the
+// value of the line it touches.
+package ini
+
+import (
+	"os"
+	"strings"
+)
+
+// lineKind tells what a parsed line holds
+type lineKind int
+
+const (
+	blankLine lineKind = iota
+	commentLine
+	sectionLine
+	keyLine
+	otherLine
+)
+
+// bom is the UTF-8 byte order mark Notepad may put before the first line
+const bom = "\uFEFF"
+
+// line is one physical line of the file. raw keeps the original text with
+// its line ending so untouched lines are written back as read.
+type line struct {
+	kind    lineKind
+	raw     string
+	section string // section name for sectionLine
+	key     string
+	value   string
+	prefix  string // "KEY = " up to the value
+	suffix  string // trailing spaces and line ending after the value
+}
+
+// File is a parsed INI file
+type File struct {
+	lines []*line
+	eol   string
+}
+
+// Parse splits data into lines. Every input is accepted; lines that are
+// neither sections, comments nor key=value pairs are kept as they are.
+func Parse(data []byte) *File {
+	f := &File{eol: "\r\n"}
+	text := string(data)
+	if i := strings.Index(text, "\n"); i >= 0 && (i == 0 || text[i-1] != '\r') {
+		f.eol = "\n"
+	}
+
+	for _, raw := range strings.SplitAfter(text, "\n") {
+		if raw == "" {
+			continue
+		}
+		f.lines = append(f.lines, parseLine(raw))
+	}
+	return f
+}
+
+// Load parses the file at path
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data), nil
+}
+
+func parseLine(raw string) *line {
+	l := &line{raw: raw}
+	body := strings.TrimRight(raw, "\r\n")
+	trimmed := strings.TrimSpace(strings.TrimPrefix(body, bom))
+
+	switch {
+	case trimmed == "":
+		l.kind = blankLine
+	case trimmed[0] == ';' || trimmed[0] == '#':
+		l.kind = commentLine
+	case trimmed[0] == '[' && strings.HasSuffix(trimmed, "]"):
+		l.kind = sectionLine
+		l.section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+	case strings.Contains(trimmed, "="):
+		l.kind = keyLine
+		eq := strings.Index(body, "=")
+		l.key = strings.TrimSpace(strings.TrimPrefix(body[:eq], bom))
+
+		// Values may contain ';' (fldtbldir32) so there are no inline comments
+		rest := body[eq+1:]
+		start := eq + 1 + len(rest) - len(strings.TrimLeft(rest, " \t"))
+		value := strings.TrimRight(body[start:], " \t")
+		l.prefix = body[:start]
+		l.value = value
+		l.suffix = raw[start+len(value):]
+	default:
+		l.kind = otherLine
+	}
+	return l
+}
+
+// Bytes renders the file
+func (f *File) Bytes() []byte {
+	var b strings.Builder
+	for _, l := range f.lines {
+		b.WriteString(l.raw)
+	}
+	return []byte(b.String())
+}
+
+// Save writes the file to path
+func (f *File) Save(path string) error {
+	return os.WriteFile(path, f.Bytes(), 0666)
+}
+
+// Sections returns the section names in file order. Keys before the first
+// section belong to the unnamed section "", which is listed only if used.
+func (f *File) Sections() []string {
+	var names []string
+	seen := make(map[string]bool)
+	current := ""
+	for _, l := range f.lines {
+		name := ""
+		switch l.kind {
+		case sectionLine:
+			current = l.section
+			name = l.section
+		case keyLine:
+			name = current
+		default:
+			continue
+		}
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Keys returns the keys of section in file order
+func (f *File) Keys(section string) []string {
+	var keys []string
+	f.each(section, func(i int, l *line) {
+		keys = append(keys, l.key)
+	})
+	return keys
+}
+
+// Get returns the value of key in section. Names are case-insensitive like
+// GetPrivateProfileString; the first occurrence wins.
+func (f *File) Get(section, key string) (string, bool) {
+	if i := f.find(section, key); i >= 0 {
+		return f.lines[i].value, true
+	}
+	return "", false
+}
+
+// Value returns the value of key in section, or "" when it is missing
+func (f *File) Value(section, key string) string {
+	v, _ := f.Get(section, key)
+	return v
+}
+
+// Set changes the value of key in section, keeping the spacing around '='.
+// A missing key is added after the last key of the section and a missing
+// section is appended to the end of the file.
+func (f *File) Set(section, key, value string) {
+	if i := f.find(section, key); i >= 0 {
+		l := f.lines[i]
+		l.value = value
+		l.raw = l.prefix + value + l.suffix
+		return
+	}
+
+	nl := &line{kind: keyLine, key: key, value: value, prefix: key + "=", suffix: f.eol}
+	nl.raw = nl.prefix + value + nl.suffix
+
+	start, end := f.bounds(section)
+	if start < 0 {
+		f.terminate()
+		if section != "" {
+			f.lines = append(f.lines, parseLine("["+section+"]"+f.eol))
+		}
+		f.lines = append(f.lines, nl)
+		return
+	}
+
+	// Insert after the last key so trailing blanks and comments stay
+	// attached to the next section
+	at := start
+	for i := start; i < end; i++ {
+		if f.lines[i].kind == keyLine || f.lines[i].kind == sectionLine {
+			at = i + 1
+		}
+	}
+	if at > 0 && !strings.HasSuffix(f.lines[at-1].raw, "\n") {
+		f.lines[at-1].raw += f.eol
+		f.lines[at-1].suffix += f.eol
+	}
+	f.lines = append(f.lines[:at], append([]*line{nl}, f.lines[at:]...)...)
+}
+
+// Delete removes key from section and reports whether it was present
+func (f *File) Delete(section, key string) bool {
+	i := f.find(section, key)
+	if i < 0 {
+		return false
+	}
+	f.lines = append(f.lines[:i], f.lines[i+1:]...)
+	return true
+}
+
+// Disable comments out key in section with ';' so IPCAS2 ignores it while
+// the value stays in the file. It reports whether the key was active.
+func (f *File) Disable(section, key string) bool {
+	i := f.find(section, key)
+	if i < 0 {
+		return false
+	}
+	f.lines[i] = parseLine(";" + f.lines[i].raw)
+	return true
+}
+
+// Enable uncomments the first ";key=value" line of section. It reports
+// whether such a line was found.
+func (f *File) Enable(section, key string) bool {
+	i := f.findDisabled(section, key)
+	if i < 0 {
+		return false
+	}
+	raw := f.lines[i].raw
+	at := strings.IndexAny(raw, ";#")
+	f.lines[i] = parseLine(raw[:at] + raw[at+1:])
+	return true
+}
+
+// Disabled returns the value of a commented out key in section
+func (f *File) Disabled(section, key string) (string, bool) {
+	if i := f.findDisabled(section, key); i >= 0 {
+		raw := f.lines[i].raw
+		at := strings.IndexAny(raw, ";#")
+		return parseLine(raw[at+1:]).value, true
+	}
+	return "", false
+}
+
+// findDisabled returns the index of the comment line holding key=value in
+// section, or -1
+func (f *File) findDisabled(section, key string) int {
+	current := ""
+	for i, l := range f.lines {
+		switch l.kind {
+		case sectionLine:
+			current = l.section
+		case commentLine:
+			if !strings.EqualFold(current, section) {
+				continue
+			}
+			raw := l.raw
+			at := strings.IndexAny(raw, ";#")
+			if c := parseLine(raw[at+1:]); c.kind == keyLine && strings.EqualFold(c.key, key) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// find returns the line index of key in section, or -1
+func (f *File) find(section, key string) int {
+	found := -1
+	f.each(section, func(i int, l *line) {
+		if found < 0 && strings.EqualFold(l.key, key) {
+			found = i
+		}
+	})
+	return found
+}
+
+// each calls fn for every key line of section
+func (f *File) each(section string, fn func(i int, l *line)) {
+	current := ""
+	for i, l := range f.lines {
+		switch l.kind {
+		case sectionLine:
+			current = l.section
+		case keyLine:
+			if strings.EqualFold(current, section) {
+				fn(i, l)
+			}
+		}
+	}
+}
+
+// bounds returns the line range of the first block of section. The range
+// starts after the header and ends before the next header. start is -1
+// when the section does not exist.
+func (f *File) bounds(section string) (start, end int) {
+	start = -1
+	if section == "" {
+		start = 0
+	}
+	for i, l := range f.lines {
+		if l.kind != sectionLine {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if strings.EqualFold(l.section, section) {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, len(f.lines)
+}
+
+// terminate ends the last line so new lines can be appended
+func (f *File) terminate() {
+	if n := len(f.lines); n > 0 && !strings.HasSuffix(f.lines[n-1].raw, "\n") {
+		f.lines[n-1].raw += f.eol
+		f.lines[n-1].suffix += f.eol
+	}
+}
@@ -0,0 +1,183 @@
+package ini_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ipcas2-scanner/ini"
+	"ipcas2-scanner/ipcasini"
+)
+
+// variants returns the standard IPCAS2.ini as Notepad may save it: LF, CRLF
+// and CRLF with a byte order mark
+func variants() map[string]string {
+	lf := fmt.Sprintf(ipcasini.Template, "3611", "TOKEN7")
+	crlf := strings.ReplaceAll(lf, "\n", "\r\n")
+	return map[string]string{"lf": lf, "crlf": crlf, "bom": "\uFEFF" + crlf}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, src := range variants() {
+		if got := string(ini.Parse([]byte(src)).Bytes()); got != src {
+			t.Errorf("%s: Bytes changed the file:\n%s", name, ini.FormatDiff(ini.Diff([]byte(src), []byte(got)), 1))
+		}
+	}
+	for _, src := range []string{"", "\n", "a=1", "[A]\r\nx=1", "junk\r\n\r\n;c\r\n", "  [ A ]  \n k = v \t\n"} {
+		if got := string(ini.Parse([]byte(src)).Bytes()); got != src {
+			t.Errorf("Bytes(%q) = %q", src, got)
+		}
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	f := ini.Parse([]byte(variants()["crlf"]))
+	for _, tc := range []struct{ section, key, want string }{
+		{"IPCAS2", "NormVNMenu", "N"},
+		{"ONPRT", "PRTYPE", "O"},
+		{"ONPRT", "PRLANG", "V"},
+		{"ONPRT", "PRNAME", "INSOTK"},
+		{"TUXEDO", "fldtbldir32", `C:\TUXEDO\UDATAOBJ;C:\IPCAS2\fmldir`},
+	} {
+		if got, ok := f.Get(tc.section, tc.key); !ok || got != tc.want {
+			t.Errorf("Get(%s, %s) = %q, %v, want %q", tc.section, tc.key, got, ok, tc.want)
+		}
+	}
+
+	f.Set("IPCAS2", "NormVNMenu", "Y")
+	f.Set("ONPRT", "PRTYPE", "S")
+	out := string(f.Bytes())
+	for _, want := range []string{"\r\nNormVNMenu = Y\r\n", "\r\nPRTYPE =S\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("spacing lost, %q missing", want)
+		}
+	}
+}
+
+func TestBOM(t *testing.T) {
+	for _, tc := range []struct{ src, section string }{
+		{"\uFEFF[IPCAS2]\r\nsys_brcd=3611\r\n", "IPCAS2"},
+		{"\uFEFFsys_brcd=3611\r\n[IPCAS2]\r\n", ""},
+	} {
+		src, section := tc.src, tc.section
+		f := ini.Parse([]byte(src))
+		if got := f.Sections()[0]; got != section {
+			t.Errorf("%q: first section %q, want %q", src, got, section)
+		}
+		if v := f.Value(section, "sys_brcd"); v != "3611" {
+			t.Errorf("%q: sys_brcd = %q", src, v)
+		}
+		f.Set(section, "sys_brcd", "3600")
+		if got, want := string(f.Bytes()), strings.Replace(src, "3611", "3600", 1); got != want {
+			t.Errorf("%q: Set wrote %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"[A]\r\nx=1\r\n", "[A]\r\nx=1\r\ny=2\r\n[B]\r\nz=3\r\n"},
+		{"[A]\nx=1\n", "[A]\nx=1\ny=2\n[B]\nz=3\n"},
+		{"[A]\r\nx=1", "[A]\r\nx=1\r\ny=2\r\n[B]\r\nz=3\r\n"},
+		{"[A]\r\n\r\n[C]\r\n", "[A]\r\ny=2\r\n\r\n[C]\r\n[B]\r\nz=3\r\n"},
+	} {
+		f := ini.Parse([]byte(tc.src))
+		f.Set("A", "y", "2")
+		f.Set("B", "z", "3")
+		if got := string(f.Bytes()); got != tc.want {
+			t.Errorf("Set on %q wrote %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	src := "[ipcas2]\nSYS_BRCD=1\nsys_brcd=2\n[Live]\nwsnaddr=a\n[IPCAS2]\nSys_Brcd=3\n"
+	f := ini.Parse([]byte(src))
+
+	if got, want := f.Sections(), []string{"ipcas2", "Live"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sections = %q, want %q", got, want)
+	}
+	if got, want := f.Keys("IPCAS2"), []string{"SYS_BRCD", "sys_brcd", "Sys_Brcd"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys = %q, want %q", got, want)
+	}
+	if v := f.Value("IPCAS2", "Sys_BrCd"); v != "1" {
+		t.Errorf("first occurrence not used: %q", v)
+	}
+	if v := f.Value("LIVE", "WSNADDR"); v != "a" {
+		t.Errorf("case-insensitive lookup = %q", v)
+	}
+
+	f.Set("IPCAS2", "sys_brcd", "9")
+	if got, want := string(f.Bytes()), strings.Replace(src, "SYS_BRCD=1", "SYS_BRCD=9", 1); got != want {
+		t.Errorf("Set wrote %q, want %q", got, want)
+	}
+	if !f.Delete("ipcas2", "SYS_BRCD") || f.Value("IPCAS2", "sys_brcd") != "2" {
+		t.Errorf("Delete did not expose the next occurrence: %q", f.Bytes())
+	}
+}
+
+func TestEditsKeepOtherLines(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		edit     func(f *ini.File) bool
+		old, new string
+	}{
+		{"set", func(f *ini.File) bool { f.Set("ipcas2", "SYS_BRCD", "3600"); return true },
+			"sys_brcd=3611", "sys_brcd=3600"},
+		{"set empty", func(f *ini.File) bool { f.Set("TOKENSETUP", "ACTIVE", ""); return true },
+			"ACTIVE=TOKEN7", "ACTIVE="},
+		{"set new", func(f *ini.File) bool { f.Set("KEBPASSBOOK", "BAUD", "9600"); return true },
+			"PORT=1\n", "PORT=1\nBAUD=9600\n"},
+		{"delete", func(f *ini.File) bool { return f.Delete("LIVE", "wsnaddr") },
+			"[LIVE]\nwsnaddr=//10.0.91.10:10000\n", "[LIVE]\n"},
+		{"disable", func(f *ini.File) bool { return f.Disable("LIVE", "wsnaddr") },
+			"[LIVE]\nwsnaddr=", "[LIVE]\n;wsnaddr="},
+		{"enable", func(f *ini.File) bool { return f.Enable("TEST", "wsnaddr") },
+			"[TEST]\n;wsnaddr=", "[TEST]\nwsnaddr="},
+		{"disable spaced", func(f *ini.File) bool { return f.Disable("ONPRT", "PRTYPE") },
+			"\nPRTYPE =O", "\n;PRTYPE =O"},
+	} {
+		for name, src := range variants() {
+			f := ini.Parse([]byte(src))
+			if !tc.edit(f) {
+				t.Errorf("%s %s: reported no change", tc.name, name)
+				continue
+			}
+			eol := "\n"
+			if name != "lf" {
+				eol = "\r\n"
+			}
+			old := strings.ReplaceAll(tc.old, "\n", eol)
+			want := strings.Replace(src, old, strings.ReplaceAll(tc.new, "\n", eol), 1)
+			if !strings.Contains(src, old) || want == src {
+				t.Fatalf("%s: %q not in template", tc.name, tc.old)
+			}
+			if got := string(f.Bytes()); got != want {
+				t.Errorf("%s %s:\n%s", tc.name, name, ini.FormatDiff(ini.Diff([]byte(want), []byte(got)), 1))
+			}
+		}
+	}
+}
+
+func TestDisableEnable(t *testing.T) {
+	f := ini.Parse([]byte(variants()["crlf"]))
+	if f.Enable("LIVE", "wsnaddr") {
+		t.Error("Enable found an active key")
+	}
+	if !f.Disable("LIVE", "wsnaddr") || f.Disable("LIVE", "wsnaddr") {
+		t.Error("Disable did not report the active key only once")
+	}
+	if _, ok := f.Get("LIVE", "wsnaddr"); ok {
+		t.Error("disabled key still active")
+	}
+	if v, ok := f.Disabled("LIVE", "wsnaddr"); !ok || v != "//10.0.91.10:10000" {
+		t.Errorf("Disabled = %q, %v", v, ok)
+	}
+	if !f.Enable("LIVE", "wsnaddr") || f.Value("LIVE", "wsnaddr") != "//10.0.91.10:10000" {
+		t.Error("Enable did not restore the value")
+	}
+	if got, want := string(f.Bytes()), variants()["crlf"]; got != want {
+		t.Errorf("Disable then Enable changed the file:\n%s", ini.FormatDiff(ini.Diff([]byte(want), []byte(got)), 1))
+	}
+}
@@ -0,0 +1,136 @@
+package ipcasini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"ipcas2-scanner/ini"
+)
+
+// EnvironmentsFile overrides DefaultEnvironments when present
+const EnvironmentsFile = `C:\IPCAS2\environments.json`
+
+// Environment is a Tuxedo server IPCAS2 can be pointed at. Section is the
+// INI section whose wsnaddr is active while the environment is selected.
+type Environment struct {
+	Name    string `json:"name"`
+	Section string `json:"section"`
+	Address string `json:"wsnaddr"`
+}
+
+// DefaultEnvironments are the [TEST] and [LIVE] sections of the template
+var DefaultEnvironments = []Environment{
+	{Name: "LIVE", Section: "LIVE", Address: "//10.0.91.10:10000"},
+	{Name: "TEST", Section: "TEST", Address: "//10.0.91.10:10000"},
+}
+
+// LoadEnvironments reads the environment list from path, returning
+// DefaultEnvironments if the file does not exist
+func LoadEnvironments(path string) ([]Environment, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultEnvironments, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []Environment
+	if err := json.Unmarshal(data, &envs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("%s: no environments", path)
+	}
+	addr := Field{Key: "wsnaddr", Kind: Address}
+	for _, e := range envs {
+		if e.Name == "" || e.Section == "" {
+			return nil, fmt.Errorf("%s: environment needs a name and a section", path)
+		}
+		if e.Address != "" {
+			if err := addr.Check(e.Address); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, e.Name, err)
+			}
+		}
+	}
+	return envs, nil
+}
+
+// FindEnvironment returns the environment called name, ignoring case
+func FindEnvironment(envs []Environment, name string) (Environment, bool) {
+	for _, e := range envs {
+		if strings.EqualFold(e.Name, name) {
+			return e, true
+		}
+	}
+	return Environment{}, false
+}
+
+// CurrentEnvironment returns the environment whose section has an active
+// wsnaddr in the INI at path. The first one in file order wins if several
+// are active; ok is false when none is.
+func CurrentEnvironment(path string, envs []Environment) (env Environment, ok bool, err error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return env, false, err
+	}
+	for _, section := range f.Sections() {
+		for _, e := range envs {
+			if !strings.EqualFold(e.Section, section) {
+				continue
+			}
+			if addr, found := f.Get(section, "wsnaddr"); found {
+				e.Address = addr
+				return e, true, nil
+			}
+		}
+	}
+	return env, false, nil
+}
+
+// PlanEnvironment returns the edit activating the wsnaddr of env and
+// commenting out the wsnaddr of every other environment in envs. The
+// address of env is written when set, otherwise the commented value is
+// reused.
+func PlanEnvironment(path string, env Environment, envs []Environment) (*Edit, error) {
+	if env.Address == "" {
+		f, err := ini.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.Get(env.Section, "wsnaddr"); !ok {
+			if _, ok := f.Disabled(env.Section, "wsnaddr"); !ok {
+				return nil, fmt.Errorf("[%s] has no wsnaddr", env.Section)
+			}
+		}
+	}
+
+	return plan(path, "Chuyển môi trường "+env.Name, func(f *ini.File) {
+		for _, e := range envs {
+			if strings.EqualFold(e.Section, env.Section) {
+				continue
+			}
+			for f.Disable(e.Section, "wsnaddr") {
+			}
+		}
+		if _, ok := f.Get(env.Section, "wsnaddr"); !ok {
+			f.Enable(env.Section, "wsnaddr")
+		}
+		if env.Address != "" {
+			f.Set(env.Section, "wsnaddr", env.Address)
+		}
+	})
+}
+
+// SwitchEnvironment points the INI at path to env
+func SwitchEnvironment(path string, env Environment, envs []Environment) error {
+	e, err := PlanEnvironment(path, env, envs)
+	if err != nil {
+		return err
+	}
+	return e.Apply()
+}
@@ -0,0 +1,190 @@
+package ipcasini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ipcas2-scanner/ini"
+)
+
+// HistoryDir keeps the content of IPCAS2.ini before every write
+var HistoryDir = `C:\IPCAS2\ini_history`
+
+const historyIndex = "history.jsonl"
+
+// Version records one write of the INI. Name is the file in HistoryDir
+// holding the content before the write, empty when the INI was created.
+type Version struct {
+	Name    string          `json:"name"`
+	Time    time.Time       `json:"time"`
+	User    string          `json:"user"`
+	Host    string          `json:"host"`
+	Summary string          `json:"summary"`
+	Changes []ini.KeyChange `json:"changes"`
+}
+
+// Edit is a pending write of the INI at Path. Old is nil when the file does
+// not exist yet.
+type Edit struct {
+	Path    string
+	Summary string
+	Old     []byte
+	New     []byte
+}
+
+// Changed reports whether applying the edit would modify the file
+func (e *Edit) Changed() bool {
+	return e.Old == nil || !bytes.Equal(e.Old, e.New)
+}
+
+// Diff returns the line diff from the current to the proposed content
+func (e *Edit) Diff() []ini.DiffLine {
+	return ini.Diff(e.Old, e.New)
+}
+
+// Changes returns the keys the edit modifies
+func (e *Edit) Changes() []ini.KeyChange {
+	return ini.Changes(ini.Parse(e.Old), ini.Parse(e.New))
+}
+
+// Apply stores the current content in HistoryDir, writes the new content
+// and grants Everyone full control so IPCAS2 can update it without elevation
+func (e *Edit) Apply() error {
+	if !e.Changed() {
+		return nil
+	}
+
+	v := Version{
+		Time:    time.Now(),
+		User:    os.Getenv("USERNAME"),
+		Summary: e.Summary,
+	}
+	v.Host, _ = os.Hostname()
+	// Every key would be listed for a new file
+	if e.Old != nil {
+		v.Changes = e.Changes()
+	}
+
+	if err := os.MkdirAll(HistoryDir, 0755); err != nil {
+		return err
+	}
+	if e.Old != nil {
+		v.Name = "IPCAS2_" + v.Time.Format("20060102_150405") + ".ini"
+		for n := 2; fileExists(filepath.Join(HistoryDir, v.Name)); n++ {
+			v.Name = fmt.Sprintf("IPCAS2_%s_%d.ini", v.Time.Format("20060102_150405"), n)
+		}
+		if err := os.WriteFile(filepath.Join(HistoryDir, v.Name), e.Old, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(e.Path, e.New, 0666); err != nil {
+		// The change never happened, so it must not show up in the history
+		if v.Name != "" {
+			os.Remove(filepath.Join(HistoryDir, v.Name))
+		}
+		return err
+	}
+	exec.Command("icacls", e.Path, "/grant", "Everyone:F").Run()
+	return appendHistory(v)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func appendHistory(v Version) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(HistoryDir, historyIndex), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// History returns the recorded writes, newest first
+func History() ([]Version, error) {
+	f, err := os.Open(filepath.Join(HistoryDir, historyIndex))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var versions []Version
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var v Version
+		if json.Unmarshal(sc.Bytes(), &v) == nil {
+			versions = append(versions, v)
+		}
+	}
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, sc.Err()
+}
+
+// plan loads the INI at path, or Template with DefaultSettings when it is
+// missing, and returns the edit made by change
+func plan(path, summary string, change func(f *ini.File)) (*Edit, error) {
+	old, err := os.ReadFile(path)
+	var f *ini.File
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		old = nil
+		f = ini.Parse([]byte(fmt.Sprintf(Template, DefaultSettings.Branch, DefaultSettings.Token)))
+		for _, t := range Tokens {
+			f.Set("TOKENSETUP", t.ID, t.DLL)
+		}
+	case err != nil:
+		return nil, err
+	default:
+		f = ini.Parse(old)
+	}
+	change(f)
+
+	// A new file gets the printer of the branch it is written for
+	if old == nil {
+		if b, ok := Catalog.Branch(f.Value("IPCAS2", "sys_brcd")); ok && b.Printer != "" {
+			f.Set("ONPRT", "PRNAME", b.Printer)
+		}
+	}
+	return &Edit{Path: path, Summary: summary, Old: old, New: f.Bytes()}, nil
+}
+
+// PlanRevert returns the edit restoring the content saved as name in
+// HistoryDir
+func PlanRevert(path, name string) (*Edit, error) {
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, ".ini") {
+		return nil, fmt.Errorf("invalid version %q", name)
+	}
+	content, err := os.ReadFile(filepath.Join(HistoryDir, name))
+	if err != nil {
+		return nil, err
+	}
+	old, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		old = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &Edit{Path: path, Summary: "Khôi phục " + name, Old: old, New: content}, nil
+}
@@ -0,0 +1,57 @@
+package ipcasini
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func useHistoryDir(t *testing.T) {
+	t.Helper()
+	old := HistoryDir
+	HistoryDir = t.TempDir()
+	t.Cleanup(func() { HistoryDir = old })
+}
+
+func TestApplyRecordsHistory(t *testing.T) {
+	useHistoryDir(t)
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.WriteFile(path, []byte("[IPCAS2]\nsys_brcd=3612\n"), 0644)
+
+	e := &Edit{Path: path, Summary: "test", Old: []byte("[IPCAS2]\nsys_brcd=3612\n"), New: []byte("[IPCAS2]\nsys_brcd=3600\n")}
+	if err := e.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := History()
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("history = %v, err = %v", versions, err)
+	}
+	v := versions[0]
+	if len(v.Changes) != 1 || v.Changes[0].Old != "3612" || v.Changes[0].New != "3600" {
+		t.Errorf("changes = %+v", v.Changes)
+	}
+
+	r, err := PlanRevert(path, v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.New) != "[IPCAS2]\nsys_brcd=3612\n" {
+		t.Errorf("revert content = %q", r.New)
+	}
+}
+
+func TestApplyFailureLeavesNoHistory(t *testing.T) {
+	useHistoryDir(t)
+	// A folder in place of the INI makes the write fail
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.Mkdir(path, 0755)
+
+	e := &Edit{Path: path, Old: []byte("a=1\n"), New: []byte("a=2\n")}
+	if err := e.Apply(); err == nil {
+		t.Fatal("Apply succeeded over a folder")
+	}
+	entries, _ := os.ReadDir(HistoryDir)
+	if len(entries) != 0 {
+		t.Errorf("history has %d entries for a write that failed", len(entries))
+	}
+}
@@ -0,0 +1,178 @@
+package ipcasini
+
+import (
+	"fmt"
+
+	"ipcas2-scanner/catalog"
+	"ipcas2-scanner/ini"
+)
+
+// Path is where IPCAS2 reads its configuration
+const Path = `C:\Windows\IPCAS2.ini`
+
+// Template is the standard IPCAS2.ini with sys_brcd and ACTIVE left as %s
+const Template = `[TUXEDO]
+tuxdir=C:\TUXEDO
+
+eiini=C:\ipcas2\INI
+appdir=C:\ipcas2\Bin
+fldtbldir32=C:\TUXEDO\UDATAOBJ;C:\IPCAS2\fmldir
+fieldtbls32=usysfl32,rcfldtbl.tux,race.fld,keb.fld,tpadm
+ulogpfx=c:\ipcas2\TUXLOG\ulog
+
+[IPCAS2]
+sys_brcd=%s
+UseUnicodeEncoding=Y
+usrflg=ON
+cacheflag=N
+;1:Top, 2:Left, 3:Both
+SHOWMENU=3
+;Y:Yes, N:No, A:Auto
+NormVNMenu = N
+
+[TEST]
+;wsnaddr=//10.0.91.10:10000
+
+[LIVE]
+wsnaddr=//10.0.91.10:10000
+
+[KEBTMP]
+KEBTMP=kebtmp.ini
+
+[KEBMSG]
+KEBMSG=C:\ipcas2\Msg\
+
+[KEBSIGN]
+CMSIGN=C:\ipcas2\sign
+
+[KEBPICTURE]
+PICTURE=U:\
+
+[KEBRPT]
+RPT=C:\ipcas2
+[ONPRT]
+PRT=c:\ipcas2\TEMPLATE\PRINT
+;O = Other, using Windows Printing System, S = Synkey(Raw device), R = Synkey(Generic Device), D = Datawindow, Defaul = O
+
+PRTYPE =O
+;V = Viet Nam, E = English, Defaul = Viet Nam
+;Physical Offset
+PHYOFFX=0.2
+PHYOFFY=0.2
+PRLANG =V
+
+;Printer Name - in case of Windows Printing System
+;Open Print Manager to retrieve Printer Name
+;Network Printer:\\[hostname or ipaddress]\Printer Name(Printer Name on hostname or ipaddress)
+;Local Printer:Printer Name
+PRNAME=INSOTK
+[LANGUAGE]
+LANG=C:\ipcas2\INCLUDE\
+
+[CACHE]
+CACHE=C:\ipcas2\CACHE\
+
+[ONOFFLINE]
+SYS_LONG02=1
+SYS_LONG04=1
+
+[KEBPASSBOOK]
+PORT=1
+
+[TOKENSETUP]
+ACTIVE=%s
+TOKEN1=./SecureMetric_PKI_csp11.dll
+TOKEN2=./eToken.dll
+TOKEN3=./acospkcs11.dll
+TOKEN4=./st3csp11.dll
+TOKEN5=./dkck201.dll
+TOKEN6=./gclib.dll
+TOKEN7=./agribank_csp11_v1.dll
+`
+
+// Settings are the values IPC-Toyz manages in IPCAS2.ini
+type Settings struct {
+	Branch string `json:"sys_brcd"`
+	Token  string `json:"active"`
+}
+
+// Token is a signing token driver selectable in [TOKENSETUP]
+type Token = catalog.Token
+
+// Catalog lists the selectable branches and tokens, see UseCatalog
+var Catalog = catalog.Default()
+
+// BranchCodes are the selectable sys_brcd values
+var BranchCodes = Catalog.Codes()
+
+// Tokens are the token drivers written to [TOKENSETUP]
+var Tokens = Catalog.Tokens
+
+// DefaultSettings are used when no IPCAS2.ini exists yet
+var DefaultSettings = Settings{Branch: Catalog.DefaultBranch, Token: Catalog.DefaultToken}
+
+// UseCatalog replaces the branches and tokens offered for editing
+func UseCatalog(c *catalog.Catalog) {
+	Catalog = c
+	BranchCodes = c.Codes()
+	Tokens = c.Tokens
+	DefaultSettings = Settings{Branch: c.DefaultBranch, Token: c.DefaultToken}
+	for i := range Schema {
+		switch Schema[i].ID() {
+		case "IPCAS2.sys_brcd":
+			Schema[i].Choices = BranchCodes
+		case "TOKENSETUP.ACTIVE":
+			Schema[i].Choices = tokenIDs()
+		}
+	}
+}
+
+// Read returns the sys_brcd and ACTIVE values of the INI at path
+func Read(path string) (Settings, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{
+		Branch: f.Value("IPCAS2", "sys_brcd"),
+		Token:  f.Value("TOKENSETUP", "ACTIVE"),
+	}, nil
+}
+
+// Validate checks the settings against the known branches and tokens
+func (s Settings) Validate() error {
+	found := false
+	for _, b := range BranchCodes {
+		if b == s.Branch {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown sys_brcd %q", s.Branch)
+	}
+	for _, t := range Tokens {
+		if t.ID == s.Token {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token %q", s.Token)
+}
+
+// PlanWrite returns the edit storing s into the INI at path. Only
+// sys_brcd and ACTIVE change so branch-specific keys survive.
+func PlanWrite(path string, s Settings) (*Edit, error) {
+	return plan(path, "Lưu chi nhánh / token", func(f *ini.File) {
+		f.Set("IPCAS2", "sys_brcd", s.Branch)
+		f.Set("TOKENSETUP", "ACTIVE", s.Token)
+	})
+}
+
+// Write stores s into the INI at path
+func Write(path string, s Settings) error {
+	e, err := PlanWrite(path, s)
+	if err != nil {
+		return err
+	}
+	return e.Apply()
+}
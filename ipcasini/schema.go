@@ -0,0 +1,213 @@
+package ipcasini
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ipcas2-scanner/ini"
+)
+
+// Kind is how a field value is entered and checked
+type Kind int
+
+const (
+	Text    Kind = iota // free text
+	Choice              // one of Field.Choices
+	Integer             // whole number
+	Decimal             // number with '.' decimals
+	Dir                 // folder path, not required to exist
+	Address             // Tuxedo workstation address //host:port
+)
+
+// Field describes a known IPCAS2.ini key
+type Field struct {
+	Section string
+	Key     string
+	Label   string
+	Kind    Kind
+	Choices []string
+	// Help repeats the comment the template has for the key, if any
+	Help string
+	// Env marks the wsnaddr of an environment section. Its address can be
+	// edited, but whether it is active only changes through PlanEnvironment
+	// so that a single environment stays selected.
+	Env bool
+}
+
+// ID returns "SECTION.key", used as the map key of Values
+func (f Field) ID() string {
+	return f.Section + "." + f.Key
+}
+
+var addressRe = regexp.MustCompile(`^//[^:/\s]+:\d{1,5}$`)
+
+// Check validates v against the field kind
+func (f Field) Check(v string) error {
+	if strings.ContainsAny(v, "\r\n") {
+		return fmt.Errorf("%s: line breaks are not allowed", f.Key)
+	}
+	switch f.Kind {
+	case Choice:
+		for _, c := range f.Choices {
+			if c == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %q is not one of %s", f.Key, v, strings.Join(f.Choices, ", "))
+	case Integer:
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%s: %q is not a whole number", f.Key, v)
+		}
+	case Decimal:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.Key, v)
+		}
+	case Dir:
+		if v == "" {
+			return fmt.Errorf("%s: path is empty", f.Key)
+		}
+	case Address:
+		if !addressRe.MatchString(v) {
+			return fmt.Errorf("%s: %q is not of the form //host:port", f.Key, v)
+		}
+	}
+	return nil
+}
+
+// Schema lists the keys editable in the full editor, grouped by section in
+// template order
+var Schema = []Field{
+	{Section: "TUXEDO", Key: "tuxdir", Label: "Thư mục Tuxedo", Kind: Dir},
+	{Section: "TUXEDO", Key: "eiini", Label: "Thư mục INI", Kind: Dir},
+	{Section: "TUXEDO", Key: "appdir", Label: "Thư mục chương trình", Kind: Dir},
+	{Section: "TUXEDO", Key: "fldtbldir32", Label: "Thư mục bảng trường", Kind: Text, Help: "Các thư mục cách nhau bởi ';'"},
+	{Section: "TUXEDO", Key: "fieldtbls32", Label: "Bảng trường", Kind: Text, Help: "Các file cách nhau bởi ','"},
+	{Section: "TUXEDO", Key: "ulogpfx", Label: "Tiền tố file log", Kind: Text},
+
+	{Section: "IPCAS2", Key: "sys_brcd", Label: "Mã chi nhánh", Kind: Choice, Choices: BranchCodes},
+	{Section: "IPCAS2", Key: "UseUnicodeEncoding", Label: "Dùng Unicode", Kind: Choice, Choices: []string{"Y", "N"}},
+	{Section: "IPCAS2", Key: "usrflg", Label: "usrflg", Kind: Choice, Choices: []string{"ON", "OFF"}},
+	{Section: "IPCAS2", Key: "cacheflag", Label: "Dùng cache", Kind: Choice, Choices: []string{"Y", "N"}},
+	{Section: "IPCAS2", Key: "SHOWMENU", Label: "Hiện menu", Kind: Choice, Choices: []string{"1", "2", "3"}, Help: "1:Top, 2:Left, 3:Both"},
+	{Section: "IPCAS2", Key: "NormVNMenu", Label: "Menu tiếng Việt", Kind: Choice, Choices: []string{"Y", "N", "A"}, Help: "Y:Yes, N:No, A:Auto"},
+
+	{Section: "TEST", Key: "wsnaddr", Label: "Địa chỉ server TEST", Kind: Address, Env: true, Help: "//10.0.91.10:10000"},
+
+	{Section: "LIVE", Key: "wsnaddr", Label: "Địa chỉ server LIVE", Kind: Address, Env: true, Help: "//10.0.91.10:10000"},
+
+	{Section: "KEBTMP", Key: "KEBTMP", Label: "File tạm", Kind: Text},
+
+	{Section: "KEBMSG", Key: "KEBMSG", Label: "Thư mục Msg", Kind: Dir},
+	{Section: "KEBSIGN", Key: "CMSIGN", Label: "Thư mục chữ ký", Kind: Dir},
+	{Section: "KEBPICTURE", Key: "PICTURE", Label: "Thư mục ảnh", Kind: Dir},
+	{Section: "KEBRPT", Key: "RPT", Label: "Thư mục báo cáo", Kind: Dir},
+
+	{Section: "ONPRT", Key: "PRT", Label: "Thư mục mẫu in", Kind: Dir},
+	{Section: "ONPRT", Key: "PRTYPE", Label: "Kiểu in", Kind: Choice, Choices: []string{"O", "S", "R", "D"},
+		Help: "O = Other, using Windows Printing System, S = Synkey(Raw device), R = Synkey(Generic Device), D = Datawindow, Defaul = O"},
+	{Section: "ONPRT", Key: "PHYOFFX", Label: "Lề in X", Kind: Decimal, Help: "Physical Offset"},
+	{Section: "ONPRT", Key: "PHYOFFY", Label: "Lề in Y", Kind: Decimal, Help: "Physical Offset"},
+	{Section: "ONPRT", Key: "PRLANG", Label: "Ngôn ngữ in", Kind: Choice, Choices: []string{"V", "E"}, Help: "V = Viet Nam, E = English, Defaul = Viet Nam"},
+	{Section: "ONPRT", Key: "PRNAME", Label: "Tên máy in", Kind: Text,
+		Help: `Printer Name - in case of Windows Printing System. Network Printer:\\[hostname or ipaddress]\Printer Name, Local Printer:Printer Name`},
+
+	{Section: "LANGUAGE", Key: "LANG", Label: "Thư mục ngôn ngữ", Kind: Dir},
+
+	{Section: "CACHE", Key: "CACHE", Label: "Thư mục cache", Kind: Dir},
+
+	{Section: "ONOFFLINE", Key: "SYS_LONG02", Label: "SYS_LONG02", Kind: Integer},
+	{Section: "ONOFFLINE", Key: "SYS_LONG04", Label: "SYS_LONG04", Kind: Integer},
+
+	{Section: "KEBPASSBOOK", Key: "PORT", Label: "Cổng máy in sổ", Kind: Integer},
+
+	{Section: "TOKENSETUP", Key: "ACTIVE", Label: "Loại Token", Kind: Choice, Choices: tokenIDs()},
+}
+
+func tokenIDs() []string {
+	var ids []string
+	for _, t := range Tokens {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// Sections returns the sections of Schema in order
+func Sections() []string {
+	var names []string
+	for i, f := range Schema {
+		if i == 0 || Schema[i-1].Section != f.Section {
+			names = append(names, f.Section)
+		}
+	}
+	return names
+}
+
+// Values maps Field.ID to the value of the key
+type Values map[string]string
+
+// Check validates every schema field present in v and returns all errors
+func (v Values) Check() error {
+	var errs []error
+	for _, f := range Schema {
+		if val, ok := v[f.ID()]; ok {
+			if err := f.Check(val); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReadValues returns the schema keys of the INI at path. Keys missing from
+// the file are left out.
+func ReadValues(path string) (Values, error) {
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	v := make(Values)
+	for _, fd := range Schema {
+		if val, ok := f.Get(fd.Section, fd.Key); ok {
+			v[fd.ID()] = val
+		} else if val, ok := f.Disabled(fd.Section, fd.Key); ok && fd.Env {
+			v[fd.ID()] = val
+		}
+	}
+	return v, nil
+}
+
+// PlanValues validates v and returns the edit storing it into the INI at
+// path, leaving keys outside the schema untouched. Environment addresses
+// keep their active or commented state.
+func PlanValues(path string, v Values) (*Edit, error) {
+	if err := v.Check(); err != nil {
+		return nil, err
+	}
+	return plan(path, "Sửa cấu hình", func(f *ini.File) {
+		for _, fd := range Schema {
+			val, ok := v[fd.ID()]
+			if !ok {
+				continue
+			}
+			if _, active := f.Get(fd.Section, fd.Key); fd.Env && !active {
+				f.Enable(fd.Section, fd.Key)
+				f.Set(fd.Section, fd.Key, val)
+				f.Disable(fd.Section, fd.Key)
+				continue
+			}
+			f.Set(fd.Section, fd.Key, val)
+		}
+	})
+}
+
+// WriteValues validates v and stores it into the INI at path
+func WriteValues(path string, v Values) error {
+	e, err := PlanValues(path, v)
+	if err != nil {
+		return err
+	}
+	return e.Apply()
+}
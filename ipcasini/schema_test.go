@@ -0,0 +1,93 @@
+package ipcasini
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ipcas2-scanner/ini"
+)
+
+func TestSchemaCoversTemplate(t *testing.T) {
+	f := ini.Parse([]byte(fmt.Sprintf(Template, "3612", "TOKEN7")))
+	known := map[string]bool{}
+	for _, fd := range Schema {
+		known[strings.ToUpper(fd.ID())] = true
+	}
+	for _, section := range f.Sections() {
+		keys := f.Keys(section)
+		if _, ok := f.Disabled(section, "wsnaddr"); ok {
+			keys = append(keys, "wsnaddr")
+		}
+		for _, key := range keys {
+			// Token driver paths come from the catalog
+			if section == "TOKENSETUP" && strings.HasPrefix(key, "TOKEN") {
+				continue
+			}
+			if !known[strings.ToUpper(section+"."+key)] {
+				t.Errorf("[%s] %s is not in Schema", section, key)
+			}
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	v := Values{
+		"TUXEDO.appdir":        `C:\ipcas2\Bin`,
+		"ONOFFLINE.SYS_LONG02": "1",
+		"LIVE.wsnaddr":         "//10.0.91.10:10000",
+	}
+	if err := v.Check(); err != nil {
+		t.Errorf("valid values rejected: %v", err)
+	}
+	v = Values{
+		"TUXEDO.appdir":        "",
+		"ONOFFLINE.SYS_LONG02": "yes",
+		"TEST.wsnaddr":         "10.0.91.10",
+	}
+	if err := v.Check(); err == nil || strings.Count(err.Error(), "\n") != 2 {
+		t.Errorf("want three errors, got %v", err)
+	}
+}
+
+func TestPlanValuesKeepsActiveEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.WriteFile(path, []byte(fmt.Sprintf(Template, "3612", "TOKEN7")), 0644)
+
+	v, err := ReadValues(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v["TEST.wsnaddr"] != "//10.0.91.10:10000" {
+		t.Errorf("commented TEST wsnaddr read as %q", v["TEST.wsnaddr"])
+	}
+	v["TEST.wsnaddr"] = "//10.0.91.20:10000"
+	v["LIVE.wsnaddr"] = "//10.0.91.30:10000"
+
+	e, err := PlanValues(path, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := ini.Parse(e.New)
+	if _, ok := f.Get("TEST", "wsnaddr"); ok {
+		t.Error("editing the TEST address activated it")
+	}
+	if got, _ := f.Disabled("TEST", "wsnaddr"); got != "//10.0.91.20:10000" {
+		t.Errorf("TEST wsnaddr = %q", got)
+	}
+	if got := f.Value("LIVE", "wsnaddr"); got != "//10.0.91.30:10000" {
+		t.Errorf("LIVE wsnaddr = %q", got)
+	}
+	env, ok, _ := currentIn(t, e.New)
+	if !ok || env.Name != "LIVE" {
+		t.Errorf("active environment = %v, %v", env, ok)
+	}
+}
+
+func currentIn(t *testing.T, data []byte) (Environment, bool, error) {
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.WriteFile(path, data, 0644)
+	return CurrentEnvironment(path, DefaultEnvironments)
+}
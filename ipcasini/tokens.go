@@ -0,0 +1,78 @@
+package ipcasini
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ipcas2-scanner/ini"
+)
+
+// DefaultAppDir is the [TUXEDO] appdir of the template
+const DefaultAppDir = `C:\ipcas2\Bin`
+
+// TokenStatus tells whether the DLL of a token is installed
+type TokenStatus struct {
+	Token
+	// Path is the DLL resolved against appdir
+	Path    string `json:"path"`
+	Present bool   `json:"present"`
+}
+
+// CheckTokens resolves the DLL of every catalog token against the appdir of
+// the INI at path. The DLL listed in [TOKENSETUP] wins over the catalog one.
+// A missing INI is checked with the template values.
+func CheckTokens(path string) []TokenStatus {
+	appDir := DefaultAppDir
+	f, err := ini.Load(path)
+	if err == nil {
+		if dir := f.Value("TUXEDO", "appdir"); dir != "" {
+			appDir = dir
+		}
+	}
+
+	var statuses []TokenStatus
+	for _, t := range Tokens {
+		if f != nil {
+			if dll := f.Value("TOKENSETUP", t.ID); dll != "" {
+				t.DLL = dll
+			}
+		}
+		st := TokenStatus{Token: t}
+		if t.DLL != "" {
+			st.Path = t.DLL
+			if !filepath.IsAbs(st.Path) {
+				st.Path = filepath.Join(appDir, st.Path)
+			}
+			_, err := os.Stat(st.Path)
+			st.Present = err == nil
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// FindStatus returns the status of the token id
+func FindStatus(statuses []TokenStatus, id string) (TokenStatus, bool) {
+	for _, st := range statuses {
+		if strings.EqualFold(st.ID, id) {
+			return st, true
+		}
+	}
+	return TokenStatus{}, false
+}
+
+// SuggestToken picks the token to activate: the default token if its DLL
+// is present, otherwise the first present one. ok is false when no DLL is
+// installed.
+func SuggestToken(statuses []TokenStatus) (Token, bool) {
+	if st, ok := FindStatus(statuses, DefaultSettings.Token); ok && st.Present {
+		return st.Token, true
+	}
+	for _, st := range statuses {
+		if st.Present {
+			return st.Token, true
+		}
+	}
+	return Token{}, false
+}
@@ -1,13 +1,10 @@
 package main
 
 import (
-	"archive/zip"
-	"crypto/md5"
+	"context"
 	"embed"
 	"fmt"
 	"image/color"
-	"io"
-	"io/fs"
 	"net"
 	"os"
 	"os/exec"
@@ -16,7 +13,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -24,15 +20,30 @@ import (
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+
+	"ipcas2-scanner/catalog"
+	"ipcas2-scanner/cleaner"
+	"ipcas2-scanner/cmdout"
+	"ipcas2-scanner/doctor"
+	"ipcas2-scanner/ini"
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/probe"
+	"ipcas2-scanner/quarantine"
+	"ipcas2-scanner/region"
+	"ipcas2-scanner/report"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/shutdown"
+	"ipcas2-scanner/update"
+	"ipcas2-scanner/usage"
 )
 
 //go:embed fonts/segoeui.ttf
 var fontData embed.FS
 
-const FILE_ATTRIBUTE_HIDDEN = 0x02
-
 // Windows 11 Fluent Theme
 type FluentTheme struct {
 	font fyne.Resource
@@ -88,12 +99,8 @@ func (t *FluentTheme) Size(n fyne.ThemeSizeName) float32 {
 	return theme.DefaultTheme().Size(n)
 }
 
-type FileInfo struct {
-	Path string
-	Size int64
-}
 type FileItem struct {
-	info     FileInfo
+	info     scanner.FileInfo
 	selected bool
 }
 
@@ -105,7 +112,7 @@ var (
 	countLbl    *widget.Label
 	sdLabel     *widget.Label
 	scanning    bool
-	stopChan    chan struct{}
+	cancelScan  context.CancelFunc
 	mutex       sync.Mutex
 	hasShutdown bool
 )
@@ -244,59 +251,19 @@ func showUpdateConfirm(title, message string, onBackupUpdate, onUpdateOnly func(
 	d.Show()
 }
 
-func isHidden(path string) bool {
-	p, _ := syscall.UTF16PtrFromString(path)
-	a, _ := syscall.GetFileAttributes(p)
-	return a&FILE_ATTRIBUTE_HIDDEN != 0
-}
-
-func fmtSize(s int64) string {
-	if s >= 1048576 {
-		return fmt.Sprintf("%.1f MB", float64(s)/1048576)
-	}
-	if s >= 1024 {
-		return fmt.Sprintf("%.1f KB", float64(s)/1024)
-	}
-	return fmt.Sprintf("%d B", s)
-}
-
-func scanFiles(stop <-chan struct{}) []FileInfo {
-	var r []FileInfo
-	for _, p := range []string{
-		filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "VirtualStore", "Windows"),
-		filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "VirtualStore"),
-	} {
-		if _, e := os.Stat(p); e != nil {
-			continue
-		}
-		filepath.Walk(p, func(path string, info os.FileInfo, e error) error {
-			select {
-			case <-stop:
-				return filepath.SkipAll
-			default:
-			}
-			if e != nil || info.IsDir() {
-				return nil
-			}
-			if strings.ToLower(info.Name()) == "ipcas2.ini" && isHidden(path) {
-				r = append(r, FileInfo{path, info.Size()})
-			}
-			return nil
-		})
-	}
-	return r
-}
-
-func delFile(path string) error {
-	p, _ := syscall.UTF16PtrFromString(path)
-	a, _ := syscall.GetFileAttributes(p)
-	if a&FILE_ATTRIBUTE_HIDDEN != 0 {
-		syscall.SetFileAttributes(p, a&^FILE_ATTRIBUTE_HIDDEN)
+func main() {
+	purgeQuarantine()
+	catalogErr := loadCatalog()
+
+	// Any argument selects the headless command line mode
+	if len(os.Args) > 1 {
+		attachConsole()
+		if catalogErr != nil {
+			fmt.Fprintln(os.Stderr, "catalog:", catalogErr)
+		}
+		os.Exit(runCLI(os.Args[1:]))
 	}
-	return os.Remove(path)
-}
 
-func main() {
 	os.Setenv("FYNE_SCALE", "1")
 
 	a := app.New()
@@ -310,10 +277,14 @@ func main() {
 	win.Resize(fyne.NewSize(400, 500))
 	win.CenterOnScreen()
 	win.SetContent(buildUI())
+	go runCleanScheduler()
 
 	go func() {
 		time.Sleep(500 * time.Millisecond)
-		if exec.Command("shutdown", "/a").Run() == nil {
+		if catalogErr != nil {
+			showMsg("Lỗi", "catalog.json không hợp lệ, dùng danh mục mặc định:\n"+catalogErr.Error())
+		}
+		if shutdown.Cancel() == nil {
 			hasShutdown = true
 			dialog.ShowInformation("Cảnh báo", "Phát hiện hẹn giờ tắt máy.\nĐã tự động hủy.", win)
 		}
@@ -328,7 +299,15 @@ func buildUI() fyne.CanvasObject {
 	hdr.SetMinSize(fyne.NewSize(0, 42))
 	title := canvas.NewText("IPC-Toyz", color.White)
 	title.TextSize = 16
-	header := container.NewStack(hdr, container.NewCenter(title))
+	envBannerBg = canvas.NewRectangle(color.Transparent)
+	envBannerBg.CornerRadius = 4
+	envBanner = canvas.NewText("", color.White)
+	envBanner.TextSize = 12
+	envBanner.TextStyle = fyne.TextStyle{Bold: true}
+	banner := container.NewStack(envBannerBg, container.NewPadded(envBanner))
+	header := container.NewStack(hdr, container.NewCenter(title),
+		container.NewHBox(layout.NewSpacer(), container.NewCenter(banner), widget.NewLabel("")))
+	refreshEnvBanner()
 
 	// Footer with background
 	ftrBg := canvas.NewRectangle(color.NRGBA{R: 240, G: 240, B: 240, A: 255})
@@ -420,10 +399,251 @@ func buildUI() fyne.CanvasObject {
 	return container.NewBorder(topSection, footer, nil, nil, container.NewPadded(contentStack))
 }
 
+// Quarantine keeps deleted files recoverable for quarantineDays
+var quarantineDir = `C:\IPCAS2\Quarantine`
+var quarantineDays = quarantine.DefaultDays
+var quarantineStore = quarantine.Open(quarantineDir)
+
+// purgeQuarantine drops quarantined files older than quarantineDays
+func purgeQuarantine() {
+	quarantineStore.Purge(time.Duration(quarantineDays) * 24 * time.Hour)
+}
+
+// quarantineJunk routes the junk cleaner through the quarantine store
+func quarantineJunk(item cleaner.Item) error {
+	_, err := quarantineStore.Add(item.Path, item.Reason)
+	return err
+}
+
+// cleanRulesFile overrides the default junk cleaner rules when present
+var cleanRulesFile = `C:\IPCAS2\clean_rules.json`
+
+// lastReports keeps the last report of each operation for export
+var (
+	lastReports   = make(map[report.Kind]*report.Report)
+	lastReportsMu sync.Mutex
+)
+
+// setReport remembers r as the last report of its kind
+func setReport(r *report.Report) {
+	lastReportsMu.Lock()
+	lastReports[r.Kind] = r
+	lastReportsMu.Unlock()
+}
+
+// desktopDir is where exported files are saved
+func desktopDir() string {
+	return filepath.Join(os.Getenv("USERPROFILE"), "Desktop")
+}
+
+// reportButton exports the last report of kind
+func reportButton(label string, kind report.Kind) *widget.Button {
+	return widget.NewButton(label, func() { showExportReport(kind) })
+}
+
+// showExportReport saves the last report of kind to the desktop in the
+// chosen format
+func showExportReport(kind report.Kind) {
+	lastReportsMu.Lock()
+	r := lastReports[kind]
+	lastReportsMu.Unlock()
+	if r == nil {
+		showMsg("Thông báo", "Chưa có báo cáo, hãy thực hiện thao tác trước")
+		return
+	}
+
+	var d *widget.PopUp
+	buttons := container.NewGridWithColumns(len(report.Formats))
+	for _, f := range report.Formats {
+		f := f
+		buttons.Add(widget.NewButton(strings.ToUpper(string(f)), func() {
+			d.Hide()
+			path, err := r.Save(desktopDir(), f)
+			if err != nil {
+				showMsg("Lỗi", "Không ghi được báo cáo:\n"+err.Error())
+				return
+			}
+			showMsg("Thành công", fmt.Sprintf("Đã xuất báo cáo %d file:\n%s", len(r.Entries), path))
+		}))
+	}
+
+	title := canvas.NewText(r.Title, color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+	info := widget.NewLabel(fmt.Sprintf("%s • %d file\nChọn định dạng (lưu ra Desktop):", r.Time.Format("02/01 15:04"), len(r.Entries)))
+	info.Wrapping = fyne.TextWrapWord
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewCenter(title),
+		widget.NewButton("Đóng", func() { d.Hide() }),
+		nil, nil, container.NewVBox(info, buttons),
+	)
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(340, 200))
+	d.Show()
+}
+
+// cleanScheduleFile and cleanLogDir hold the unattended cleanup settings
+// and its per-run reports
+var (
+	cleanScheduleFile = `C:\IPCAS2\clean_schedule.json`
+	cleanLogDir       = `C:\IPCAS2\Logs\clean`
+)
+
+// lastCleanLbl shows the last unattended cleanup in the drive tab
+var lastCleanLbl *widget.Label
+
+// unattendedClean cleans root with the configured rules, saves the report
+// and shows its summary
+func unattendedClean(root, trigger string) (*cleaner.Report, error) {
+	rules, err := cleaner.LoadRules(cleanRulesFile)
+	if err != nil {
+		return nil, err
+	}
+	r := cleaner.Unattended(context.Background(), root, rules, quarantineJunk, trigger)
+	if r.Result != nil {
+		setReport(report.FromClean(r.Result))
+	}
+	_, err = cleaner.SaveReport(cleanLogDir, r)
+	if lastCleanLbl != nil {
+		lastCleanLbl.SetText("Lần dọn gần nhất: " + r.Summary())
+	}
+	return r, err
+}
+
+// runCleanScheduler checks the cleanup schedule every minute while the
+// app is open
+func runCleanScheduler() {
+	last := time.Now()
+	for now := range time.Tick(time.Minute) {
+		sched, err := cleaner.LoadSchedule(cleanScheduleFile)
+		if err == nil && sched.Due(last, now) {
+			unattendedClean(sched.Path, "schedule")
+		}
+		last = now
+	}
+}
+
+// cleanRulesText lists the reasons of the junk cleaner rules
+func cleanRulesText() string {
+	rules, err := cleaner.LoadRules(cleanRulesFile)
+	if err != nil {
+		return "lỗi " + cleanRulesFile
+	}
+	var reasons []string
+	for _, r := range rules.Rules {
+		reasons = append(reasons, r.Reason)
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// showQuarantine lists quarantined files and restores the selected ones
+func showQuarantine() {
+	entries, err := quarantineStore.List()
+	if err != nil {
+		showMsg("Lỗi", "Không đọc được thư mục cách ly:\n"+err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		showMsg("Thông báo", "Thư mục cách ly trống")
+		return
+	}
+
+	// Newest first
+	selected := make([]bool, len(entries))
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, widget.NewCheck("", nil), nil, widget.NewLabel(""))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			e := entries[i]
+			c := o.(*fyne.Container)
+			c.Objects[0].(*widget.Check).SetChecked(selected[i])
+			c.Objects[0].(*widget.Check).OnChanged = func(b bool) { selected[i] = b }
+			p := e.Original
+			if len(p) > 38 {
+				p = "..." + p[len(p)-35:]
+			}
+			c.Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s (%s)", p, e.Quarantined.Format("02/01 15:04")))
+		},
+	)
+
+	var d *widget.PopUp
+	restoreBtn := widget.NewButton("Khôi phục đã chọn", func() {
+		restored := 0
+		var failed []string
+		var done []quarantine.Entry
+		errs := make(map[string]error)
+		for i, e := range entries {
+			if !selected[i] {
+				continue
+			}
+			done = append(done, e)
+			if _, err := quarantineStore.Restore(e.ID); err != nil {
+				errs[e.ID] = err
+				failed = append(failed, filepath.Base(e.Original)+": "+err.Error())
+				continue
+			}
+			restored++
+		}
+		if len(done) > 0 {
+			setReport(report.FromQuarantine(done, errs))
+		}
+		d.Hide()
+		if len(failed) > 0 {
+			showMsg("Lỗi", fmt.Sprintf("Đã khôi phục %d file, lỗi %d file:\n%s", restored, len(failed), strings.Join(failed, "\n")))
+			return
+		}
+		showMsg("Hoàn tất", fmt.Sprintf("Đã khôi phục %d file", restored))
+	})
+	closeBtn := widget.NewButton("Đóng", func() { d.Hide() })
+
+	title := canvas.NewText(fmt.Sprintf("Thư mục cách ly (tự xóa sau %d ngày)", quarantineDays), color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewCenter(title),
+		container.NewGridWithColumns(3, restoreBtn, reportButton("📤 Báo cáo", report.Restore), closeBtn),
+		nil, nil, list,
+	)
+
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(380, 400))
+	d.Show()
+}
+
+// scanRulesFile overrides the default scan rules when present
+var scanRulesFile = `C:\IPCAS2\scan_rules.json`
+
+// scanOptions loads the scan rules for the GUI, CLI and HTTP modes
+func scanOptions() (scanner.Options, error) {
+	rules, err := scanner.LoadRules(scanRulesFile)
+	if err != nil {
+		return scanner.Options{}, err
+	}
+	return scanner.Options{Rules: rules}, nil
+}
+
 func tabScan() fyne.CanvasObject {
 	statusLbl = widget.NewLabel("Sẵn sàng")
 	countLbl = widget.NewLabel("0 file")
 
+	allUsersChk := widget.NewCheck("Tất cả người dùng (cần quyền Admin)", nil)
+
+	// Everything the last scan found and what deleting did, for the report
+	var scanFound []scanner.FileInfo
+	scanRemoved := make(map[string]error)
+
 	fileList = widget.NewList(
 		func() int { return len(files) },
 		func() fyne.CanvasObject {
@@ -441,40 +661,102 @@ func tabScan() fyne.CanvasObject {
 			if len(p) > 38 {
 				p = "..." + p[len(p)-35:]
 			}
-			c.Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s (%s)", p, fmtSize(f.info.Size)))
+			if allUsersChk.Checked && f.info.User != "" {
+				p = "[" + f.info.User + "] " + p
+			}
+			c.Objects[1].(*widget.Label).SetText(fmt.Sprintf("%s (%s)", p, scanner.FormatSize(f.info.Size)))
 		},
 	)
 
 	scanBtn := widget.NewButton("Quét", func() {
+		opts, err := scanOptions()
+		if err != nil {
+			showMsg("Lỗi", "Không đọc được quy tắc quét:\n"+err.Error())
+			return
+		}
+		if allUsersChk.Checked {
+			if !scanner.IsElevated() {
+				showMsg("Cảnh báo", "Cần chạy với quyền Admin\nđể quét tất cả người dùng")
+				return
+			}
+			profiles, err := scanner.Profiles(scanner.UsersRoot())
+			if err != nil {
+				showMsg("Lỗi", "Không đọc được danh sách người dùng:\n"+err.Error())
+				return
+			}
+			opts.Profiles = profiles
+		}
+
 		mutex.Lock()
 		if scanning {
 			mutex.Unlock()
 			return
 		}
 		scanning = true
-		stopChan = make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelScan = cancel
 		mutex.Unlock()
 
 		files = nil
 		fileList.Refresh()
 		statusLbl.SetText("Đang quét...")
-		countLbl.SetText("—")
+		countLbl.SetText("0 file")
+
+		events := make(chan scanner.Event, 64)
+		done := make(chan *scanner.Summary, 1)
+		go func() {
+			sum, _ := scanner.Scan(ctx, opts, events)
+			close(events)
+			done <- sum
+		}()
 
 		go func() {
-			t := time.Now()
-			r := scanFiles(stopChan)
+			// Show files as they are found; counters at most every 100ms
+			var last time.Time
+			for ev := range events {
+				if ev.Found != nil {
+					files = append(files, &FileItem{info: *ev.Found})
+					countLbl.SetText(fmt.Sprintf("%d file", len(files)))
+					fileList.Refresh()
+				}
+				if time.Since(last) > 100*time.Millisecond {
+					last = time.Now()
+					p := ev.Progress
+					statusLbl.SetText(fmt.Sprintf("Đang quét... %d thư mục, %d file, %d lỗi", p.Dirs, p.Files, p.Errors))
+				}
+			}
+
+			sum := <-done
+			scanFound = sum.Files
+			scanRemoved = make(map[string]error)
+			setReport(report.FromScan(scanFound, scanRemoved))
 			mutex.Lock()
 			scanning = false
+			cancelScan = nil
 			mutex.Unlock()
-			files = make([]*FileItem, len(r))
-			for i, f := range r {
-				files[i] = &FileItem{info: f}
+			cancel()
+
+			// Group the list by user
+			sort.SliceStable(files, func(i, j int) bool {
+				return strings.ToLower(files[i].info.User) < strings.ToLower(files[j].info.User)
+			})
+			users := len(sum.ByUser())
+
+			errNote := ""
+			if len(sum.Errors) > 0 {
+				errNote = fmt.Sprintf(", %d thư mục không truy cập được", len(sum.Errors))
 			}
-			if len(files) == 0 {
-				statusLbl.SetText("Không tìm thấy file IPCAS2.ini ẩn")
-				countLbl.SetText("0 file")
+			switch {
+			case sum.Canceled:
+				statusLbl.SetText(fmt.Sprintf("Đã dừng (%d thư mục%s)", sum.Progress.Dirs, errNote))
+			case len(files) == 0:
+				statusLbl.SetText("Không tìm thấy file nào" + errNote)
+			default:
+				statusLbl.SetText(fmt.Sprintf("Hoàn tất (%.1fs%s)", sum.Elapsed.Seconds(), errNote))
+			}
+			if len(opts.Profiles) > 0 {
+				countLbl.SetText(fmt.Sprintf("%d file / %d người dùng", len(files), users))
 			} else {
-				statusLbl.SetText(fmt.Sprintf("Hoàn tất (%.1fs)", time.Since(t).Seconds()))
 				countLbl.SetText(fmt.Sprintf("%d file", len(files)))
 			}
 			fileList.Refresh()
@@ -484,10 +766,9 @@ func tabScan() fyne.CanvasObject {
 	stopBtn := widget.NewButton("Dừng", func() {
 		mutex.Lock()
 		defer mutex.Unlock()
-		if scanning && stopChan != nil {
-			close(stopChan)
-			scanning = false
-			statusLbl.SetText("Đã dừng")
+		if scanning && cancelScan != nil {
+			cancelScan()
+			statusLbl.SetText("Đang dừng...")
 		}
 	})
 
@@ -516,30 +797,33 @@ func tabScan() fyne.CanvasObject {
 			showMsg("Thông báo", "Vui lòng chọn file trước")
 			return
 		}
-		showConfirm("Xác nhận xóa", fmt.Sprintf("Bạn có chắc muốn xóa %d file?", cnt), func() {
+		showConfirm("Xác nhận xóa", fmt.Sprintf("Bạn có chắc muốn xóa %d file?\n(File được chuyển vào thư mục cách ly)", cnt), func() {
 			del := 0
-			for _, f := range files {
-				if f.selected && delFile(f.info.Path) == nil {
-					del++
-				}
-			}
 			var nf []*FileItem
 			for _, f := range files {
-				if !f.selected {
-					nf = append(nf, f)
+				if f.selected {
+					_, err := quarantineStore.Add(f.info.Path, f.info.Rule)
+					scanRemoved[f.info.Path] = err
+					if err == nil {
+						del++
+						continue
+					}
 				}
+				nf = append(nf, f)
 			}
 			files = nf
+			setReport(report.FromScan(scanFound, scanRemoved))
 			countLbl.SetText(fmt.Sprintf("%d file", len(files)))
 			fileList.Refresh()
-			showMsg("Hoàn tất", fmt.Sprintf("Đã xóa %d file thành công", del))
+			showMsg("Hoàn tất", fmt.Sprintf("Đã chuyển %d file vào thư mục cách ly", del))
 		})
 	})
 
 	return container.NewBorder(
 		container.NewVBox(
 			container.NewGridWithColumns(2, scanBtn, stopBtn),
-			container.NewGridWithColumns(2, selBtn, delBtn),
+			allUsersChk,
+			container.NewGridWithColumns(2, selBtn, delBtn, widget.NewButton("Khôi phục", showQuarantine), reportButton("📤 Xuất báo cáo", report.Scan)),
 			container.NewHBox(statusLbl, widget.NewLabel("•"), countLbl),
 		),
 		nil, nil, nil, fileList,
@@ -561,16 +845,20 @@ func tabShutdown() fyne.CanvasObject {
 					showMsg("Lỗi", "Vui lòng nhập số phút hợp lệ")
 					return
 				}
-				exec.Command("shutdown", "/s", "/t", strconv.Itoa(m*60)).Run()
+				at, err := shutdown.Schedule(m)
+				if err != nil {
+					showMsg("Lỗi", "Không thể đặt hẹn giờ: "+err.Error())
+					return
+				}
 				hasShutdown = true
-				sdLabel.SetText("Máy sẽ tắt lúc " + time.Now().Add(time.Duration(m)*time.Minute).Format("15:04"))
+				sdLabel.SetText("Máy sẽ tắt lúc " + at.Format("15:04"))
 			}),
 			widget.NewButton("Hủy hẹn giờ", func() {
 				if !hasShutdown {
 					showMsg("Thông báo", "Chưa có hẹn giờ nào")
 					return
 				}
-				exec.Command("shutdown", "/a").Run()
+				shutdown.Cancel()
 				hasShutdown = false
 				sdLabel.SetText("Đã hủy hẹn giờ")
 			}),
@@ -582,61 +870,129 @@ func tabShutdown() fyne.CanvasObject {
 
 func tabNetwork() fyne.CanvasObject {
 	pathE := widget.NewEntry()
-	pathE.SetPlaceHolder("\\\\192.168.1.x\\shared")
-	driveS := widget.NewSelect([]string{"Z:", "Y:", "X:", "W:", "V:", "U:", "T:"}, nil)
+	pathE.SetPlaceHolder(currentBranch().Picture)
+	driveS := widget.NewSelect(netdrive.Letters, nil)
 	driveS.SetSelected("Z:")
 
 	// Cleanup path entry
 	cleanPathE := widget.NewEntry()
-	cleanPathE.SetPlaceHolder("VD: U:\\ hoặc \\\\10.32.128.12\\Picture")
+	cleanPathE.SetPlaceHolder("VD: U:\\ hoặc " + currentBranch().Picture)
 	cleanPathE.SetText("U:\\")
 
 	cleanStatusLbl := widget.NewLabel("—")
 	cleanStatusLbl.Wrapping = fyne.TextWrapWord
 
-	// List to show mapped drives with details
-	mappedList := widget.NewList(
-		func() int { return 0 },
-		func() fyne.CanvasObject { return widget.NewLabel("") },
-		func(i widget.ListItemID, o fyne.CanvasObject) {},
-	)
+	// Unattended cleanup schedule and its last run
+	sched, err := cleaner.LoadSchedule(cleanScheduleFile)
+	if err != nil {
+		cleanStatusLbl.SetText("Lỗi: " + err.Error())
+	}
+	schedChk := widget.NewCheck("Tự động dọn file rác lúc:", nil)
+	schedChk.SetChecked(sched.Enabled)
+	schedTimesE := widget.NewEntry()
+	schedTimesE.SetPlaceHolder("VD: 12:00, 17:30")
+	schedTimesE.SetText(strings.Join(sched.Times, ", "))
+	schedNextLbl := widget.NewLabel("")
+	showNext := func(s cleaner.Schedule) {
+		if next, ok := s.Next(time.Now()); ok {
+			schedNextLbl.SetText("Lần chạy tới: " + next.Format("15:04 02/01") + " (" + s.Path + ")")
+		} else {
+			schedNextLbl.SetText("Chưa bật dọn tự động")
+		}
+	}
+	showNext(sched)
+	saveSched := func() {
+		times, err := cleaner.ParseTimes(schedTimesE.Text)
+		if err != nil {
+			showMsg("Lỗi", "Giờ không hợp lệ (dạng HH:MM, cách nhau dấu phẩy)")
+			return
+		}
+		sched.Enabled = schedChk.Checked
+		sched.Times = times
+		sched.Path = strings.TrimSpace(cleanPathE.Text)
+		if err := cleaner.SaveSchedule(cleanScheduleFile, sched); err != nil {
+			showMsg("Lỗi", err.Error())
+			return
+		}
+		showNext(sched)
+	}
+	lastCleanLbl = widget.NewLabel("Lần dọn gần nhất: chưa có")
+	lastCleanLbl.Wrapping = fyne.TextWrapWord
+	if r, err := cleaner.LastReport(cleanLogDir); err == nil && r != nil {
+		lastCleanLbl.SetText("Lần dọn gần nhất: " + r.Summary())
+	}
 
-	var mappings []string
-
-	refresh := func() {
-		mappings = nil
-		for _, d := range "ZYXWVUT" {
-			drv := string(d) + ":"
-			out, _ := exec.Command("net", "use", drv).CombinedOutput()
-			outStr := string(out)
-			if strings.Contains(outStr, "\\\\") {
-				// Extract remote path
-				lines := strings.Split(outStr, "\n")
-				for _, line := range lines {
-					if strings.Contains(line, "Remote name") || strings.Contains(line, "Tên từ xa") {
-						parts := strings.SplitN(line, "  ", 2)
-						if len(parts) >= 2 {
-							remotePath := strings.TrimSpace(parts[len(parts)-1])
-							mappings = append(mappings, fmt.Sprintf("%s → %s", drv, remotePath))
-						}
+	// Mapped drives, one row per letter with its actions
+	mappedRows := container.NewVBox()
+
+	var refresh func()
+	refresh = func() {
+		go func() {
+			mappings := netdrive.List()
+			mappedRows.Objects = nil
+			if len(mappings) == 0 {
+				mappedRows.Add(widget.NewLabel("Chưa có ổ mạng nào"))
+			}
+			for _, m := range mappings {
+				m := m
+				reconnect := widget.NewButton("Kết nối lại", func() {
+					if err := netdrive.Reconnect(m); err != nil {
+						showMsg("Lỗi", "Không kết nối lại được "+m.Drive+":\n"+err.Error())
 					}
-				}
-				if len(mappings) == 0 || !strings.HasPrefix(mappings[len(mappings)-1], drv) {
-					// Fallback: just show drive letter
-					mappings = append(mappings, drv+" → (đã kết nối)")
-				}
+					refresh()
+				})
+				disconnect := widget.NewButton("Ngắt", func() {
+					showConfirm("Xác nhận", "Ngắt kết nối "+m.Drive+" → "+m.Remote+"?", func() {
+						if err := netdrive.Unmap(m.Drive); err != nil {
+							showMsg("Lỗi", err.Error())
+						}
+						refresh()
+					})
+				})
+				mappedRows.Add(container.NewBorder(nil, nil,
+					widget.NewLabelWithStyle(driveStatusIcons[m.Status]+" "+m.Drive, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+					container.NewHBox(reconnect, disconnect),
+					container.NewVBox(widget.NewLabel(m.Remote), widget.NewLabel(driveDetail(m))),
+				))
+				mappedRows.Add(widget.NewSeparator())
 			}
-		}
+			mappedRows.Refresh()
+		}()
+	}
+	refresh()
 
-		mappedList.Length = func() int { return len(mappings) }
-		mappedList.UpdateItem = func(i widget.ListItemID, o fyne.CanvasObject) {
-			if i < len(mappings) {
-				o.(*widget.Label).SetText(mappings[i])
+	// Show at most 10 junk files below the summary line
+	junkSummary := func(header string, items []cleaner.Item) string {
+		result := header
+		for i, f := range items {
+			if i >= 10 {
+				result += fmt.Sprintf("... và %d file khác", len(items)-10)
+				break
 			}
+			result += "• " + f.Name + " (" + f.Reason + ": " + f.Why + ")\n"
 		}
-		mappedList.Refresh()
+		return result
+	}
+	// unreadable warns that junk in skipped folders was not looked at
+	unreadable := func(res *cleaner.Result) string {
+		if res.Unreadable == 0 {
+			return ""
+		}
+		return fmt.Sprintf("\n⚠️ %d thư mục/file không đọc được, chưa quét file rác trong đó", res.Unreadable)
+	}
+
+	// The preview keeps its plan so the cleanup removes only files that
+	// were shown. lastPlanMu guards it against the scan goroutines.
+	var lastPlanMu sync.Mutex
+	var lastPlan *cleaner.Plan
+
+	planJunk := func(path string) (*cleaner.Plan, error) {
+		rules, err := cleaner.LoadRules(cleanRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		return cleaner.PlanDir(context.Background(), path, rules)
 	}
-	refresh()
 
 	// Cleanup junk files function
 	cleanupJunk := func() {
@@ -649,78 +1005,36 @@ func tabNetwork() fyne.CanvasObject {
 		cleanStatusLbl.SetText("Đang quét...")
 
 		go func() {
-			today := time.Now().Format("2006-01-02")
-			var deleted, scanned int
-			var deletedFiles []string
-
-			err := filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
-				if err != nil {
-					return nil // Skip errors
-				}
-				if d.IsDir() {
-					return nil
-				}
-
-				scanned++
-				ext := strings.ToLower(filepath.Ext(filePath))
-				name := strings.ToLower(d.Name())
-
-				shouldDelete := false
-				reason := ""
-
-				// Delete .env, .enk files
-				if ext == ".env" || ext == ".enk" {
-					shouldDelete = true
-					reason = "file rác"
-				}
-
-				// Delete .jpg files not modified today
-				if ext == ".jpg" || ext == ".jpeg" {
-					if info, err := d.Info(); err == nil {
-						modDate := info.ModTime().Format("2006-01-02")
-						if modDate != today {
-							shouldDelete = true
-							reason = "ảnh cũ (" + modDate + ")"
-						}
-					}
-				}
-
-				// Also delete common junk files
-				if name == "thumbs.db" || name == "desktop.ini" || ext == ".db" {
-					shouldDelete = true
-					reason = "file hệ thống"
-				}
-
-				if shouldDelete {
-					if os.Remove(filePath) == nil {
-						deleted++
-						// Only keep last 10 for display
-						if len(deletedFiles) < 10 {
-							deletedFiles = append(deletedFiles, fmt.Sprintf("%s (%s)", d.Name(), reason))
-						}
-					}
-				}
-
-				return nil
-			})
+			lastPlanMu.Lock()
+			preview := lastPlan
+			lastPlan = nil
+			lastPlanMu.Unlock()
 
+			// Plan again so retention sees the files as they are now
+			plan, err := planJunk(path)
 			if err != nil {
 				cleanStatusLbl.SetText("Lỗi: " + err.Error())
 				return
 			}
-
-			if deleted == 0 {
-				cleanStatusLbl.SetText(fmt.Sprintf("✅ Đã quét %d file, không có file rác", scanned))
-			} else {
-				result := fmt.Sprintf("🗑️ Đã xóa %d/%d file:\n", deleted, scanned)
-				for _, f := range deletedFiles {
-					result += "• " + f + "\n"
-				}
-				if deleted > 10 {
-					result += fmt.Sprintf("... và %d file khác", deleted-10)
+			changed := ""
+			if preview != nil && preview.Root == path {
+				plan = preview.Recheck(plan)
+				if n := len(preview.Items) - len(plan.Items); n > 0 {
+					changed = fmt.Sprintf("\nℹ️ Giữ lại %d file đã thay đổi hoặc không còn là rác từ lúc quét", n)
 				}
-				cleanStatusLbl.SetText(result)
 			}
+			res := plan.Execute(quarantineJunk)
+			setReport(report.FromClean(res))
+
+			if len(res.Deleted) == 0 && len(res.Failed) == 0 {
+				cleanStatusLbl.SetText(fmt.Sprintf("✅ Đã quét %d file, không có file rác", res.Scanned) + changed + unreadable(res))
+				return
+			}
+			text := junkSummary(fmt.Sprintf("🗑️ Đã chuyển %d/%d file vào cách ly:\n", len(res.Deleted), res.Scanned), res.Deleted)
+			if len(res.Failed) > 0 {
+				text += fmt.Sprintf("\n❌ %d file không chuyển được (đang mở hoặc không có quyền)", len(res.Failed))
+			}
+			cleanStatusLbl.SetText(text + changed + unreadable(res))
 		}()
 	}
 
@@ -735,66 +1049,78 @@ func tabNetwork() fyne.CanvasObject {
 		cleanStatusLbl.SetText("Đang quét...")
 
 		go func() {
-			today := time.Now().Format("2006-01-02")
-			var junkCount, scanned int
-			var junkFiles []string
-
-			filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
-				if err != nil || d.IsDir() {
-					return nil
-				}
-
-				scanned++
-				ext := strings.ToLower(filepath.Ext(filePath))
-				name := strings.ToLower(d.Name())
-
-				isJunk := false
-				reason := ""
-
-				if ext == ".evn" || ext == ".enk" {
-					isJunk = true
-					reason = "file rác"
-				}
-
-				if ext == ".jpg" || ext == ".jpeg" {
-					if info, err := d.Info(); err == nil {
-						modDate := info.ModTime().Format("2006-01-02")
-						if modDate != today {
-							isJunk = true
-							reason = "ảnh cũ"
-						}
-					}
-				}
-
-				if name == "thumbs.db" || name == "desktop.ini" || ext == ".db" {
-					isJunk = true
-					reason = "file hệ thống"
-				}
+			plan, err := planJunk(path)
+			lastPlanMu.Lock()
+			if err != nil {
+				plan = nil
+			}
+			lastPlan = plan
+			lastPlanMu.Unlock()
+			if err != nil {
+				cleanStatusLbl.SetText("Lỗi: " + err.Error())
+				return
+			}
+			res := plan.Execute(nil)
+			setReport(report.FromClean(res))
 
-				if isJunk {
-					junkCount++
-					if len(junkFiles) < 10 {
-						junkFiles = append(junkFiles, fmt.Sprintf("%s (%s)", d.Name(), reason))
-					}
-				}
+			if len(res.Junk) == 0 {
+				cleanStatusLbl.SetText(fmt.Sprintf("✅ Đã quét %d file, không có file rác", res.Scanned) + unreadable(res))
+			} else {
+				cleanStatusLbl.SetText(junkSummary(fmt.Sprintf("⚠️ Tìm thấy %d file rác trong %d file:\n", len(res.Junk), res.Scanned), res.Junk) + unreadable(res))
+			}
+		}()
+	}
 
-				return nil
+	// Disk usage of the Picture share and the IPCAS2 folders, all analyzed
+	// at once; the button stops a running analysis
+	usageStatus := widget.NewLabel("Xem dung lượng theo thư mục, đuôi file, tuổi file và các file lớn nhất")
+	usageStatus.Wrapping = fyne.TextWrapWord
+	usageResults := widget.NewAccordion()
+	var (
+		usageMu   sync.Mutex
+		stopUsage context.CancelFunc
+		usageBtn  *widget.Button
+	)
+	usageBtn = widget.NewButton("📊 Phân tích dung lượng", func() {
+		usageMu.Lock()
+		if stopUsage != nil {
+			stopUsage()
+			usageMu.Unlock()
+			usageStatus.SetText("Đang dừng...")
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stopUsage = cancel
+		usageMu.Unlock()
+
+		roots := usage.Roots()
+		usageBtn.SetText("⏹️ Dừng phân tích")
+		usageStatus.SetText("Đang phân tích " + strings.Join(roots, ", ") + "...")
+		usageResults.Items = nil
+		usageResults.Refresh()
+		go func() {
+			var n int
+			usage.AnalyzeAll(ctx, roots, usage.DefaultTop, func(a *usage.Analysis) {
+				usageMu.Lock()
+				defer usageMu.Unlock()
+				n++
+				usageStatus.SetText(fmt.Sprintf("Đã xong %d/%d thư mục", n, len(roots)))
+				usageResults.Append(widget.NewAccordionItem(usageTitle(a), widget.NewLabelWithStyle(usageText(a), fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})))
 			})
-
-			if junkCount == 0 {
-				cleanStatusLbl.SetText(fmt.Sprintf("✅ Đã quét %d file, không có file rác", scanned))
+			stopped := ctx.Err() != nil
+			cancel()
+
+			usageMu.Lock()
+			stopUsage = nil
+			usageMu.Unlock()
+			usageBtn.SetText("📊 Phân tích dung lượng")
+			if stopped {
+				usageStatus.SetText("Đã dừng, kết quả chỉ gồm các file đã đọc")
 			} else {
-				result := fmt.Sprintf("⚠️ Tìm thấy %d file rác trong %d file:\n", junkCount, scanned)
-				for _, f := range junkFiles {
-					result += "• " + f + "\n"
-				}
-				if junkCount > 10 {
-					result += fmt.Sprintf("... và %d file khác", junkCount-10)
-				}
-				cleanStatusLbl.SetText(result)
+				usageStatus.SetText("Hoàn tất, bấm vào từng thư mục để xem chi tiết")
 			}
 		}()
-	}
+	})
 
 	return container.NewScroll(container.NewVBox(
 		widget.NewLabel("📂 Kết nối ổ mạng"),
@@ -807,16 +1133,18 @@ func tabNetwork() fyne.CanvasObject {
 					showMsg("Lỗi", "Vui lòng nhập đường dẫn mạng")
 					return
 				}
-				out, e := exec.Command("net", "use", driveS.Selected, p, "/persistent:yes").CombinedOutput()
-				if e != nil {
-					showMsg("Lỗi", string(out))
+				if e := netdrive.Map(driveS.Selected, p); e != nil {
+					showMsg("Lỗi", e.Error())
 					return
 				}
 				showMsg("Thành công", "Đã kết nối "+driveS.Selected+" → "+p)
 				refresh()
 			}),
 			widget.NewButton("Ngắt kết nối", func() {
-				exec.Command("net", "use", driveS.Selected, "/delete", "/yes").Run()
+				if e := netdrive.Unmap(driveS.Selected); e != nil {
+					showMsg("Lỗi", e.Error())
+					return
+				}
 				showMsg("Thành công", "Đã ngắt "+driveS.Selected)
 				refresh()
 			}),
@@ -824,33 +1152,135 @@ func tabNetwork() fyne.CanvasObject {
 		widget.NewSeparator(),
 		widget.NewLabel("🗑️ Dọn file rác (Picture)"),
 		widget.NewLabel("Đường dẫn thư mục:"), cleanPathE,
-		widget.NewLabel("Xóa: .env, .enk, Thumbs.db, ảnh .jpg cũ (không phải hôm nay)"),
+		widget.NewLabel("Xóa: "+cleanRulesText()),
 		container.NewGridWithColumns(2,
 			widget.NewButton("🔍 Quét (xem trước)", scanJunk),
 			widget.NewButton("🗑️ Xóa file rác", func() {
-				showConfirm("Xác nhận xóa", "Bạn có chắc muốn xóa tất cả file rác?\n(.evn, .enk, Thumbs.db, ảnh cũ)", cleanupJunk)
+				msg := "Bạn có chắc muốn xóa tất cả file rác?\n(" + cleanRulesText() + ")"
+				lastPlanMu.Lock()
+				p := lastPlan
+				lastPlanMu.Unlock()
+				if p != nil && p.Root == strings.TrimSpace(cleanPathE.Text) {
+					msg = fmt.Sprintf("Xóa %d file rác đã quét (%.1f MB)?", len(p.Items), float64(p.Bytes())/(1<<20))
+				}
+				showConfirm("Xác nhận xóa", msg+"\nFile được chuyển vào thư mục cách ly.", cleanupJunk)
 			}),
 		),
+		container.NewGridWithColumns(2,
+			widget.NewButton("♻️ Khôi phục", showQuarantine),
+			reportButton("📤 Xuất báo cáo", report.Clean),
+		),
 		cleanStatusLbl,
+		container.NewBorder(nil, nil, schedChk, widget.NewButton("💾 Lưu", saveSched), schedTimesE),
+		schedNextLbl,
+		lastCleanLbl,
 		widget.NewSeparator(),
-		widget.NewLabel("Ổ mạng đã kết nối:"),
-		mappedList,
+		widget.NewLabel("📊 Dung lượng Picture và IPCAS2"),
+		usageBtn,
+		usageStatus,
+		usageResults,
+		widget.NewSeparator(),
+		container.NewBorder(nil, nil, nil, widget.NewButton("🔄", refresh), widget.NewLabel("Ổ mạng đã kết nối:")),
+		mappedRows,
 	))
 }
 
-// System Info tab - MAC, Ping, Hostname
-func tabSystemInfo() fyne.CanvasObject {
-	// Colors for UI
-	blueColor := color.NRGBA{R: 0, G: 103, B: 192, A: 255}
-	greenColor := color.NRGBA{R: 0, G: 150, B: 80, A: 255}
+// usageTop is the number of folders and extensions listed per analysis
+const usageTop = 10
 
-	// Helper to create info card
-	makeInfoCard := func(title string, titleColor color.Color) (*canvas.Text, *widget.Label, fyne.CanvasObject) {
-		bg := canvas.NewRectangle(color.White)
-		bg.CornerRadius = 8
+// usageTitle names an analysis in the results with its total
+func usageTitle(a *usage.Analysis) string {
+	switch {
+	case a.Error != "":
+		return "❌ " + a.Root + " — không truy cập được"
+	case a.Stopped:
+		return fmt.Sprintf("⏹️ %s — %s, %d file (chưa xong)", a.Root, scanner.FormatSize(a.Bytes), a.Files)
+	}
+	return fmt.Sprintf("%s — %s, %d file", a.Root, scanner.FormatSize(a.Bytes), a.Files)
+}
 
-		t := canvas.NewText(title, titleColor)
-		t.TextSize = 12
+// usageText lists the subfolders, extensions, ages and largest files of an
+// analysis
+func usageText(a *usage.Analysis) string {
+	if a.Error != "" {
+		return a.Error
+	}
+	var b strings.Builder
+	line := func(name string, g usage.Group) {
+		pct := 0.0
+		if a.Bytes > 0 {
+			pct = float64(g.Bytes) * 100 / float64(a.Bytes)
+		}
+		fmt.Fprintf(&b, "  %-24s %10s %5.1f%% %7d file\n", name, scanner.FormatSize(g.Bytes), pct, g.Files)
+	}
+	groups := func(title string, gs []usage.Group, name func(string) string) {
+		b.WriteString(title + "\n")
+		for i, g := range gs {
+			if i == usageTop {
+				fmt.Fprintf(&b, "  ... và %d mục khác\n", len(gs)-usageTop)
+				break
+			}
+			line(name(g.Name), g)
+		}
+	}
+
+	fmt.Fprintf(&b, "%d thư mục, %d lỗi, %.1fs\n\n", a.Dirs, a.Errors, a.Duration.Seconds())
+	groups("Theo thư mục:", a.Folders, func(n string) string {
+		if n == usage.RootFiles {
+			return "(file ở thư mục gốc)"
+		}
+		return n
+	})
+	groups("\nTheo đuôi file:", a.Extensions, func(n string) string {
+		if n == "" {
+			return "(không có đuôi)"
+		}
+		return n
+	})
+	groups("\nTheo ngày sửa:", a.Ages, func(n string) string { return n })
+	b.WriteString("\nFile lớn nhất:\n")
+	for _, f := range a.Largest {
+		fmt.Fprintf(&b, "  %10s  %s  %s\n", scanner.FormatSize(f.Size), f.ModTime.Format("02/01/2006"), f.Path)
+	}
+	return b.String()
+}
+
+// driveStatusIcons are shown in front of each mapped drive
+var driveStatusIcons = map[string]string{
+	netdrive.StatusOK:           "✅",
+	netdrive.StatusDisconnected: "⚠️",
+	netdrive.StatusUnavailable:  "❌",
+}
+
+// driveDetail describes the status, persistence and provider of m
+func driveDetail(m netdrive.Mapping) string {
+	parts := []string{map[string]string{
+		netdrive.StatusOK:           "Đã kết nối",
+		netdrive.StatusDisconnected: "Mất kết nối",
+		netdrive.StatusUnavailable:  "Không truy cập được",
+	}[m.Status]}
+	if m.Persistent {
+		parts = append(parts, "tự kết nối khi đăng nhập")
+	}
+	if m.Provider != "" {
+		parts = append(parts, m.Provider)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// System Info tab - MAC, Ping, Hostname
+func tabSystemInfo() fyne.CanvasObject {
+	// Colors for UI
+	blueColor := color.NRGBA{R: 0, G: 103, B: 192, A: 255}
+	greenColor := color.NRGBA{R: 0, G: 150, B: 80, A: 255}
+
+	// Helper to create info card
+	makeInfoCard := func(title string, titleColor color.Color) (*canvas.Text, *widget.Label, fyne.CanvasObject) {
+		bg := canvas.NewRectangle(color.White)
+		bg.CornerRadius = 8
+
+		t := canvas.NewText(title, titleColor)
+		t.TextSize = 12
 		t.TextStyle = fyne.TextStyle{Bold: true}
 
 		v := widget.NewLabel("—")
@@ -872,7 +1302,7 @@ func tabSystemInfo() fyne.CanvasObject {
 
 	// Ping result
 	pingEntry := widget.NewEntry()
-	pingEntry.SetPlaceHolder("Nhập IP hoặc hostname (VD: 10.0.91.10)")
+	pingEntry.SetPlaceHolder("IP, hostname hoặc IP:cổng (VD: 10.0.91.10:10000)")
 	pingResult := widget.NewLabel("—")
 	pingResult.Wrapping = fyne.TextWrapWord
 
@@ -937,21 +1367,48 @@ func tabSystemInfo() fyne.CanvasObject {
 			pingResult.SetText("Vui lòng nhập địa chỉ IP hoặc hostname")
 			return
 		}
+		// host:port is checked with a TCP connect, which passes firewalls
+		// that drop ICMP
+		if _, _, err := net.SplitHostPort(strings.TrimPrefix(target, "//")); err == nil {
+			pingResult.SetText("Đang kết nối...")
+			go func() {
+				res := probe.Default.Probe(context.Background(), probe.Target{Name: "TCP", Addr: strings.TrimPrefix(target, "//")})
+				pingResult.SetText(res.String())
+			}()
+			return
+		}
 		pingResult.SetText("Đang ping...")
 
 		go func() {
-			out, err := exec.Command("ping", "-n", "3", target).CombinedOutput()
-			if err != nil {
-				pingResult.SetText("❌ Không thể kết nối: " + target)
+			out, _ := exec.Command("ping", "-n", "3", target).CombinedOutput()
+			st := cmdout.ParsePing(cmdout.Decode(out))
+			if !st.OK() {
+				pingResult.SetText("❌ Không phản hồi: " + target)
 				return
 			}
-			// Parse ping result
-			outStr := string(out)
-			if strings.Contains(outStr, "TTL=") || strings.Contains(outStr, "ttl=") {
-				pingResult.SetText("✅ Ping thành công!\n" + target + " đang hoạt động")
-			} else {
-				pingResult.SetText("❌ Không phản hồi: " + target)
+			pingResult.SetText(fmt.Sprintf("✅ Ping thành công: %s\n%d/%d gói trả lời (mất %.0f%%), thời gian min/tb/max = %d/%d/%d ms",
+				target, st.Received, st.Sent, st.Loss, st.Min.Milliseconds(), st.Avg.Milliseconds(), st.Max.Milliseconds()))
+		}()
+	}
+
+	// Connect to the Tuxedo listener and the update share
+	probeServers := func() {
+		envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+		if err != nil {
+			envs = ipcasini.DefaultEnvironments
+		}
+		targets := probe.Targets(ipcasini.Path, envs, updatePaths().SourcePath())
+		if len(targets) == 0 {
+			pingResult.SetText("Không có wsnaddr trong IPCAS2.ini")
+			return
+		}
+		pingResult.SetText("Đang kết nối...")
+		go func() {
+			var lines []string
+			for _, res := range probe.Default.ProbeAll(context.Background(), targets) {
+				lines = append(lines, res.String())
 			}
+			pingResult.SetText(strings.Join(lines, "\n"))
 		}()
 	}
 
@@ -997,16 +1454,17 @@ func tabSystemInfo() fyne.CanvasObject {
 	}()
 
 	branchEntry := widget.NewEntry()
-	branchEntry.SetPlaceHolder("Mã chi nhánh (VD: 3611)")
-	branchEntry.SetText("3611")
+	branch := currentBranch()
+	branchEntry.SetPlaceHolder("Mã chi nhánh (VD: " + branch.Code + ")")
+	branchEntry.SetText(branch.Code)
 
 	dnsEntry := widget.NewEntry()
 	dnsEntry.SetPlaceHolder("DNS Server (VD: 10.0.58.11)")
-	dnsEntry.SetText("10.0.58.11")
+	dnsEntry.SetText(branch.DNS)
 
 	domainEntry := widget.NewEntry()
 	domainEntry.SetPlaceHolder("Tên domain")
-	domainEntry.SetText("corp.agribank.com.vn")
+	domainEntry.SetText(branch.Domain)
 
 	domainUser := widget.NewEntry()
 	domainUser.SetPlaceHolder("Tài khoản domain (VD: admin)")
@@ -1067,6 +1525,15 @@ func tabSystemInfo() fyne.CanvasObject {
 		suggestedName.SetText("Tên máy đề xuất: " + name)
 	}
 	branchEntry.OnChanged = func(s string) {
+		// Fill DNS and domain of a known branch
+		if b, ok := ipcasini.Catalog.Branch(strings.TrimSpace(s)); ok {
+			if b.DNS != "" {
+				dnsEntry.SetText(b.DNS)
+			}
+			if b.Domain != "" {
+				domainEntry.SetText(b.Domain)
+			}
+		}
 		updateSuggested()
 	}
 	go func() {
@@ -1162,17 +1629,126 @@ func tabSystemInfo() fyne.CanvasObject {
 			})
 	}
 
+	// === NETWORK MONITOR SECTION ===
+	// monitorMu guards the monitor state shared by the button and the
+	// goroutine running the monitor. monitorRun counts starts so a stale
+	// goroutine does not reset a newer run, and monitorDone is closed when
+	// the last run has returned.
+	var monitorMu sync.Mutex
+	var monitor *probe.Monitor
+	var stopMonitor context.CancelFunc
+	var monitorRun int
+	monitorDone := make(chan struct{})
+	close(monitorDone)
+	monitorRows := container.NewVBox()
+	monitorStatus := widget.NewLabel("Chưa chạy")
+	var monitorBtn *widget.Button
+	monitorBtn = widget.NewButton("▶️ Bắt đầu giám sát", func() {
+		monitorMu.Lock()
+		defer monitorMu.Unlock()
+		if stopMonitor != nil {
+			stopMonitor()
+			stopMonitor = nil
+			monitorBtn.SetText("▶️ Bắt đầu giám sát")
+			monitorStatus.SetText("Đã dừng")
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stopMonitor = cancel
+		monitorRun++
+		run, prev, done := monitorRun, monitorDone, make(chan struct{})
+		monitorDone = done
+		monitorBtn.SetText("⏹️ Dừng giám sát")
+		monitorStatus.SetText("Đang tìm máy chủ cần giám sát...")
+		dns := strings.TrimSpace(dnsEntry.Text)
+		go func() {
+			defer close(done)
+			targets, interval, err := monitorTargets(dns)
+			if err != nil {
+				showMsg("Lỗi", "Không đọc được "+monitorFile+":\n"+err.Error())
+			}
+
+			// A stopped run may still be finishing its round
+			<-prev
+			monitorMu.Lock()
+			if ctx.Err() != nil {
+				monitorMu.Unlock()
+				return
+			}
+			if len(targets) == 0 {
+				cancel()
+				if run == monitorRun {
+					stopMonitor = nil
+					monitorBtn.SetText("▶️ Bắt đầu giám sát")
+					monitorStatus.SetText("Không có máy chủ nào để giám sát")
+				}
+				monitorMu.Unlock()
+				return
+			}
+			if monitor == nil {
+				monitor = probe.NewMonitor(targets, interval)
+			} else {
+				monitor.Interval = interval
+				monitor.SetTargets(targets)
+			}
+			m := monitor
+			m.OnChange = notifyLink
+			m.OnRound = func(sts []probe.Status) {
+				renderMonitor(monitorRows, sts)
+				monitorStatus.SetText(fmt.Sprintf("Cập nhật lúc %s, mỗi %s", time.Now().Format("15:04:05"), interval))
+			}
+			monitorMu.Unlock()
+			m.Run(ctx)
+		}()
+	})
+	exportMonitor := func() {
+		monitorMu.Lock()
+		m := monitor
+		monitorMu.Unlock()
+		if m == nil {
+			showMsg("Lỗi", "Chưa có dữ liệu giám sát")
+			return
+		}
+		path := filepath.Join(desktopDir(), "network_"+time.Now().Format("20060102_150405")+".csv")
+		f, err := os.Create(path)
+		if err != nil {
+			showMsg("Lỗi", err.Error())
+			return
+		}
+		err = m.WriteCSV(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			showMsg("Lỗi", err.Error())
+			return
+		}
+		showMsg("Thành công", "Đã xuất lịch sử kết nối:\n"+path)
+	}
+
 	return container.NewScroll(container.NewVBox(
 		widget.NewLabel("📊 Thông tin hệ thống"),
+		widget.NewButton("🩺 Kiểm tra toàn bộ máy", showDoctor),
 		hostnameCard,
 		macCard,
 		ipCard,
 		widget.NewSeparator(),
 		widget.NewLabel("🔍 Kiểm tra kết nối (Ping)"),
 		pingEntry,
-		widget.NewButton("Ping", doPing),
+		container.NewGridWithColumns(2,
+			widget.NewButton("Ping", doPing),
+			widget.NewButton("🔌 Server IPCAS2", probeServers),
+		),
 		pingResult,
 		widget.NewSeparator(),
+		widget.NewLabel("📈 Giám sát kết nối liên tục"),
+		container.NewGridWithColumns(2,
+			monitorBtn,
+			widget.NewButton("💾 Xuất CSV", exportMonitor),
+		),
+		monitorStatus,
+		monitorRows,
+		widget.NewSeparator(),
 		widget.NewLabel("🖥️ Đổi tên máy & Join Domain"),
 		currentNameLbl,
 		currentDomainLbl,
@@ -1195,6 +1771,189 @@ func tabSystemInfo() fyne.CanvasObject {
 	))
 }
 
+// monitorFile lists the targets of the network monitor. Without it the
+// monitor watches the IPCAS2 servers, the DNS server and the gateway.
+var monitorFile = `C:\IPCAS2\monitor.json`
+
+// monitorTargets returns what the network monitor probes and how often
+func monitorTargets(dns string) ([]probe.Target, time.Duration, error) {
+	cfg, err := probe.LoadMonitorConfig(monitorFile)
+	if len(cfg.Targets) > 0 {
+		return cfg.Targets, cfg.Interval(), err
+	}
+
+	envs, envErr := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+	if envErr != nil {
+		envs = ipcasini.DefaultEnvironments
+	}
+	targets := probe.Targets(ipcasini.Path, envs, updatePaths().SourcePath())
+	if dns != "" {
+		targets = append(targets, probe.Target{Name: "DNS " + dns, Addr: net.JoinHostPort(dns, "53")})
+	}
+	if gw, gwErr := probe.DefaultGateway(); gwErr == nil {
+		targets = append(targets, probe.Target{Name: "Gateway " + gw, Addr: gw})
+	}
+	return targets, cfg.Interval(), err
+}
+
+// notifyLink raises a desktop notification when a target goes down or
+// comes back
+func notifyLink(t probe.Target, up bool) {
+	title := "❌ Mất kết nối"
+	if up {
+		title = "✅ Đã kết nối lại"
+	}
+	fyne.CurrentApp().SendNotification(fyne.NewNotification(title, t.Name+" ("+t.Addr+")"))
+}
+
+// renderMonitor shows one row per monitored target with its last latency,
+// loss and a sparkline of the history
+func renderMonitor(rows *fyne.Container, sts []probe.Status) {
+	rows.Objects = nil
+	for _, st := range sts {
+		icon := "✅"
+		if !st.Up {
+			icon = "❌"
+		}
+		detail := "—"
+		if last, ok := st.Last(); ok {
+			if last.OK {
+				detail = fmt.Sprintf("%d ms", last.Latency.Milliseconds())
+			} else {
+				detail = "không phản hồi"
+			}
+			detail += fmt.Sprintf(", mất %.0f%% / %d lần", st.Loss()*100, len(st.Samples))
+		}
+		name := widget.NewLabelWithStyle(icon+" "+st.Name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		rows.Add(container.NewBorder(nil, nil, nil, sparkline(st.Samples), container.NewVBox(name, widget.NewLabel(detail))))
+	}
+	rows.Refresh()
+}
+
+// sparkline draws the latency of the last samples as bars, failures as
+// full height red bars
+func sparkline(samples []probe.Sample) fyne.CanvasObject {
+	const bars, barW, gap, height = 60, 2, 1, 32
+	if len(samples) > bars {
+		samples = samples[len(samples)-bars:]
+	}
+	var max time.Duration
+	for _, s := range samples {
+		if s.OK && s.Latency > max {
+			max = s.Latency
+		}
+	}
+
+	frame := canvas.NewRectangle(color.NRGBA{R: 240, G: 240, B: 240, A: 255})
+	frame.SetMinSize(fyne.NewSize(bars*(barW+gap), height))
+	plot := container.NewWithoutLayout()
+	for i, s := range samples {
+		h := float32(height)
+		bar := canvas.NewRectangle(color.NRGBA{R: 200, G: 50, B: 50, A: 255})
+		if s.OK {
+			bar.FillColor = color.NRGBA{R: 0, G: 150, B: 80, A: 255}
+			h = 2
+			if max > 0 {
+				h += float32(height-2) * float32(s.Latency) / float32(max)
+			}
+		}
+		bar.Resize(fyne.NewSize(barW, h))
+		bar.Move(fyne.NewPos(float32(i*(barW+gap)), height-h))
+		plot.Add(bar)
+	}
+	return container.NewStack(frame, plot)
+}
+
+// doctorChecks returns the workstation audit, quarantining the hidden
+// IPCAS2.ini copies it finds. Only the built-in IPCAS2.ini rule is used so
+// the fix never touches other files of the configured scan rules.
+func doctorChecks() []doctor.Check {
+	env := doctor.System(updatePaths())
+	env.Quarantine = func(path string) error {
+		_, err := quarantineStore.Add(path, "doctor")
+		return err
+	}
+	return doctor.Standard(env)
+}
+
+// statusIcons are shown in front of each doctor result
+var statusIcons = map[doctor.Status]string{doctor.Pass: "✅", doctor.Warn: "⚠️", doctor.Fail: "❌"}
+
+// showDoctor runs every check and lists the results with a fix button
+// where the app can repair the problem
+func showDoctor() {
+	checks := doctorChecks()
+	results := make([]doctor.Result, len(checks))
+
+	summary := widget.NewLabel("Đang kiểm tra...")
+	rows := container.NewVBox()
+
+	var render func()
+	render = func() {
+		rows.Objects = nil
+		pass, warn, fail := 0, 0, 0
+		for i, res := range results {
+			if res.ID == "" {
+				continue
+			}
+			switch res.Status {
+			case doctor.Pass:
+				pass++
+			case doctor.Warn:
+				warn++
+			default:
+				fail++
+			}
+
+			name := widget.NewLabelWithStyle(statusIcons[res.Status]+" "+res.Name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			detail := widget.NewLabel(res.Detail)
+			detail.Wrapping = fyne.TextWrapWord
+			var fixBtn fyne.CanvasObject
+			if res.Fixable && res.Status != doctor.Pass {
+				c := checks[i]
+				idx := i
+				fixBtn = widget.NewButton("Sửa", func() {
+					if err := c.Fix(); err != nil {
+						showMsg("Lỗi", "Không sửa được "+c.Name+":\n"+err.Error())
+					}
+					results[idx] = doctor.RunOne(context.Background(), c)
+					render()
+				})
+			}
+			rows.Add(container.NewBorder(nil, nil, nil, fixBtn, container.NewVBox(name, detail)))
+			rows.Add(widget.NewSeparator())
+		}
+		summary.SetText(fmt.Sprintf("✅ %d   ⚠️ %d   ❌ %d", pass, warn, fail))
+		rows.Refresh()
+	}
+
+	go func() {
+		for i, c := range checks {
+			results[i] = doctor.RunOne(context.Background(), c)
+			render()
+		}
+	}()
+
+	var d *widget.PopUp
+	closeBtn := widget.NewButton("Đóng", func() { d.Hide() })
+
+	title := canvas.NewText("Kiểm tra máy trạm IPCAS2", color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewVBox(container.NewCenter(title), summary),
+		closeBtn,
+		nil, nil, container.NewVScroll(rows),
+	)
+
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(400, 480))
+	d.Show()
+}
+
 func tabAuthor() fyne.CanvasObject {
 	name := canvas.NewText("Phan Tiến", color.NRGBA{R: 0, G: 103, B: 192, A: 255})
 	name.TextSize = 20
@@ -1253,136 +2012,101 @@ func tabAuthor() fyne.CanvasObject {
 	))
 }
 
-const ipcasIniPath = `C:\Windows\IPCAS2.ini`
-const ipcasTemplate = `[TUXEDO]
-tuxdir=C:\TUXEDO
-
-eiini=C:\ipcas2\INI
-appdir=C:\ipcas2\Bin
-fldtbldir32=C:\TUXEDO\UDATAOBJ;C:\IPCAS2\fmldir
-fieldtbls32=usysfl32,rcfldtbl.tux,race.fld,keb.fld,tpadm
-ulogpfx=c:\ipcas2\TUXLOG\ulog
-
-[IPCAS2]
-sys_brcd=%s
-UseUnicodeEncoding=Y
-usrflg=ON
-cacheflag=N
-;1:Top, 2:Left, 3:Both
-SHOWMENU=3
-;Y:Yes, N:No, A:Auto
-NormVNMenu = N
-
-[TEST]
-;wsnaddr=//10.0.91.10:10000
-
-[LIVE]
-wsnaddr=//10.0.91.10:10000
-
-[KEBTMP]
-KEBTMP=kebtmp.ini
-
-[KEBMSG]
-KEBMSG=C:\ipcas2\Msg\
-
-[KEBSIGN]
-CMSIGN=C:\ipcas2\sign
-
-[KEBPICTURE]
-PICTURE=U:\
-
-[KEBRPT]
-RPT=C:\ipcas2
-[ONPRT]
-PRT=c:\ipcas2\TEMPLATE\PRINT
-;O = Other, using Windows Printing System, S = Synkey(Raw device), R = Synkey(Generic Device), D = Datawindow, Defaul = O
-
-PRTYPE =O
-;V = Viet Nam, E = English, Defaul = Viet Nam
-;Physical Offset
-PHYOFFX=0.2
-PHYOFFY=0.2
-PRLANG =V
-
-;Printer Name - in case of Windows Printing System
-;Open Print Manager to retrieve Printer Name
-;Network Printer:\\[hostname or ipaddress]\Printer Name(Printer Name on hostname or ipaddress)
-;Local Printer:Printer Name
-PRNAME=INSOTK
-[LANGUAGE]
-LANG=C:\ipcas2\INCLUDE\
-
-[CACHE]
-CACHE=C:\ipcas2\CACHE\
-
-[ONOFFLINE]
-SYS_LONG02=1
-SYS_LONG04=1
-
-[KEBPASSBOOK]
-PORT=1
-
-[TOKENSETUP]
-ACTIVE=%s
-TOKEN1=./SecureMetric_PKI_csp11.dll
-TOKEN2=./eToken.dll
-TOKEN3=./acospkcs11.dll
-TOKEN4=./st3csp11.dll
-TOKEN5=./dkck201.dll
-TOKEN6=./gclib.dll
-TOKEN7=./agribank_csp11_v1.dll
-`
-
 func tabConfig() fyne.CanvasObject {
 	statusLabel := widget.NewLabel("Đang kiểm tra...")
 
-	// sys_brcd options: 3611-3620 excluding 3615
-	brcdOptions := []string{"3611", "3612", "3613", "3614", "3616", "3617", "3618", "3619", "3620"}
+	brcdOptions := ipcasini.BranchCodes
 	brcdSelect := widget.NewSelect(brcdOptions, nil)
-	brcdSelect.SetSelected("3611")
+	brcdSelect.SetSelected(ipcasini.DefaultSettings.Branch)
+
+	// Token options with descriptions and whether their DLL is installed
+	var tokenOptions []string
+	var tokenStatuses []ipcasini.TokenStatus
+	tokenWarn := widget.NewLabel("")
+	tokenWarn.Wrapping = fyne.TextWrapWord
+	tokenSelect := widget.NewSelect(nil, func(opt string) {
+		st, ok := ipcasini.FindStatus(tokenStatuses, strings.Split(opt, " ")[0])
+		if ok && !st.Present {
+			tokenWarn.SetText("⚠️ Không tìm thấy " + st.Path)
+		} else {
+			tokenWarn.SetText("")
+		}
+	})
+
+	refreshTokens := func() {
+		selected := strings.Split(tokenSelect.Selected, " ")[0]
+		if selected == "" {
+			selected = ipcasini.DefaultSettings.Token
+		}
+		tokenStatuses = ipcasini.CheckTokens(ipcasini.Path)
+		tokenOptions = nil
+		for _, st := range tokenStatuses {
+			mark := " ✅"
+			if !st.Present {
+				mark = " ❌"
+			}
+			tokenOptions = append(tokenOptions, st.String()+mark)
+		}
+		tokenSelect.Options = tokenOptions
+		for _, opt := range tokenOptions {
+			if strings.Split(opt, " ")[0] == selected {
+				tokenSelect.SetSelected(opt)
+			}
+		}
+		tokenSelect.Refresh()
+	}
+	refreshTokens()
+
+	// Select the token whose DLL is installed
+	suggestToken := func() {
+		refreshTokens()
+		t, ok := ipcasini.SuggestToken(tokenStatuses)
+		if !ok {
+			showMsg("Cảnh báo", "Không tìm thấy DLL token nào\ntrong thư mục appdir")
+			return
+		}
+		for _, opt := range tokenOptions {
+			if strings.Split(opt, " ")[0] == t.ID {
+				tokenSelect.SetSelected(opt)
+			}
+		}
+	}
 
-	// Token options with descriptions
-	tokenOptions := []string{
-		"TOKEN1 - SecureMetric PKI",
-		"TOKEN2 - USB Đỏ (eToken)",
-		"TOKEN3 - ACOS",
-		"TOKEN4 - ST3",
-		"TOKEN5 - DKCK",
-		"TOKEN6 - Thẻ PKI Smart Card",
-		"TOKEN7 - USB Đen (Agribank)",
+	envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+	if err != nil {
+		envs = ipcasini.DefaultEnvironments
+	}
+	var envNames []string
+	for _, e := range envs {
+		envNames = append(envNames, e.Name)
 	}
-	tokenSelect := widget.NewSelect(tokenOptions, nil)
-	tokenSelect.SetSelected("TOKEN7 - USB Đen (Agribank)")
+	envSelect := widget.NewSelect(envNames, nil)
 
 	// Read current config
 	readConfig := func() {
-		data, err := os.ReadFile(ipcasIniPath)
+		if env, ok, _ := ipcasini.CurrentEnvironment(ipcasini.Path, envs); ok {
+			envSelect.SetSelected(env.Name)
+		}
+		refreshEnvBanner()
+		refreshTokens()
+
+		cfg, err := ipcasini.Read(ipcasini.Path)
 		if err != nil {
 			statusLabel.SetText("❌ File chưa tồn tại")
 			return
 		}
-		content := string(data)
-
-		// Find sys_brcd
-		for _, line := range strings.Split(content, "\n") {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(strings.ToLower(line), "sys_brcd=") {
-				val := strings.TrimPrefix(line, "sys_brcd=")
-				val = strings.TrimPrefix(val, "SYS_BRCD=")
-				for _, opt := range brcdOptions {
-					if strings.Contains(val, opt) {
-						brcdSelect.SetSelected(opt)
-						break
-					}
-				}
+
+		for _, opt := range brcdOptions {
+			if strings.Contains(cfg.Branch, opt) {
+				brcdSelect.SetSelected(opt)
+				break
 			}
-			if strings.HasPrefix(strings.ToUpper(line), "ACTIVE=") {
-				val := strings.TrimSpace(strings.Split(line, "=")[1])
-				for _, opt := range tokenOptions {
-					if strings.HasPrefix(opt, val) {
-						tokenSelect.SetSelected(opt)
-						break
-					}
+		}
+		if cfg.Token != "" {
+			for _, opt := range tokenOptions {
+				if strings.HasPrefix(opt, cfg.Token) {
+					tokenSelect.SetSelected(opt)
+					break
 				}
 			}
 		}
@@ -1391,30 +2115,43 @@ func tabConfig() fyne.CanvasObject {
 
 	// Save config
 	saveConfig := func() {
-		brcd := brcdSelect.Selected
-		tokenFull := tokenSelect.Selected
-		token := strings.Split(tokenFull, " ")[0]
-
-		content := fmt.Sprintf(ipcasTemplate, brcd, token)
+		cfg := ipcasini.Settings{
+			Branch: brcdSelect.Selected,
+			Token:  strings.Split(tokenSelect.Selected, " ")[0],
+		}
 
-		// Write file
-		err := os.WriteFile(ipcasIniPath, []byte(content), 0666)
+		e, err := ipcasini.PlanWrite(ipcasini.Path, cfg)
 		if err != nil {
-			// Try with elevated - create in temp first
-			showMsg("Lỗi", "Không thể ghi file. Chạy với quyền Admin!")
+			showMsg("Lỗi", "Không đọc được IPCAS2.ini:\n"+err.Error())
 			return
 		}
+		if st, ok := ipcasini.FindStatus(tokenStatuses, cfg.Token); ok && !st.Present {
+			showConfirm("Cảnh báo", "Không tìm thấy DLL của "+st.ID+":\n"+st.Path+"\nIPCAS2 sẽ không ký được. Vẫn lưu?", func() {
+				confirmINIEdit(e, "Đã lưu cấu hình IPCAS2.ini", readConfig)
+			})
+			return
+		}
+		confirmINIEdit(e, "Đã lưu cấu hình IPCAS2.ini", readConfig)
+	}
 
-		// Set full permissions
-		exec.Command("icacls", ipcasIniPath, "/grant", "Everyone:F").Run()
-
-		showMsg("Thành công", "Đã lưu cấu hình IPCAS2.ini")
-		readConfig()
+	// Point IPCAS2 at another Tuxedo server
+	switchEnv := func() {
+		env, ok := ipcasini.FindEnvironment(envs, envSelect.Selected)
+		if !ok {
+			showMsg("Lỗi", "Chưa chọn môi trường")
+			return
+		}
+		e, err := ipcasini.PlanEnvironment(ipcasini.Path, env, envs)
+		if err != nil {
+			showMsg("Lỗi", "Không thể chuyển môi trường:\n"+err.Error())
+			return
+		}
+		confirmINIEdit(e, "Đã chuyển sang "+env.Name+"\nKhởi động lại IPCAS2 để áp dụng", readConfig)
 	}
 
 	// Create file if not exists
 	createFile := func() {
-		if _, err := os.Stat(ipcasIniPath); err == nil {
+		if _, err := os.Stat(ipcasini.Path); err == nil {
 			showMsg("Thông báo", "File đã tồn tại")
 			return
 		}
@@ -1494,13 +2231,20 @@ func tabConfig() fyne.CanvasObject {
 		widget.NewLabel("Mã chi nhánh (sys_brcd):"),
 		brcdSelect,
 		widget.NewLabel("Loại Token (ACTIVE):"),
-		tokenSelect,
+		container.NewBorder(nil, nil, nil, widget.NewButton("💡 Gợi ý", suggestToken), tokenSelect),
+		tokenWarn,
+		widget.NewLabel("Môi trường (wsnaddr):"),
+		container.NewBorder(nil, nil, nil, widget.NewButton("🔀 Chuyển", switchEnv), envSelect),
 		widget.NewSeparator(),
 		container.NewGridWithColumns(2,
 			widget.NewButton("💾 Lưu cấu hình", saveConfig),
 			widget.NewButton("📄 Tạo file mới", createFile),
 		),
-		widget.NewButton("🔄 Tải lại", func() { readConfig() }),
+		container.NewGridWithColumns(2,
+			widget.NewButton("🔄 Tải lại", func() { readConfig() }),
+			widget.NewButton("📝 Sửa toàn bộ", func() { showINIEditor(readConfig) }),
+		),
+		widget.NewButton("🕘 Lịch sử thay đổi", func() { showINIHistory(readConfig) }),
 		widget.NewSeparator(),
 		widget.NewLabel("🔧 Tiện ích IPCAS2:"),
 		container.NewGridWithColumns(2,
@@ -1511,6 +2255,232 @@ func tabConfig() fyne.CanvasObject {
 	)
 }
 
+// Header banner showing which Tuxedo environment IPCAS2.ini points at
+var (
+	envBanner   *canvas.Text
+	envBannerBg *canvas.Rectangle
+)
+
+// refreshEnvBanner re-reads the active environment into the header
+func refreshEnvBanner() {
+	envs, err := ipcasini.LoadEnvironments(ipcasini.EnvironmentsFile)
+	if err != nil {
+		envs = ipcasini.DefaultEnvironments
+	}
+	env, ok, err := ipcasini.CurrentEnvironment(ipcasini.Path, envs)
+
+	bg := color.NRGBA{R: 220, G: 160, B: 0, A: 255} // Yellow
+	switch {
+	case err != nil || !ok:
+		envBanner.Text = "⚠ Chưa chọn môi trường"
+		bg = color.NRGBA{R: 200, G: 50, B: 50, A: 255}
+	case strings.EqualFold(env.Name, "LIVE"):
+		envBanner.Text = "● " + env.Name
+		bg = color.NRGBA{R: 0, G: 150, B: 80, A: 255}
+	default:
+		envBanner.Text = "● " + env.Name + " " + strings.TrimPrefix(env.Address, "//")
+	}
+	envBannerBg.FillColor = bg
+	envBanner.Refresh()
+	envBannerBg.Refresh()
+}
+
+// showINIEditor opens a form for every key of ipcasini.Schema, one
+// section per accordion item. onSaved runs after a successful write.
+func showINIEditor(onSaved func()) {
+	values, err := ipcasini.ReadValues(ipcasini.Path)
+	if err != nil && !os.IsNotExist(err) {
+		showMsg("Lỗi", "Không đọc được IPCAS2.ini:\n"+err.Error())
+		return
+	}
+	if values == nil {
+		values = ipcasini.Values{}
+	}
+
+	// Each field reads its current widget value back
+	getters := make(map[string]func() string)
+	accordion := widget.NewAccordion()
+	for _, section := range ipcasini.Sections() {
+		form := widget.NewForm()
+		for _, f := range ipcasini.Schema {
+			if f.Section != section {
+				continue
+			}
+			var input fyne.CanvasObject
+			if f.Kind == ipcasini.Choice {
+				sel := widget.NewSelect(f.Choices, nil)
+				sel.SetSelected(values[f.ID()])
+				getters[f.ID()] = func() string { return sel.Selected }
+				input = sel
+			} else {
+				entry := widget.NewEntry()
+				entry.SetText(values[f.ID()])
+				field := f
+				entry.Validator = field.Check
+				getters[f.ID()] = func() string { return strings.TrimSpace(entry.Text) }
+				input = entry
+			}
+			item := widget.NewFormItem(f.Label, input)
+			item.HintText = f.Key
+			if f.Help != "" {
+				item.HintText += " — " + f.Help
+			}
+			if f.Env {
+				item.HintText += " — bật/tắt bằng nút chuyển môi trường"
+			}
+			form.AppendItem(item)
+		}
+		accordion.Append(widget.NewAccordionItem("["+section+"]", form))
+	}
+	accordion.Open(0)
+
+	var d *widget.PopUp
+	saveBtn := widget.NewButton("💾 Lưu", func() {
+		edited := ipcasini.Values{}
+		for id, get := range getters {
+			// Leave keys the file does not have and the user did not fill
+			if v := get(); v != "" || values[id] != "" {
+				edited[id] = v
+			}
+		}
+		e, err := ipcasini.PlanValues(ipcasini.Path, edited)
+		if err != nil {
+			showMsg("Lỗi", "Giá trị không hợp lệ:\n"+err.Error())
+			return
+		}
+		d.Hide()
+		confirmINIEdit(e, "Đã lưu cấu hình IPCAS2.ini", onSaved)
+	})
+	closeBtn := widget.NewButton("Đóng", func() { d.Hide() })
+
+	title := canvas.NewText("IPCAS2.ini", color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewCenter(title),
+		container.NewGridWithColumns(2, saveBtn, closeBtn),
+		nil, nil, container.NewVScroll(accordion),
+	)
+
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(400, 480))
+	d.Show()
+}
+
+// confirmINIEdit shows the diff of e and applies it once confirmed. done is
+// the success message; onApplied runs after the write.
+func confirmINIEdit(e *ipcasini.Edit, done string, onApplied func()) {
+	if !e.Changed() {
+		showMsg("Thông báo", "Không có thay đổi")
+		return
+	}
+
+	diff := widget.NewLabel(ini.FormatDiff(e.Diff(), 1))
+	diff.TextStyle = fyne.TextStyle{Monospace: true}
+
+	var d *widget.PopUp
+	applyBtn := widget.NewButton("💾 Ghi", func() {
+		d.Hide()
+		if err := e.Apply(); err != nil {
+			showMsg("Lỗi", "Không thể ghi file. Chạy với quyền Admin!")
+			return
+		}
+		showMsg("Thành công", done)
+		onApplied()
+	})
+	cancelBtn := widget.NewButton("Hủy", func() { d.Hide() })
+
+	title := canvas.NewText("Thay đổi IPCAS2.ini: "+e.Summary, color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewCenter(title),
+		container.NewGridWithColumns(2, applyBtn, cancelBtn),
+		nil, nil, container.NewScroll(diff),
+	)
+
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(420, 400))
+	d.Show()
+}
+
+// showINIHistory lists the recorded INI writes and reverts to the content
+// saved before the selected one
+func showINIHistory(onReverted func()) {
+	versions, err := ipcasini.History()
+	if err != nil {
+		showMsg("Lỗi", "Không đọc được lịch sử:\n"+err.Error())
+		return
+	}
+	if len(versions) == 0 {
+		showMsg("Thông báo", "Chưa có lịch sử thay đổi")
+		return
+	}
+
+	selected := -1
+	detail := widget.NewLabel("Chọn một lần thay đổi")
+	detail.Wrapping = fyne.TextWrapWord
+
+	list := widget.NewList(
+		func() int { return len(versions) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			v := versions[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %s  %s", v.Time.Format("02/01 15:04"), v.User, v.Summary))
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+		v := versions[i]
+		lines := []string{fmt.Sprintf("%s • %s@%s", v.Time.Format("02/01/2006 15:04:05"), v.User, v.Host)}
+		for _, c := range v.Changes {
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s → %s", c.Section, c.Key, c.Old, c.New))
+		}
+		if v.Name == "" {
+			lines = append(lines, "Tạo file mới (không có bản trước)")
+		}
+		detail.SetText(strings.Join(lines, "\n"))
+	}
+
+	var d *widget.PopUp
+	revertBtn := widget.NewButton("↩ Khôi phục bản trước", func() {
+		if selected < 0 || versions[selected].Name == "" {
+			showMsg("Thông báo", "Chọn lần thay đổi có bản trước")
+			return
+		}
+		e, err := ipcasini.PlanRevert(ipcasini.Path, versions[selected].Name)
+		if err != nil {
+			showMsg("Lỗi", "Không đọc được phiên bản:\n"+err.Error())
+			return
+		}
+		d.Hide()
+		confirmINIEdit(e, "Đã khôi phục IPCAS2.ini", onReverted)
+	})
+	closeBtn := widget.NewButton("Đóng", func() { d.Hide() })
+
+	title := canvas.NewText("Lịch sử IPCAS2.ini", color.NRGBA{R: 0, G: 103, B: 192, A: 255})
+	title.TextSize = 14
+	title.Alignment = fyne.TextAlignCenter
+
+	bg := canvas.NewRectangle(color.White)
+	bg.CornerRadius = 8
+	content := container.NewBorder(
+		container.NewCenter(title),
+		container.NewVBox(detail, container.NewGridWithColumns(2, revertBtn, closeBtn)),
+		nil, nil, list,
+	)
+
+	d = widget.NewPopUp(container.NewStack(bg, container.NewPadded(content)), win.Canvas())
+	d.Resize(fyne.NewSize(420, 440))
+	d.Show()
+}
+
 func tabRegion() fyne.CanvasObject {
 	statusLabel := widget.NewLabel("Kiểm tra cài đặt Region...")
 
@@ -1521,31 +2491,15 @@ func tabRegion() fyne.CanvasObject {
 
 	// Read current settings from registry
 	readCurrentSettings := func() {
-		// Read sShortDate
-		out, _ := exec.Command("reg", "query", `HKCU\Control Panel\International`, "/v", "sShortDate").CombinedOutput()
-		if strings.Contains(string(out), "sShortDate") {
-			parts := strings.Fields(string(out))
-			if len(parts) >= 3 {
-				currentDate.SetText("Định dạng ngày: " + parts[len(parts)-1])
-			}
+		cur := region.Read()
+		if cur.ShortDate != "" {
+			currentDate.SetText("Định dạng ngày: " + cur.ShortDate)
 		}
-
-		// Read sDecimal
-		out, _ = exec.Command("reg", "query", `HKCU\Control Panel\International`, "/v", "sDecimal").CombinedOutput()
-		if strings.Contains(string(out), "sDecimal") {
-			parts := strings.Fields(string(out))
-			if len(parts) >= 3 {
-				currentDecimal.SetText("Dấu thập phân: " + parts[len(parts)-1])
-			}
+		if cur.Decimal != "" {
+			currentDecimal.SetText("Dấu thập phân: " + cur.Decimal)
 		}
-
-		// Read sThousand
-		out, _ = exec.Command("reg", "query", `HKCU\Control Panel\International`, "/v", "sThousand").CombinedOutput()
-		if strings.Contains(string(out), "sThousand") {
-			parts := strings.Fields(string(out))
-			if len(parts) >= 3 {
-				currentGroup.SetText("Dấu phân cách nghìn: " + parts[len(parts)-1])
-			}
+		if cur.Thousand != "" {
+			currentGroup.SetText("Dấu phân cách nghìn: " + cur.Thousand)
 		}
 
 		statusLabel.SetText("✅ Đã đọc cài đặt hiện tại")
@@ -1553,23 +2507,14 @@ func tabRegion() fyne.CanvasObject {
 
 	// Apply Vietnam/IPCAS standard format
 	applyFormat := func() {
-		// Set registry values for IPCAS2 compatible format
-		regCommands := [][]string{
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "sShortDate", "/t", "REG_SZ", "/d", "dd/MM/yyyy", "/f"},
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "sLongDate", "/t", "REG_SZ", "/d", "dddd, d MMMM yyyy", "/f"},
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "sDecimal", "/t", "REG_SZ", "/d", ".", "/f"},
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "sThousand", "/t", "REG_SZ", "/d", ",", "/f"},
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "iDate", "/t", "REG_SZ", "/d", "1", "/f"},
-			{"reg", "add", `HKCU\Control Panel\International`, "/v", "sDate", "/t", "REG_SZ", "/d", "/", "/f"},
-		}
-
-		for _, args := range regCommands {
-			cmd := exec.Command(args[0], args[1:]...)
-			cmd.Run()
-		}
+		err := region.ApplyIPCAS2()
 
 		readCurrentSettings()
 
+		if err != nil {
+			showMsg("Lỗi", "Không thể cập nhật Region Format:\n"+err.Error())
+			return
+		}
 		showMsg("Thành công", "Đã cập nhật Region Format.\nCần restart máy để IPCAS2 hoạt động đúng.")
 	}
 
@@ -1599,23 +2544,67 @@ func tabRegion() fyne.CanvasObject {
 	)
 }
 
+// catalogFile lists the branches and tokens, see catalog.Default
+var catalogFile = `C:\IPCAS2\catalog.json`
+
+// loadCatalog applies catalogFile to the INI lists and the update source.
+// The built-in catalog stays in use when the file is invalid.
+func loadCatalog() error {
+	c, err := catalog.Load(catalogFile)
+	if err != nil {
+		return err
+	}
+	ipcasini.UseCatalog(c)
+	if b := currentBranch(); b.UpdateSource != "" {
+		updateSourcePath = b.UpdateSource
+	}
+	return nil
+}
+
+// currentBranch returns the catalog entry of the sys_brcd in IPCAS2.ini,
+// or of the default branch
+func currentBranch() catalog.Branch {
+	code := ipcasini.Catalog.DefaultBranch
+	if cfg, err := ipcasini.Read(ipcasini.Path); err == nil && cfg.Branch != "" {
+		code = cfg.Branch
+	}
+	if b, ok := ipcasini.Catalog.Branch(code); ok {
+		return b
+	}
+	b, _ := ipcasini.Catalog.Branch(ipcasini.Catalog.DefaultBranch)
+	return b
+}
+
 // Update configuration
 var updateSourcePath = `\\10.32.128.12\IPCAS2\Bin`
 var updateTargetPath = `C:\IPCAS2\Bin`
 var updateBackupDir = `C:\IPCAS2\Backup`
 var updateConfigFile = `C:\IPCAS2\update_config.txt`
+var updateStateFile = `C:\IPCAS2\update_installed.json`
+var updateKeyFile = `C:\IPCAS2\update_key.pub`
+
+// updatePaths bundles the update configuration for the CLI and HTTP modes
+func updatePaths() update.Paths {
+	return update.Paths{
+		Source:     updateSourcePath,
+		Target:     updateTargetPath,
+		BackupDir:  updateBackupDir,
+		ConfigFile: updateConfigFile,
+		StateFile:  updateStateFile,
+		KeyFile:    updateKeyFile,
+	}
+}
 
 func tabUpdate() fyne.CanvasObject {
 	// Load saved config
-	if data, err := os.ReadFile(updateConfigFile); err == nil {
-		updateSourcePath = strings.TrimSpace(string(data))
-	}
+	updateSourcePath = update.LoadSourcePath(updateConfigFile, updateSourcePath)
 
 	sourceEntry := widget.NewEntry()
 	sourceEntry.SetText(updateSourcePath)
 	sourceEntry.SetPlaceHolder(`\\server\IPCAS2\Bin`)
 
 	statusLabel := widget.NewLabel("Sẵn sàng")
+	versionLabel := widget.NewLabel("Đang cài: — • Mới nhất: —")
 	progressBar := widget.NewProgressBar()
 	progressBar.Hide()
 
@@ -1636,15 +2625,7 @@ func tabUpdate() fyne.CanvasObject {
 
 	// Refresh backup list
 	refreshBackups := func() {
-		var backups []string
-		if entries, err := os.ReadDir(updateBackupDir); err == nil {
-			for _, e := range entries {
-				if strings.HasPrefix(e.Name(), "BK_") && strings.HasSuffix(e.Name(), ".zip") {
-					backups = append(backups, e.Name())
-				}
-			}
-		}
-		sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+		backups := update.ListBackups(updateBackupDir)
 		backupList.Options = backups
 		if len(backups) > 0 {
 			backupList.SetSelected(backups[0])
@@ -1654,119 +2635,57 @@ func tabUpdate() fyne.CanvasObject {
 
 	// Create backup
 	createBackup := func() error {
-		os.MkdirAll(updateBackupDir, 0755)
-
-		backupName := fmt.Sprintf("BK_%s.zip", time.Now().Format("20060102_150405"))
-		backupPath := filepath.Join(updateBackupDir, backupName)
-
-		addLog("Đang tạo backup: " + backupName)
-
-		zipFile, err := os.Create(backupPath)
+		addLog("Đang tạo backup...")
+		name, pruned, err := update.Backup(updateTargetPath, updateBackupDir, update.ReadInstalled(updateStateFile).Version)
 		if err != nil {
 			return err
 		}
-		defer zipFile.Close()
-
-		w := zip.NewWriter(zipFile)
-		defer w.Close()
-
-		filepath.WalkDir(updateTargetPath, func(path string, d fs.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return nil
-			}
-			relPath, _ := filepath.Rel(updateTargetPath, path)
-			f, err := w.Create(relPath)
-			if err != nil {
-				return nil
-			}
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			f.Write(data)
-			return nil
-		})
-
-		// Clean old backups (keep max 3)
-		entries, _ := os.ReadDir(updateBackupDir)
-		var bkFiles []string
-		for _, e := range entries {
-			if strings.HasPrefix(e.Name(), "BK_") && strings.HasSuffix(e.Name(), ".zip") {
-				bkFiles = append(bkFiles, e.Name())
-			}
-		}
-		sort.Sort(sort.Reverse(sort.StringSlice(bkFiles)))
-		for i := 3; i < len(bkFiles); i++ {
-			os.Remove(filepath.Join(updateBackupDir, bkFiles[i]))
-			addLog("Xóa backup cũ: " + bkFiles[i])
+		for _, p := range pruned {
+			addLog("Xóa backup cũ: " + p)
 		}
-
-		addLog("Backup hoàn tất: " + backupName)
+		addLog("Backup hoàn tất: " + name)
 		return nil
 	}
 
-	// Calculate MD5 hash of file
-	fileHash := func(path string) string {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return ""
+	// Load the release manifest from the share and diff it against local files
+	getFilesToUpdate := func() (*update.Manifest, []update.Change, error) {
+		m, files, published, err := update.Check(updateSourcePath, updateTargetPath, updateKeyFile)
+		if err == nil && !published {
+			addLog("Server chưa có " + update.ManifestName + ", đã băm toàn bộ thư mục nguồn")
 		}
-		return fmt.Sprintf("%x", md5.Sum(data))
+		if key, kerr := update.LoadKey(updateKeyFile); kerr != nil {
+			addLog("Bỏ qua " + catalog.FileName + ": " + kerr.Error())
+		} else if changed, err := catalog.Fetch(updateSourcePath, catalogFile, key); err != nil {
+			addLog("Bỏ qua " + catalog.FileName + ": " + err.Error())
+		} else if changed {
+			loadCatalog()
+			addLog("Đã cập nhật danh mục chi nhánh/token (" + catalog.FileName + ")")
+		}
+		return m, files, err
 	}
 
-	// Compare and get files to update (with accurate hash comparison)
-	getFilesToUpdate := func() ([]string, error) {
-		var toUpdate []string
-		var mu sync.Mutex
-
-		err := filepath.WalkDir(updateSourcePath, func(path string, d fs.DirEntry, err error) error {
-			if err != nil || d.IsDir() {
-				return nil
-			}
-
-			relPath, _ := filepath.Rel(updateSourcePath, path)
-			targetFile := filepath.Join(updateTargetPath, relPath)
-
-			srcInfo, _ := d.Info()
-			tgtInfo, tgtErr := os.Stat(targetFile)
-
-			needUpdate := false
-			if tgtErr != nil {
-				needUpdate = true // Target doesn't exist
-			} else if srcInfo.Size() != tgtInfo.Size() {
-				needUpdate = true // Size different
-			} else {
-				// Same size - compare hash for accuracy
-				srcHash := fileHash(path)
-				tgtHash := fileHash(targetFile)
-				if srcHash != "" && tgtHash != "" && srcHash != tgtHash {
-					needUpdate = true // Content different
-				}
-			}
-
-			if needUpdate {
-				mu.Lock()
-				toUpdate = append(toUpdate, relPath)
-				mu.Unlock()
-			}
-			return nil
-		})
-
-		return toUpdate, err
+	// Show installed vs available version
+	showVersions := func(m *update.Manifest) {
+		installed := update.ReadInstalled(updateStateFile).Version
+		if installed == "" {
+			installed = "không rõ"
+		}
+		available := "không rõ"
+		if m != nil && m.Version != "" {
+			available = m.Version
+		}
+		versionLabel.SetText(fmt.Sprintf("Đang cài: %s • Mới nhất: %s", installed, available))
 	}
 
 	// Kill IPCAS2 process
 	killIPCAS := func() {
-		exec.Command("taskkill", "/F", "/IM", "ipcas2.exe").Run()
+		update.StopIPCAS()
 		addLog("Đã tắt ipcas2.exe")
-		time.Sleep(500 * time.Millisecond)
 	}
 
 	// Launch IPCAS2
 	launchIPCAS := func() {
-		exe := filepath.Join(updateTargetPath, "ipcas2.exe")
-		if _, err := os.Stat(exe); err == nil {
-			exec.Command("cmd", "/C", "start", "", exe).Start()
+		if update.StartIPCAS(updateTargetPath) {
 			addLog("Đã mở ipcas2.exe")
 		}
 	}
@@ -1774,8 +2693,7 @@ func tabUpdate() fyne.CanvasObject {
 	// Save config
 	saveConfig := func() {
 		updateSourcePath = sourceEntry.Text
-		os.MkdirAll(filepath.Dir(updateConfigFile), 0755)
-		os.WriteFile(updateConfigFile, []byte(updateSourcePath), 0644)
+		update.SaveSourcePath(updateConfigFile, updateSourcePath)
 		addLog("Đã lưu cấu hình")
 	}
 
@@ -1790,7 +2708,7 @@ func tabUpdate() fyne.CanvasObject {
 
 		// Run file check in background to avoid freezing
 		go func() {
-			files, err := getFilesToUpdate()
+			m, files, err := getFilesToUpdate()
 
 			progressBar.Hide()
 
@@ -1799,6 +2717,7 @@ func tabUpdate() fyne.CanvasObject {
 				statusLabel.SetText("Lỗi kết nối")
 				return
 			}
+			showVersions(m)
 
 			if len(files) == 0 {
 				addLog("Không có file cần cập nhật")
@@ -1808,50 +2727,81 @@ func tabUpdate() fyne.CanvasObject {
 
 			addLog(fmt.Sprintf("Cần cập nhật %d file", len(files)))
 
-			// Inner function to perform file updates
-			performFilesUpdate := func() {
-				killIPCAS()
-
+			// Backup, stage, swap and record the version exactly like the
+			// CLI does
+			performFilesUpdate := func(backup bool) {
+				if backup {
+					addLog("Đang tạo backup trước khi cập nhật...")
+					statusLabel.SetText("Đang backup...")
+				}
 				progressBar.Show()
 				progressBar.SetValue(0)
 				startTime := time.Now()
 
-				for i, relPath := range files {
-					srcFile := filepath.Join(updateSourcePath, relPath)
-					dstFile := filepath.Join(updateTargetPath, relPath)
-
-					os.MkdirAll(filepath.Dir(dstFile), 0755)
-
-					data, err := os.ReadFile(srcFile)
-					if err != nil {
-						addLog("Lỗi đọc: " + relPath)
-						continue
-					}
+				name, res, err := update.Install(m, files, update.Options{
+					SourceDir: updateSourcePath,
+					Progress: func(phase string, done, total int, path string) {
+						// Staging is the slow half (copy over WAN), swapping is quick
+						progress := float64(done) / float64(total) / 2
+						if phase == "swap" {
+							progress += 0.5
+						}
+						progressBar.SetValue(progress)
 
-					if err := os.WriteFile(dstFile, data, 0644); err != nil {
-						addLog("Lỗi ghi: " + relPath)
-						continue
-					}
+						elapsed := time.Since(startTime)
+						remaining := time.Duration(float64(elapsed) / progress * (1 - progress))
+						statusLabel.SetText(fmt.Sprintf("Đang cập nhật... %d/%d (còn ~%s)", done, total, remaining.Round(time.Second)))
+					},
+				}, updatePaths(), backup)
 
-					addLog("Cập nhật: " + relPath)
+				progressBar.SetValue(1)
+				progressBar.Hide()
 
-					progress := float64(i+1) / float64(len(files))
-					progressBar.SetValue(progress)
+				// A failed backup stops before anything is touched
+				if res == nil {
+					addLog("Lỗi: " + err.Error())
+					statusLabel.SetText("❌ Backup thất bại, chưa cập nhật")
+					showMsg("Lỗi", "Backup thất bại, chưa cập nhật file nào:\n"+err.Error())
+					return
+				}
+				if name != "" {
+					addLog("Backup hoàn tất: " + name)
+					refreshBackups()
+				}
+				setReport(report.FromUpdate(files, res))
 
-					elapsed := time.Since(startTime)
-					remaining := time.Duration(float64(elapsed) / progress * (1 - progress))
-					statusLabel.SetText(fmt.Sprintf("Đang cập nhật... %d/%d (còn ~%s)", i+1, len(files), remaining.Round(time.Second)))
+				for _, p := range res.Updated {
+					addLog("Cập nhật: " + p)
+				}
+				for _, f := range res.Failed {
+					addLog("Lỗi: " + f.Path + " - " + f.Error)
+				}
+				for _, p := range res.RolledBack {
+					addLog("Khôi phục: " + p)
 				}
 
-				progressBar.SetValue(1)
-				progressBar.Hide()
+				if err != nil && res.Staging != "" {
+					// The only copy of some replaced files is in staging/old
+					old := filepath.Join(res.Staging, "old")
+					addLog("Lỗi: " + err.Error())
+					addLog("Bản gốc chưa khôi phục được nằm trong " + old)
+					statusLabel.SetText("❌ Cập nhật thất bại, cần khôi phục thủ công")
+					showMsg("Lỗi", fmt.Sprintf("Cập nhật thất bại và chưa khôi phục hết file cũ.\nBản gốc đang nằm trong:\n%s\n\nHãy chép các file này về %s rồi xóa thư mục trên trước khi cập nhật lại.", old, updateTargetPath))
+					return
+				}
+				if err != nil {
+					addLog(fmt.Sprintf("Cập nhật thất bại, đã khôi phục %d file", len(res.RolledBack)))
+					statusLabel.SetText("❌ Cập nhật thất bại")
+					launchIPCAS()
+					showMsg("Lỗi", fmt.Sprintf("Cập nhật thất bại: %d lỗi\nĐã khôi phục %d file về bản cũ", len(res.Failed), len(res.RolledBack)))
+					return
+				}
 
-				addLog(fmt.Sprintf("Hoàn tất cập nhật %d file trong %s", len(files), time.Since(startTime).Round(time.Second)))
+				addLog(fmt.Sprintf("Hoàn tất cập nhật %d file (bỏ qua %d) trong %s", len(res.Updated), len(res.Skipped), time.Since(startTime).Round(time.Second)))
 				statusLabel.SetText("Cập nhật hoàn tất!")
-
-				refreshBackups()
+				showVersions(m)
 				launchIPCAS()
-				showMsg("Hoàn tất", fmt.Sprintf("Đã cập nhật %d file", len(files)))
+				showMsg("Hoàn tất", fmt.Sprintf("Đã cập nhật %d file", len(res.Updated)))
 			}
 
 			// Show dialog with 3 options
@@ -1860,20 +2810,12 @@ func tabUpdate() fyne.CanvasObject {
 				fmt.Sprintf("Có %d file cần cập nhật.\nBạn muốn backup trước không?\n(Giới hạn 3 bản backup)", len(files)),
 				func() {
 					// Option 1: Backup then Update
-					addLog("Đang tạo backup trước khi cập nhật...")
-					statusLabel.SetText("Đang backup...")
-					if err := createBackup(); err != nil {
-						addLog("Lỗi backup: " + err.Error())
-					} else {
-						addLog("Backup hoàn tất")
-						refreshBackups()
-					}
-					performFilesUpdate()
+					performFilesUpdate(true)
 				},
 				func() {
 					// Option 2: Update without backup
 					addLog("Cập nhật không backup theo yêu cầu người dùng")
-					performFilesUpdate()
+					performFilesUpdate(false)
 				},
 			)
 		}() // Close goroutine
@@ -1891,37 +2833,21 @@ func tabUpdate() fyne.CanvasObject {
 
 		killIPCAS()
 
-		// Open zip
-		r, err := zip.OpenReader(backupPath)
+		progressBar.Show()
+		restored, errs, err := update.Restore(backupPath, updateTargetPath, func(done, total int) {
+			progressBar.SetValue(float64(done) / float64(total))
+		})
 		if err != nil {
+			progressBar.Hide()
 			addLog("Lỗi mở backup: " + err.Error())
 			return
 		}
-		defer r.Close()
-
-		progressBar.Show()
-		total := len(r.File)
-
-		for i, f := range r.File {
-			dstPath := filepath.Join(updateTargetPath, f.Name)
-			os.MkdirAll(filepath.Dir(dstPath), 0755)
-
-			rc, err := f.Open()
-			if err != nil {
-				addLog("Lỗi mở file: " + f.Name)
-				continue
-			}
-			data, err := io.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				addLog("Lỗi đọc file: " + f.Name)
-				continue
-			}
-
-			os.WriteFile(dstPath, data, 0644)
-			addLog("Restore: " + f.Name)
-
-			progressBar.SetValue(float64(i+1) / float64(total))
+		setReport(report.FromBackup(backupList.Selected, restored, errs))
+		for _, f := range errs {
+			addLog("Lỗi restore: " + f.Path + " - " + f.Error)
+		}
+		for _, f := range restored {
+			addLog("Restore: " + f)
 		}
 
 		progressBar.Hide()
@@ -1940,7 +2866,7 @@ func tabUpdate() fyne.CanvasObject {
 		progressBar.SetValue(0)
 
 		go func() {
-			files, err := getFilesToUpdate()
+			m, files, err := getFilesToUpdate()
 
 			// Update UI from main thread context
 			progressBar.Hide()
@@ -1950,6 +2876,7 @@ func tabUpdate() fyne.CanvasObject {
 				statusLabel.SetText("Lỗi kết nối")
 				return
 			}
+			showVersions(m)
 
 			if len(files) == 0 {
 				addLog("Không có file cần cập nhật")
@@ -1962,7 +2889,7 @@ func tabUpdate() fyne.CanvasObject {
 						addLog(fmt.Sprintf("  ... và %d file khác", len(files)-10))
 						break
 					}
-					addLog("  - " + f)
+					addLog("  - " + f.Path)
 				}
 				statusLabel.SetText(fmt.Sprintf("⚠️ Có %d file cần cập nhật", len(files)))
 			}
@@ -1973,6 +2900,7 @@ func tabUpdate() fyne.CanvasObject {
 	go func() {
 		time.Sleep(300 * time.Millisecond)
 		refreshBackups()
+		showVersions(nil)
 	}()
 
 	return container.NewBorder(
@@ -1987,6 +2915,7 @@ func tabUpdate() fyne.CanvasObject {
 			),
 			progressBar,
 			statusLabel,
+			versionLabel,
 			widget.NewSeparator(),
 			widget.NewLabel("Backup & Restore:"),
 			backupList,
@@ -2001,6 +2930,10 @@ func tabUpdate() fyne.CanvasObject {
 				}),
 				widget.NewButton("Restore", doRestore),
 			),
+			container.NewGridWithColumns(2,
+				reportButton("📤 Báo cáo cập nhật", report.Update),
+				reportButton("📤 Báo cáo restore", report.Restore),
+			),
 			widget.NewSeparator(),
 			widget.NewLabel("Log:"),
 		),
@@ -0,0 +1,175 @@
+package netdrive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"ipcas2-scanner/cmdout"
+)
+
+// Letters are the drive letters offered for mapping
+var Letters = []string{"Z:", "Y:", "X:", "W:", "V:", "U:", "T:"}
+
+// Status of a mapped drive
+const (
+	StatusOK           = cmdout.StateOK
+	StatusDisconnected = cmdout.StateDisconnected
+	StatusUnavailable  = cmdout.StateUnavailable
+)
+
+// run executes a command and returns its combined output, replaced in tests
+var run = func(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// Mapping is a drive letter connected to a network share
+type Mapping struct {
+	Drive      string `json:"drive"`
+	Remote     string `json:"remote"`
+	Status     string `json:"status,omitempty"`
+	Persistent bool   `json:"persistent"`
+	Provider   string `json:"provider,omitempty"`
+}
+
+// listCIM asks WMI for the network connections of the user as JSON, which
+// does not depend on the Windows language
+const listCIM = `ConvertTo-Json -Compress -InputObject @(Get-CimInstance Win32_NetworkConnection | ` +
+	`Where-Object LocalName | Select-Object LocalName,RemoteName,ConnectionState,Persistent,ProviderName)`
+
+// List returns every drive letter mapped to a network share, sorted by
+// letter. It reads WMI and falls back to net use, which cannot tell
+// whether a mapping is persistent.
+func List() []Mapping {
+	out, err := exec.Command("powershell", "-NoProfile", "-Command", listCIM).Output()
+	mappings, perr := parseCIM([]byte(cmdout.Decode(out)))
+	if err != nil || perr != nil {
+		out, _ = run("net", "use")
+		mappings = parseNetUse(cmdout.Decode(out))
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Drive < mappings[j].Drive })
+	return mappings
+}
+
+// Find returns the mapping of drive
+func Find(mappings []Mapping, drive string) (Mapping, bool) {
+	for _, m := range mappings {
+		if strings.EqualFold(m.Drive, drive) {
+			return m, true
+		}
+	}
+	return Mapping{}, false
+}
+
+// parseCIM reads the output of listCIM
+func parseCIM(out []byte) ([]Mapping, error) {
+	var conns []struct {
+		LocalName       string
+		RemoteName      string
+		ConnectionState string
+		Persistent      bool
+		ProviderName    string
+	}
+	if err := json.Unmarshal(out, &conns); err != nil {
+		return nil, err
+	}
+	var mappings []Mapping
+	for _, c := range conns {
+		status := StatusUnavailable
+		switch c.ConnectionState {
+		case "Connected":
+			status = StatusOK
+		case "Disconnected":
+			status = StatusDisconnected
+		}
+		mappings = append(mappings, Mapping{
+			Drive:      strings.ToUpper(c.LocalName),
+			Remote:     c.RemoteName,
+			Status:     status,
+			Persistent: c.Persistent,
+			Provider:   c.ProviderName,
+		})
+	}
+	return mappings, nil
+}
+
+// parseNetUse keeps the drive rows of net use
+func parseNetUse(out string) []Mapping {
+	var mappings []Mapping
+	for _, u := range cmdout.ParseNetUse(out) {
+		if u.Local == "" {
+			continue
+		}
+		mappings = append(mappings, Mapping{Drive: u.Local, Remote: u.Remote, Status: u.State(), Provider: u.Network})
+	}
+	return mappings
+}
+
+// netUse runs net use with args, returning its message as the error
+func netUse(args ...string) error {
+	out, err := run("net", append([]string{"use"}, args...)...)
+	if err != nil {
+		return errors.New(strings.TrimSpace(cmdout.Decode(out)))
+	}
+	return nil
+}
+
+// Map connects drive to the share at remote persistently
+func Map(drive, remote string) error {
+	return netUse(drive, remote, "/persistent:yes")
+}
+
+// Reconnect maps m again, keeping its persistence. The share is connected
+// without a drive letter first, so a share that cannot be reached leaves
+// the old mapping in place instead of removing it.
+func Reconnect(m Mapping) error {
+	if !deviceless(m.Remote) {
+		if err := netUse(m.Remote); err != nil {
+			return err
+		}
+		defer netUse(m.Remote, "/delete", "/yes")
+	}
+
+	Unmap(m.Drive)
+	persistent := "/persistent:no"
+	if m.Persistent {
+		persistent = "/persistent:yes"
+	}
+	if err := netUse(m.Drive, m.Remote, persistent); err != nil {
+		return err
+	}
+	return verify(m.Drive, m.Remote)
+}
+
+// deviceless reports whether remote is already connected without a drive
+// letter, e.g. opened in Explorer, and must not be disconnected afterwards
+func deviceless(remote string) bool {
+	out, _ := run("net", "use")
+	for _, u := range cmdout.ParseNetUse(cmdout.Decode(out)) {
+		if u.Local == "" && strings.EqualFold(u.Remote, remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks with net use X: that drive is connected to remote
+func verify(drive, remote string) error {
+	out, _ := run("net", "use", drive)
+	u, ok := cmdout.ParseNetUseDrive(cmdout.Decode(out))
+	if !ok || !strings.EqualFold(u.Remote, remote) {
+		return fmt.Errorf("%s is not mapped to %s", drive, remote)
+	}
+	if u.State() != StatusOK {
+		return fmt.Errorf("%s: %s", drive, u.Status)
+	}
+	return nil
+}
+
+// Unmap disconnects drive
+func Unmap(drive string) error {
+	return netUse(drive, "/delete", "/yes")
+}
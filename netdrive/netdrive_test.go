@@ -0,0 +1,114 @@
+package netdrive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ipcas2-scanner/cmdout"
+)
+
+const remote = `\\10.32.128.12\IPCAS2`
+
+// fakeNet replaces run with a net.exe that answers from outputs, keyed by
+// the arguments after "net", and fails for the keys in fail
+func fakeNet(t *testing.T, outputs map[string]string, fail ...string) *[]string {
+	t.Helper()
+	var calls []string
+	old := run
+	run = func(name string, args ...string) ([]byte, error) {
+		key := strings.Join(args, " ")
+		calls = append(calls, key)
+		for _, f := range fail {
+			if key == f {
+				return []byte("System error 53 has occurred.\r\n\r\nThe network path was not found.\r\n"), errors.New("exit status 2")
+			}
+		}
+		return []byte(outputs[key]), nil
+	}
+	t.Cleanup(func() { run = old })
+	return &calls
+}
+
+const driveZ = "Local name        Z:\r\n" +
+	"Remote name       " + remote + "\r\n" +
+	"Resource type     Disk\r\n" +
+	"Status            OK\r\n" +
+	"The command completed successfully.\r\n"
+
+func TestReconnect(t *testing.T) {
+	calls := fakeNet(t, map[string]string{"use Z:": driveZ})
+	if err := Reconnect(Mapping{Drive: "Z:", Remote: remote, Persistent: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"use",
+		"use " + remote,
+		"use Z: /delete /yes",
+		"use Z: " + remote + " /persistent:yes",
+		"use Z:",
+		"use " + remote + " /delete /yes",
+	}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("calls = %q, want %q", *calls, want)
+	}
+}
+
+func TestReconnectUnreachableKeepsMapping(t *testing.T) {
+	calls := fakeNet(t, nil, "use "+remote)
+	err := Reconnect(Mapping{Drive: "Z:", Remote: remote})
+	if err == nil || !strings.Contains(err.Error(), "network path was not found") {
+		t.Fatalf("err = %v", err)
+	}
+	for _, c := range *calls {
+		if strings.HasPrefix(c, "use Z:") {
+			t.Errorf("drive touched although the share is unreachable: %q", c)
+		}
+	}
+}
+
+func TestReconnectKeepsDevicelessConnection(t *testing.T) {
+	list := "Status       Local     Remote                    Network\r\n" +
+		"-------------------------------------------------------------------------------\r\n" +
+		"OK                     " + remote + "     Microsoft Windows Network\r\n"
+	calls := fakeNet(t, map[string]string{"use": list, "use Z:": driveZ})
+	if err := Reconnect(Mapping{Drive: "Z:", Remote: remote}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range *calls {
+		if strings.HasPrefix(c, "use "+remote) {
+			t.Errorf("existing connection touched: %q", c)
+		}
+	}
+}
+
+func TestReconnectVerifies(t *testing.T) {
+	fakeNet(t, map[string]string{"use Z:": strings.Replace(driveZ, "Status            OK", "Status            Disconnected", 1)})
+	if err := Reconnect(Mapping{Drive: "Z:", Remote: remote}); err == nil {
+		t.Error("disconnected drive accepted")
+	}
+
+	fakeNet(t, map[string]string{"use Z:": "The network connection could not be found.\r\n"})
+	if err := Reconnect(Mapping{Drive: "Z:", Remote: remote}); err == nil {
+		t.Error("missing drive accepted")
+	}
+}
+
+func TestParseNetUseVietnamese(t *testing.T) {
+	// net use on Vietnamese Windows writes in code page 1258
+	data, err := os.ReadFile(filepath.Join("..", "cmdout", "testdata", "netuse_vi.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range parseNetUse(cmdout.DecodeCodePage(data, 1258)) {
+		got = append(got, m.Drive+" "+m.Status)
+	}
+	want := []string{"U: OK", "Z: Disconnected", "Y: Unavailable"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,237 @@
+package probe
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sample is one probe of a target by the monitor
+type Sample struct {
+	Time    time.Time     `json:"time"`
+	OK      bool          `json:"ok"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Status is the rolling state of a monitored target
+type Status struct {
+	Target
+	Up      bool     `json:"up"`
+	Samples []Sample `json:"samples"` // oldest first
+}
+
+// Loss returns the share of failed samples, 0 to 1
+func (s Status) Loss() float64 {
+	if len(s.Samples) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, smp := range s.Samples {
+		if !smp.OK {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(s.Samples))
+}
+
+// Last returns the newest sample
+func (s Status) Last() (Sample, bool) {
+	if len(s.Samples) == 0 {
+		return Sample{}, false
+	}
+	return s.Samples[len(s.Samples)-1], true
+}
+
+// Monitor probes targets every Interval and keeps the last Keep samples
+// of each. A target is reported down after DownAfter failures in a row
+// and up again at the first success.
+type Monitor struct {
+	Prober    Prober
+	Interval  time.Duration
+	Keep      int
+	DownAfter int
+
+	// OnRound is called after every round with a snapshot
+	OnRound func([]Status)
+	// OnChange is called when a target goes down or recovers
+	OnChange func(t Target, up bool)
+
+	mu       sync.Mutex
+	targets  []Target
+	status   map[string]*Status
+	failures map[string]int
+}
+
+// NewMonitor returns a monitor of targets with single-attempt probes
+func NewMonitor(targets []Target, interval time.Duration) *Monitor {
+	m := &Monitor{
+		Prober:    Prober{Timeout: Default.Timeout, Attempts: 1},
+		Interval:  interval,
+		Keep:      120,
+		DownAfter: 2,
+	}
+	m.SetTargets(targets)
+	return m
+}
+
+// SetTargets replaces the monitored targets, keeping the history of the
+// addresses that stay
+func (m *Monitor) SetTargets(targets []Target) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := make(map[string]*Status)
+	failures := make(map[string]int)
+	for _, t := range targets {
+		if old, ok := m.status[t.Addr]; ok {
+			old.Target = t
+			status[t.Addr] = old
+			failures[t.Addr] = m.failures[t.Addr]
+			continue
+		}
+		status[t.Addr] = &Status{Target: t, Up: true}
+	}
+	m.targets = targets
+	m.status = status
+	m.failures = failures
+}
+
+// Run probes until ctx is canceled
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		m.Round(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Round probes every target once and records the samples
+func (m *Monitor) Round(ctx context.Context) {
+	m.mu.Lock()
+	targets := m.targets
+	m.mu.Unlock()
+
+	results := m.Prober.ProbeAll(ctx, targets)
+	if ctx.Err() != nil {
+		return
+	}
+
+	type change struct {
+		t  Target
+		up bool
+	}
+	var changes []change
+
+	m.mu.Lock()
+	now := time.Now()
+	for _, r := range results {
+		st, ok := m.status[r.Addr]
+		if !ok {
+			continue
+		}
+		st.Samples = append(st.Samples, Sample{Time: now, OK: r.OK, Latency: r.Latency})
+		if m.Keep > 0 && len(st.Samples) > m.Keep {
+			st.Samples = st.Samples[len(st.Samples)-m.Keep:]
+		}
+
+		if r.OK {
+			m.failures[r.Addr] = 0
+			if !st.Up {
+				st.Up = true
+				changes = append(changes, change{st.Target, true})
+			}
+			continue
+		}
+		m.failures[r.Addr]++
+		if st.Up && m.failures[r.Addr] >= m.DownAfter {
+			st.Up = false
+			changes = append(changes, change{st.Target, false})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, c := range changes {
+		if m.OnChange != nil {
+			m.OnChange(c.t, c.up)
+		}
+	}
+	if m.OnRound != nil {
+		m.OnRound(m.Snapshot())
+	}
+}
+
+// Snapshot returns a copy of the state of every target, in target order
+func (m *Monitor) Snapshot() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Status
+	for _, t := range m.targets {
+		st := *m.status[t.Addr]
+		st.Samples = append([]Sample(nil), st.Samples...)
+		out = append(out, st)
+	}
+	return out
+}
+
+// WriteCSV writes every sample as time,name,addr,ok,latency_ms
+func (m *Monitor) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "name", "addr", "ok", "latency_ms"})
+	for _, st := range m.Snapshot() {
+		for _, s := range st.Samples {
+			latency := ""
+			if s.OK {
+				latency = strconv.FormatFloat(float64(s.Latency.Microseconds())/1000, 'f', 1, 64)
+			}
+			cw.Write([]string{s.Time.Format(time.RFC3339), st.Name, st.Addr, strconv.FormatBool(s.OK), latency})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// MonitorConfig is the content of the monitor config file
+type MonitorConfig struct {
+	IntervalSeconds int      `json:"interval_seconds"`
+	Targets         []Target `json:"targets"`
+}
+
+// DefaultInterval is used when the config does not set one
+const DefaultInterval = 30 * time.Second
+
+// Interval returns the probe interval of the config
+func (c MonitorConfig) Interval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return DefaultInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// LoadMonitorConfig reads the monitor config at path. A missing file gives
+// an empty config so the caller falls back to its own targets.
+func LoadMonitorConfig(path string) (MonitorConfig, error) {
+	var c MonitorConfig
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
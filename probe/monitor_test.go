@@ -0,0 +1,259 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProber answers pings from up, keyed by host; hosts not listed are
+// unreachable
+func fakeProber(up map[string]bool, mu *sync.Mutex) Prober {
+	return Prober{
+		Attempts: 1,
+		Timeout:  time.Second,
+		Ping: func(ctx context.Context, host string, timeout time.Duration) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !up[host] {
+				return errors.New("request timed out")
+			}
+			return nil
+		},
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("unexpected dial")
+		},
+	}
+}
+
+func TestMonitorRound(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		downAfter int
+		rounds    string // one letter per round: u answers, d does not
+		up        string // Up after each round
+		changes   []string
+	}{
+		{"steady", 2, "uuu", "uuu", nil},
+		{"one failure", 2, "udu", "uuu", nil},
+		{"down after two", 2, "uddu", "uudu", []string{"down", "up"}},
+		{"down reported once", 2, "ddddd", "udddd", []string{"down"}},
+		{"down at once", 1, "dud", "dud", []string{"down", "up", "down"}},
+		{"failures reset", 3, "ddudd", "uuuuu", nil},
+	} {
+		var mu sync.Mutex
+		up := map[string]bool{}
+		target := Target{Name: "Tuxedo", Addr: "10.0.91.10"}
+		m := NewMonitor([]Target{target}, time.Second)
+		m.Prober = fakeProber(up, &mu)
+		m.DownAfter = tc.downAfter
+
+		var changes []string
+		m.OnChange = func(tg Target, up bool) {
+			if tg != target {
+				t.Errorf("%s: change reported for %+v", tc.name, tg)
+			}
+			if up {
+				changes = append(changes, "up")
+			} else {
+				changes = append(changes, "down")
+			}
+		}
+		rounds := 0
+		m.OnRound = func(s []Status) { rounds++ }
+
+		var ups strings.Builder
+		for _, r := range tc.rounds {
+			mu.Lock()
+			up[target.Addr] = r == 'u'
+			mu.Unlock()
+			m.Round(context.Background())
+			if m.Snapshot()[0].Up {
+				ups.WriteByte('u')
+			} else {
+				ups.WriteByte('d')
+			}
+		}
+
+		if ups.String() != tc.up {
+			t.Errorf("%s: up %s, want %s", tc.name, ups.String(), tc.up)
+		}
+		if !reflect.DeepEqual(changes, tc.changes) {
+			t.Errorf("%s: changes %v, want %v", tc.name, changes, tc.changes)
+		}
+		if rounds != len(tc.rounds) {
+			t.Errorf("%s: OnRound called %d times, want %d", tc.name, rounds, len(tc.rounds))
+		}
+		st := m.Snapshot()[0]
+		failed := strings.Count(tc.rounds, "d")
+		if len(st.Samples) != len(tc.rounds) || st.Loss() != float64(failed)/float64(len(tc.rounds)) {
+			t.Errorf("%s: %d samples, loss %v", tc.name, len(st.Samples), st.Loss())
+		}
+	}
+}
+
+func TestMonitorAlertTarget(t *testing.T) {
+	var mu sync.Mutex
+	up := map[string]bool{"10.0.58.1": true}
+	targets := []Target{{Name: "Gateway", Addr: "10.0.58.1"}, {Name: "Tuxedo", Addr: "10.0.91.10"}}
+	m := NewMonitor(targets, time.Second)
+	m.Prober = fakeProber(up, &mu)
+	m.DownAfter = 1
+
+	var alerts []Target
+	m.OnChange = func(t Target, up bool) {
+		if !up {
+			alerts = append(alerts, t)
+		}
+	}
+	m.Round(context.Background())
+	if !reflect.DeepEqual(alerts, targets[1:]) {
+		t.Errorf("alerts %v, want %v", alerts, targets[1:])
+	}
+}
+
+func TestMonitorKeep(t *testing.T) {
+	var mu sync.Mutex
+	up := map[string]bool{}
+	m := NewMonitor([]Target{{Addr: "10.0.58.1"}}, time.Second)
+	m.Prober = fakeProber(up, &mu)
+	m.Keep = 3
+
+	for _, ok := range []bool{false, false, true, false, true} {
+		mu.Lock()
+		up["10.0.58.1"] = ok
+		mu.Unlock()
+		m.Round(context.Background())
+	}
+	var got []bool
+	for _, s := range m.Snapshot()[0].Samples {
+		got = append(got, s.OK)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want the newest %v", got, want)
+	}
+	if last, ok := m.Snapshot()[0].Last(); !ok || !last.OK {
+		t.Errorf("Last = %+v, %v", last, ok)
+	}
+}
+
+func TestMonitorSetTargets(t *testing.T) {
+	var mu sync.Mutex
+	up := map[string]bool{"10.0.58.1": true}
+	m := NewMonitor([]Target{{Name: "a", Addr: "10.0.58.1"}, {Name: "b", Addr: "10.0.91.10"}}, time.Second)
+	m.Prober = fakeProber(up, &mu)
+	m.Round(context.Background())
+
+	m.SetTargets([]Target{{Name: "c", Addr: "10.0.91.11"}, {Name: "b2", Addr: "10.0.91.10"}})
+	snap := m.Snapshot()
+	if len(snap) != 2 || snap[0].Name != "c" || len(snap[0].Samples) != 0 || !snap[0].Up {
+		t.Fatalf("new target %+v", snap)
+	}
+	if snap[1].Name != "b2" || len(snap[1].Samples) != 1 {
+		t.Errorf("kept target lost its history: %+v", snap[1])
+	}
+
+	// b failed once before SetTargets, so the second failure takes it down
+	var down []string
+	m.OnChange = func(t Target, up bool) {
+		if !up {
+			down = append(down, t.Name)
+		}
+	}
+	m.Round(context.Background())
+	if !reflect.DeepEqual(down, []string{"b2"}) {
+		t.Errorf("down %v, want [b2]", down)
+	}
+}
+
+func TestMonitorRoundCanceled(t *testing.T) {
+	var mu sync.Mutex
+	m := NewMonitor([]Target{{Addr: "10.0.58.1"}}, time.Second)
+	m.Prober = fakeProber(map[string]bool{"10.0.58.1": true}, &mu)
+	m.OnRound = func([]Status) { t.Error("OnRound called for a canceled round") }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.Round(ctx)
+	if n := len(m.Snapshot()[0].Samples); n != 0 {
+		t.Errorf("canceled round recorded %d samples", n)
+	}
+}
+
+func TestMonitorWriteCSV(t *testing.T) {
+	var mu sync.Mutex
+	up := map[string]bool{"10.0.58.1": true}
+	m := NewMonitor([]Target{{Name: "Gateway", Addr: "10.0.58.1"}, {Name: "Tuxedo, live", Addr: "10.0.91.10"}}, time.Second)
+	m.Prober = fakeProber(up, &mu)
+	m.Round(context.Background())
+	m.Round(context.Background())
+
+	var buf bytes.Buffer
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || !reflect.DeepEqual(rows[0], []string{"time", "name", "addr", "ok", "latency_ms"}) {
+		t.Fatalf("rows %q", rows)
+	}
+	for i, row := range rows[1:] {
+		if _, err := time.Parse(time.RFC3339, row[0]); err != nil {
+			t.Errorf("row %d: %v", i, err)
+		}
+		ok := i < 2
+		want := []string{"Gateway", "10.0.58.1", "true"}
+		if !ok {
+			want = []string{"Tuxedo, live", "10.0.91.10", "false"}
+		}
+		if !reflect.DeepEqual(row[1:4], want) {
+			t.Errorf("row %d = %q, want %q", i, row[1:4], want)
+		}
+		if (row[4] != "") != ok {
+			t.Errorf("row %d latency %q", i, row[4])
+		}
+	}
+}
+
+func TestMonitorConfig(t *testing.T) {
+	for _, tc := range []struct {
+		seconds int
+		want    time.Duration
+	}{
+		{0, DefaultInterval},
+		{-5, DefaultInterval},
+		{10, 10 * time.Second},
+	} {
+		if got := (MonitorConfig{IntervalSeconds: tc.seconds}).Interval(); got != tc.want {
+			t.Errorf("Interval(%d) = %s, want %s", tc.seconds, got, tc.want)
+		}
+	}
+
+	dir := t.TempDir()
+	c, err := LoadMonitorConfig(filepath.Join(dir, "missing.json"))
+	if err != nil || c.Interval() != DefaultInterval || len(c.Targets) != 0 {
+		t.Errorf("missing config = %+v, %v", c, err)
+	}
+
+	path := filepath.Join(dir, "monitor.json")
+	os.WriteFile(path, []byte(`{"interval_seconds": 5, "targets": [{"name": "Gateway", "addr": "10.0.58.1"}]}`), 0644)
+	c, err = LoadMonitorConfig(path)
+	if err != nil || c.Interval() != 5*time.Second || !reflect.DeepEqual(c.Targets, []Target{{Name: "Gateway", Addr: "10.0.58.1"}}) {
+		t.Errorf("config = %+v, %v", c, err)
+	}
+
+	os.WriteFile(path, []byte(`{"interval_seconds": "5"}`), 0644)
+	if _, err := LoadMonitorConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("bad config err = %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"ipcas2-scanner/cmdout"
+)
+
+// PingFunc sends one ICMP echo to host
+type PingFunc func(ctx context.Context, host string, timeout time.Duration) error
+
+// Ping runs the Windows ping command once. Timeouts and unreachable
+// answers are failures.
+func Ping(ctx context.Context, host string, timeout time.Duration) error {
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+	out, err := exec.CommandContext(ctx, "ping", "-n", "1", "-w", ms, host).CombinedOutput()
+	if cmdout.ParsePing(cmdout.Decode(out)).OK() {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ping %s: %w", host, err)
+	}
+	return fmt.Errorf("ping %s: no reply", host)
+}
+
+// isHost reports whether addr is a bare host, which is pinged instead of
+// connected to
+func isHost(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err != nil
+}
+
+// DefaultGateway returns the next hop of the default route with the
+// lowest metric
+func DefaultGateway() (string, error) {
+	out, err := exec.Command("powershell", "-NoProfile", "-Command",
+		"(Get-NetRoute -DestinationPrefix 0.0.0.0/0 | Sort-Object RouteMetric | Select-Object -First 1).NextHop").Output()
+	if err != nil {
+		return "", err
+	}
+	gw := strings.TrimSpace(string(out))
+	if net.ParseIP(gw) == nil {
+		return "", fmt.Errorf("no default gateway")
+	}
+	return gw, nil
+}
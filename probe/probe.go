@@ -0,0 +1,168 @@
+// Package probe checks that IPCAS2 servers accept TCP connections, which
+// works where ICMP ping is blocked.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ipcas2-scanner/ipcasini"
+)
+
+// SMBPort is the port of Windows file sharing
+const SMBPort = "445"
+
+// Target is an address to connect to
+type Target struct {
+	Name string `json:"name"`
+	Addr string `json:"addr"` // host:port, or a bare host to ping
+}
+
+// Result is the outcome of probing a target. Latency is the fastest
+// successful connect.
+type Result struct {
+	Target
+	OK       bool          `json:"ok"`
+	Latency  time.Duration `json:"latency"`
+	Attempts int           `json:"attempts"`
+	Failures int           `json:"failures"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// DialFunc opens a connection, net.Dialer.DialContext by default
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Prober connects to targets
+type Prober struct {
+	Dial     DialFunc
+	Ping     PingFunc
+	Timeout  time.Duration // per attempt
+	Attempts int
+}
+
+// Default tries three times with a 3 second timeout
+var Default = Prober{Timeout: 3 * time.Second, Attempts: 3}
+
+// Probe connects to t Attempts times
+func (p Prober) Probe(ctx context.Context, t Target) Result {
+	dial := p.Dial
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	ping := p.Ping
+	if ping == nil {
+		ping = Ping
+	}
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = Default.Timeout
+	}
+
+	res := Result{Target: t}
+	for i := 0; i < attempts && ctx.Err() == nil; i++ {
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		var err error
+		if isHost(t.Addr) {
+			err = ping(actx, t.Addr, timeout)
+		} else {
+			var conn net.Conn
+			if conn, err = dial(actx, "tcp", t.Addr); err == nil {
+				conn.Close()
+			}
+		}
+		elapsed := time.Since(start)
+		cancel()
+
+		res.Attempts++
+		if err != nil {
+			res.Failures++
+			res.Error = err.Error()
+			continue
+		}
+		if !res.OK || elapsed < res.Latency {
+			res.Latency = elapsed
+		}
+		res.OK = true
+	}
+	if res.OK {
+		res.Error = ""
+	}
+	return res
+}
+
+// ProbeAll probes the targets concurrently and returns results in order
+func (p Prober) ProbeAll(ctx context.Context, targets []Target) []Result {
+	results := make([]Result, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			results[i] = p.Probe(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// ParseWSNAddr turns a Tuxedo address such as //10.0.91.10:10000 into
+// host:port
+func ParseWSNAddr(s string) (string, error) {
+	addr := strings.TrimPrefix(strings.TrimSpace(s), "//")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid wsnaddr %q", s)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid wsnaddr port %q", port)
+	}
+	return addr, nil
+}
+
+// ShareHost returns the server of a UNC path like \\10.32.128.12\IPCAS2\Bin
+func ShareHost(unc string) string {
+	if !strings.HasPrefix(unc, `\\`) {
+		return ""
+	}
+	host, _, _ := strings.Cut(strings.TrimPrefix(unc, `\\`), `\`)
+	return host
+}
+
+// Targets returns the servers a workstation depends on: the wsnaddr of
+// every environment active in the INI at iniPath and SMB on the update
+// share host
+func Targets(iniPath string, envs []ipcasini.Environment, updateSource string) []Target {
+	var targets []Target
+	if env, ok, err := ipcasini.CurrentEnvironment(iniPath, envs); err == nil && ok {
+		if addr, err := ParseWSNAddr(env.Address); err == nil {
+			targets = append(targets, Target{Name: "Tuxedo " + env.Name, Addr: addr})
+		}
+	}
+	if host := ShareHost(updateSource); host != "" {
+		targets = append(targets, Target{Name: "SMB " + host, Addr: net.JoinHostPort(host, SMBPort)})
+	}
+	return targets
+}
+
+// String renders the result for the status labels
+func (r Result) String() string {
+	if !r.OK {
+		return fmt.Sprintf("❌ %s (%s): %s", r.Name, r.Addr, r.Error)
+	}
+	s := fmt.Sprintf("✅ %s (%s): %d ms", r.Name, r.Addr, r.Latency.Milliseconds())
+	if r.Failures > 0 {
+		s += fmt.Sprintf(", lỗi %d/%d lần", r.Failures, r.Attempts)
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ipcas2-scanner/ipcasini"
+)
+
+func TestParseWSNAddr(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"//10.0.91.10:10000", "10.0.91.10:10000", true},
+		{"  //tuxedo.local:9000 ", "tuxedo.local:9000", true},
+		{"10.0.91.10:10000", "10.0.91.10:10000", true},
+		{"//[fe80::1]:10000", "[fe80::1]:10000", true},
+		{"//10.0.91.10", "", false},
+		{"//:10000", "", false},
+		{"//10.0.91.10:0", "", false},
+		{"//10.0.91.10:70000", "", false},
+		{"//10.0.91.10:port", "", false},
+		{"", "", false},
+	} {
+		got, err := ParseWSNAddr(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseWSNAddr(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestShareHost(t *testing.T) {
+	for in, want := range map[string]string{
+		`\\10.32.128.12\IPCAS2\Bin`: "10.32.128.12",
+		`\\server`:                  "server",
+		`C:\IPCAS2\Bin`:             "",
+	} {
+		if got := ShareHost(in); got != want {
+			t.Errorf("ShareHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.WriteFile(path, []byte(fmt.Sprintf(ipcasini.Template, "3611", "TOKEN7")), 0644)
+
+	got := Targets(path, ipcasini.DefaultEnvironments, `\\10.32.128.12\IPCAS2\Bin`)
+	want := []Target{
+		{Name: "Tuxedo LIVE", Addr: "10.0.91.10:10000"},
+		{Name: "SMB 10.32.128.12", Addr: "10.32.128.12:445"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Targets = %v, want %v", got, want)
+	}
+}
+
+// fakeConn is returned by the fake dialer
+type fakeConn struct{ net.Conn }
+
+func (fakeConn) Close() error { return nil }
+
+func TestProbeCountsFailures(t *testing.T) {
+	calls := 0
+	p := Prober{
+		Attempts: 3,
+		Timeout:  time.Second,
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			calls++
+			if calls == 2 {
+				return nil, errors.New("refused")
+			}
+			return fakeConn{}, nil
+		},
+	}
+	res := p.Probe(context.Background(), Target{Name: "Tuxedo", Addr: "10.0.91.10:10000"})
+	if !res.OK || res.Attempts != 3 || res.Failures != 1 || res.Error != "" {
+		t.Errorf("res = %+v", res)
+	}
+
+	p.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("refused")
+	}
+	res = p.Probe(context.Background(), Target{Addr: "10.0.91.10:10000"})
+	if res.OK || res.Failures != 3 || res.Error != "refused" {
+		t.Errorf("res = %+v", res)
+	}
+}
+
+func TestProbePingsBareHosts(t *testing.T) {
+	pinged := ""
+	p := Prober{
+		Attempts: 1,
+		Ping: func(ctx context.Context, host string, timeout time.Duration) error {
+			pinged = host
+			return nil
+		},
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			t.Error("dialed a bare host")
+			return nil, errors.New("unexpected")
+		},
+	}
+	if res := p.Probe(context.Background(), Target{Addr: "10.0.58.1"}); !res.OK || pinged != "10.0.58.1" {
+		t.Errorf("res = %+v, pinged %q", res, pinged)
+	}
+}
@@ -0,0 +1,332 @@
+package quarantine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"ipcas2-scanner/scanner"
+)
+
+// indexName is the JSON lines index kept inside the store
+const indexName = "index.jsonl"
+
+// lockName guards the index across processes: the GUI and the scheduled
+// clean run as separate processes and both append to it
+const lockName = "index.lock"
+
+const (
+	// lockTimeout is how long a change waits for another process
+	lockTimeout = 30 * time.Second
+	// lockStale is the age after which a lock left by a crashed process is broken
+	lockStale = 5 * time.Minute
+)
+
+// DefaultDays is how long quarantined files are kept before Purge removes them
+const DefaultDays = 30
+
+// Entry records a quarantined file
+type Entry struct {
+	ID          string    `json:"id"`
+	Original    string    `json:"original"`
+	Stored      string    `json:"stored"`
+	Size        int64     `json:"size"`
+	Hidden      bool      `json:"hidden"`
+	ModTime     time.Time `json:"mtime"`
+	Quarantined time.Time `json:"quarantined"`
+	Reason      string    `json:"reason"`
+}
+
+// Store moves files into Dir instead of deleting them
+type Store struct {
+	Dir string
+	// Attrs records and restores the hidden attribute, scanner.System when nil
+	Attrs scanner.Attributes
+
+	// mu serializes the store within the process, the lock file across processes
+	mu   sync.Mutex
+	last int64
+}
+
+// Open returns the store kept in dir
+func Open(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) attrs() scanner.Attributes {
+	if s.Attrs == nil {
+		return scanner.System
+	}
+	return s.Attrs
+}
+
+// lock takes the store for the calling goroutine and process. The returned
+// function releases it.
+func (s *Store) lock() (func(), error) {
+	s.mu.Lock()
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	path := filepath.Join(s.Dir, lockName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() {
+				os.Remove(path)
+				s.mu.Unlock()
+			}, nil
+		}
+		// Windows reports a lock file that is being removed as access denied
+		if !errors.Is(err, fs.ErrExist) && !errors.Is(err, fs.ErrPermission) {
+			s.mu.Unlock()
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("quarantine is locked by another process (%s)", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// newID returns a unique, time ordered entry id
+func (s *Store) newID() string {
+	n := time.Now().UnixNano()
+	if n <= s.last {
+		n = s.last + 1
+	}
+	s.last = n
+	return strconv.FormatInt(n, 36)
+}
+
+// Add moves path into the store and records where it came from
+func (s *Store) Add(path, reason string) (*Entry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := Entry{
+		ID:          s.newID(),
+		Original:    abs,
+		Size:        info.Size(),
+		Hidden:      s.attrs().IsHidden(path),
+		ModTime:     info.ModTime(),
+		Quarantined: time.Now(),
+		Reason:      reason,
+	}
+	e.Stored = e.ID + "_" + filepath.Base(path)
+
+	if err := os.MkdirAll(filepath.Join(s.Dir, "files"), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.move(path, s.storedPath(&e), e.ModTime); err != nil {
+		return nil, err
+	}
+	if err := s.appendIndex(&e); err != nil {
+		// Put the file back rather than lose track of it
+		s.move(s.storedPath(&e), path, e.ModTime)
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the quarantined files, oldest first
+func (s *Store) List() ([]Entry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.readIndex()
+}
+
+// Restore moves an entry back to its original path. It refuses to overwrite
+// a file that has been recreated there.
+func (s *Store) Restore(id string) (*Entry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if e.ID != id {
+			continue
+		}
+		if _, err := os.Stat(e.Original); err == nil {
+			return nil, fmt.Errorf("%s already exists", e.Original)
+		}
+		os.MkdirAll(filepath.Dir(e.Original), 0755)
+		if err := s.move(s.storedPath(&e), e.Original, e.ModTime); err != nil {
+			return nil, err
+		}
+		if e.Hidden {
+			s.attrs().SetHidden(e.Original, true)
+		}
+		entries = append(entries[:i], entries[i+1:]...)
+		return &e, s.writeIndex(entries)
+	}
+	return nil, fmt.Errorf("no quarantined file with id %s", id)
+}
+
+// Purge permanently deletes entries quarantined longer than maxAge ago
+func (s *Store) Purge(maxAge time.Duration) ([]Entry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	var kept, purged []Entry
+	for _, e := range entries {
+		if e.Quarantined.Before(cutoff) {
+			if err := os.Remove(s.storedPath(&e)); err == nil || errors.Is(err, fs.ErrNotExist) {
+				purged = append(purged, e)
+				continue
+			}
+		}
+		kept = append(kept, e)
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	return purged, s.writeIndex(kept)
+}
+
+func (s *Store) storedPath(e *Entry) string {
+	return filepath.Join(s.Dir, "files", e.Stored)
+}
+
+func (s *Store) readIndex() ([]Entry, error) {
+	f, err := os.Open(filepath.Join(s.Dir, indexName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.ID != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+func (s *Store) appendIndex(e *Entry) error {
+	f, err := os.OpenFile(filepath.Join(s.Dir, indexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(e)
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeIndex replaces the index through a temporary file
+func (s *Store) writeIndex(entries []Entry) error {
+	tmp := filepath.Join(s.Dir, indexName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		data, _ := json.Marshal(e)
+		w.Write(append(data, '\n'))
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, indexName))
+}
+
+// move renames src to dst, copying across volumes (e.g. from the U:
+// Picture share into C:\IPCAS2\Quarantine)
+func (s *Store) move(src, dst string, mtime time.Time) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		in.Close()
+		return err
+	}
+	_, err = io.Copy(out, in)
+	in.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	os.Chtimes(dst, mtime, mtime)
+
+	// A hidden or read-only source may refuse removal until its
+	// attributes are cleared
+	s.attrs().SetHidden(src, false)
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package quarantine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type noAttrs struct{}
+
+func (noAttrs) IsHidden(path string) bool                { return false }
+func (noAttrs) SetHidden(path string, hidden bool) error { return nil }
+
+func TestAddRestore(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "IPCAS2.ini")
+	os.WriteFile(src, []byte("ini"), 0644)
+	s := &Store{Dir: t.TempDir(), Attrs: noAttrs{}}
+
+	e, err := s.Add(src, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("file still in place after Add")
+	}
+	if _, err := s.Restore(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(src); string(data) != "ini" {
+		t.Errorf("restored %q", data)
+	}
+	if entries, _ := s.List(); len(entries) != 0 {
+		t.Errorf("index still lists %v", entries)
+	}
+}
+
+// Two stores on one folder stand in for the GUI and the scheduled CLI
+func TestConcurrentStores(t *testing.T) {
+	dir := t.TempDir()
+	src := t.TempDir()
+	stores := []*Store{{Dir: dir, Attrs: noAttrs{}}, {Dir: dir, Attrs: noAttrs{}}}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func(i int, s *Store) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				path := filepath.Join(src, fmt.Sprintf("%d_%d.jpg", i, j))
+				os.WriteFile(path, []byte("x"), 0644)
+				if _, err := s.Add(path, "test"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	entries, err := stores[0].List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2*n {
+		t.Errorf("index has %d entries, want %d", len(entries), 2*n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockName)); !os.IsNotExist(err) {
+		t.Error("lock file left behind")
+	}
+}
+
+func TestStaleLockIsBroken(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), Attrs: noAttrs{}}
+	lock := filepath.Join(s.Dir, lockName)
+	os.WriteFile(lock, []byte("1\n"), 0644)
+	old := time.Now().Add(-2 * lockStale)
+	os.Chtimes(lock, old, old)
+
+	if _, err := s.List(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), Attrs: noAttrs{}}
+	src := filepath.Join(t.TempDir(), "a.jpg")
+	os.WriteFile(src, []byte("x"), 0644)
+	e, err := s.Add(src, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, _ := s.Purge(time.Hour); len(purged) != 0 {
+		t.Errorf("purged fresh entry %v", purged)
+	}
+	purged, err := s.Purge(0)
+	if err != nil || len(purged) != 1 || purged[0].ID != e.ID {
+		t.Errorf("purged = %v, err = %v", purged, err)
+	}
+	if _, err := os.Stat(s.storedPath(e)); !os.IsNotExist(err) {
+		t.Error("stored file not removed")
+	}
+}
@@ -0,0 +1,62 @@
+package region
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"ipcas2-scanner/cmdout"
+)
+
+// intlKey is the per-user regional settings key
+const intlKey = `HKCU\Control Panel\International`
+
+// Settings are the regional values IPCAS2 depends on
+type Settings struct {
+	ShortDate string `json:"sShortDate"`
+	Decimal   string `json:"sDecimal"`
+	Thousand  string `json:"sThousand"`
+}
+
+// IPCAS2 is the format IPCAS2 expects: dd/MM/yyyy with . and ,
+var IPCAS2 = Settings{ShortDate: "dd/MM/yyyy", Decimal: ".", Thousand: ","}
+
+// readValue returns a REG_SZ value under intlKey, or "" when missing
+func readValue(name string) string {
+	out, _ := exec.Command("reg", "query", intlKey, "/v", name).CombinedOutput()
+	v, _ := cmdout.ParseRegQuery(cmdout.Decode(out), name)
+	return v
+}
+
+// Read returns the current user's regional settings
+func Read() Settings {
+	return Settings{
+		ShortDate: readValue("sShortDate"),
+		Decimal:   readValue("sDecimal"),
+		Thousand:  readValue("sThousand"),
+	}
+}
+
+// ApplyIPCAS2 writes the IPCAS2 compatible format. A restart is needed for
+// IPCAS2 to pick it up.
+func ApplyIPCAS2() error {
+	values := [][2]string{
+		{"sShortDate", "dd/MM/yyyy"},
+		{"sLongDate", "dddd, d MMMM yyyy"},
+		{"sDecimal", "."},
+		{"sThousand", ","},
+		{"iDate", "1"},
+		{"sDate", "/"},
+	}
+
+	var failed []string
+	for _, v := range values {
+		if err := exec.Command("reg", "add", intlKey, "/v", v[0], "/t", "REG_SZ", "/d", v[1], "/f").Run(); err != nil {
+			failed = append(failed, v[0])
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("cannot set %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
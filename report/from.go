@@ -0,0 +1,110 @@
+package report
+
+import (
+	"ipcas2-scanner/cleaner"
+	"ipcas2-scanner/quarantine"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/update"
+)
+
+// FromScan records the files a scan found. removed holds the outcome of
+// quarantining the files that were deleted, by path: nil for success.
+func FromScan(files []scanner.FileInfo, removed map[string]error) *Report {
+	r := New(Scan, "Báo cáo quét file")
+	for _, f := range files {
+		e := Entry{Path: f.Path, Size: f.Size, Reason: f.Rule, Result: Found}
+		if err, ok := removed[f.Path]; ok {
+			e.Result = Quarantined
+			if err != nil {
+				e.Result, e.Error = Failed, err.Error()
+			}
+		}
+		r.Add(e)
+	}
+	return r
+}
+
+// FromClean records a junk cleanup, or its preview when nothing was removed
+func FromClean(res *cleaner.Result) *Report {
+	r := New(Clean, "Báo cáo dọn file rác "+res.Root)
+	preview := len(res.Deleted) == 0 && len(res.Failed) == 0
+	done := make(map[string]bool)
+	for _, it := range res.Deleted {
+		done[it.Path] = true
+	}
+	failed := make(map[string]string)
+	for _, it := range res.Failed {
+		failed[it.Path] = it.Error
+	}
+	for _, it := range res.Junk {
+		e := Entry{Path: it.Path, Size: it.Size, Reason: it.Reason + ": " + it.Why, Result: Skipped}
+		switch {
+		case preview:
+			e.Result = Planned
+		case done[it.Path]:
+			e.Result = Quarantined
+		case failed[it.Path] != "":
+			e.Result, e.Error = Failed, failed[it.Path]
+		}
+		r.Add(e)
+	}
+	return r
+}
+
+// FromUpdate records an update of the files in changes. A nil res, as
+// left by a failed backup, records every file as skipped.
+func FromUpdate(changes []update.Change, res *update.Result) *Report {
+	if res == nil {
+		res = &update.Result{}
+	}
+	r := New(Update, "Báo cáo cập nhật IPCAS2 "+res.Version)
+	results := make(map[string]string)
+	for _, p := range res.Updated {
+		results[p] = Updated
+	}
+	for _, p := range res.Skipped {
+		results[p] = Skipped
+	}
+	for _, p := range res.RolledBack {
+		results[p] = RolledBack
+	}
+	errs := make(map[string]string)
+	for _, f := range res.Failed {
+		results[f.Path] = Failed
+		errs[f.Path] = f.Error
+	}
+	for _, c := range changes {
+		result, ok := results[c.Path]
+		if !ok {
+			result = Skipped
+		}
+		r.Add(Entry{Path: c.Path, Size: c.Size, Reason: string(c.Reason), Result: result, Error: errs[c.Path]})
+	}
+	return r
+}
+
+// FromQuarantine records files restored from quarantine; failed holds the
+// errors by entry ID
+func FromQuarantine(entries []quarantine.Entry, failed map[string]error) *Report {
+	r := New(Restore, "Báo cáo khôi phục từ thư mục cách ly")
+	for _, q := range entries {
+		e := Entry{Path: q.Original, Size: q.Size, Reason: q.Reason, Result: Restored}
+		if err := failed[q.ID]; err != nil {
+			e.Result, e.Error = Failed, err.Error()
+		}
+		r.Add(e)
+	}
+	return r
+}
+
+// FromBackup records files restored from an update backup
+func FromBackup(backup string, restored []string, errs []update.Failure) *Report {
+	r := New(Restore, "Báo cáo khôi phục bản backup "+backup)
+	for _, p := range restored {
+		r.Add(Entry{Path: p, Reason: backup, Result: Restored})
+	}
+	for _, f := range errs {
+		r.Add(Entry{Path: f.Path, Reason: backup, Result: Failed, Error: f.Error})
+	}
+	return r
+}
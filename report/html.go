@@ -0,0 +1,65 @@
+package report
+
+import (
+	"html/template"
+	"io"
+
+	"ipcas2-scanner/scanner"
+)
+
+// resultLabels are the Vietnamese names of results in the HTML page
+var resultLabels = map[string]string{
+	Found:       "Tìm thấy",
+	Planned:     "Sẽ xóa",
+	Quarantined: "Đã cách ly",
+	Updated:     "Đã cập nhật",
+	Skipped:     "Bỏ qua",
+	RolledBack:  "Đã hoàn tác",
+	Restored:    "Đã khôi phục",
+	Failed:      "Lỗi",
+}
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size": scanner.FormatSize,
+	"inc":  func(i int) int { return i + 1 },
+	"label": func(result string) string {
+		if l, ok := resultLabels[result]; ok {
+			return l
+		}
+		return result
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: "Segoe UI", Arial, sans-serif; margin: 24px; color: #222; }
+h1 { color: #0067c0; font-size: 20px; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+th { background: #f0f0f0; }
+td.num { text-align: right; white-space: nowrap; }
+tr.failed td { color: #c83232; }
+.meta { color: #666; margin-bottom: 16px; }
+.totals { width: auto; margin-bottom: 16px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">{{.Time.Format "02/01/2006 15:04:05"}} • Máy {{.Host}} • Người dùng {{.User}} • {{len .Entries}} file</div>
+<table class="totals">
+<tr><th>Kết quả</th><th>Số file</th><th>Dung lượng</th></tr>
+{{range .Counts}}<tr><td>{{label .Result}}</td><td class="num">{{.Files}}</td><td class="num">{{size .Bytes}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>#</th><th>Đường dẫn</th><th>Dung lượng</th><th>Lý do</th><th>Kết quả</th></tr>
+{{range $i, $e := .Entries}}<tr{{if eq $e.Result "failed"}} class="failed"{{end}}><td class="num">{{inc $i}}</td><td>{{$e.Path}}</td><td class="num">{{size $e.Size}}</td><td>{{$e.Reason}}</td><td>{{label $e.Result}}{{if $e.Error}}: {{$e.Error}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (r *Report) writeHTML(w io.Writer) error {
+	return page.Execute(w, r)
+}
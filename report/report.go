@@ -0,0 +1,179 @@
+// Package report records the files an operation touched (scan, clean,
+// update, restore) and exports the record as CSV, JSON or a self-contained
+// HTML page for auditors.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the operation a report records
+type Kind string
+
+const (
+	Scan    Kind = "scan"
+	Clean   Kind = "clean"
+	Update  Kind = "update"
+	Restore Kind = "restore"
+)
+
+// Result of an operation on one file
+const (
+	Found       = "found"
+	Planned     = "planned"
+	Quarantined = "quarantined"
+	Updated     = "updated"
+	Skipped     = "skipped"
+	RolledBack  = "rolled_back"
+	Restored    = "restored"
+	Failed      = "failed"
+)
+
+// Entry is one file of a report
+type Entry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the full record of an operation
+type Report struct {
+	Kind    Kind      `json:"kind"`
+	Title   string    `json:"title"`
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	User    string    `json:"user"`
+	Entries []Entry   `json:"entries"`
+}
+
+// New starts a report of the current machine and user
+func New(kind Kind, title string) *Report {
+	host, _ := os.Hostname()
+	return &Report{Kind: kind, Title: title, Time: time.Now(), Host: host, User: os.Getenv("USERNAME")}
+}
+
+// Add appends an entry
+func (r *Report) Add(e Entry) {
+	r.Entries = append(r.Entries, e)
+}
+
+// Count is the number of entries with a result
+type Count struct {
+	Result string `json:"result"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Counts totals the entries by result, in result order
+func (r *Report) Counts() []Count {
+	idx := make(map[string]int)
+	var counts []Count
+	for _, e := range r.Entries {
+		i, ok := idx[e.Result]
+		if !ok {
+			i = len(counts)
+			idx[e.Result] = i
+			counts = append(counts, Count{Result: e.Result})
+		}
+		counts[i].Files++
+		counts[i].Bytes += e.Size
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Result < counts[j].Result })
+	return counts
+}
+
+// Format is an export format
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+	HTML Format = "html"
+)
+
+// Formats lists the export formats
+var Formats = []Format{CSV, JSON, HTML}
+
+// ParseFormat reads a format name or a file extension
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimPrefix(s, ".")))
+	switch f {
+	case CSV, JSON, HTML:
+		return f, nil
+	case "htm":
+		return HTML, nil
+	}
+	return "", fmt.Errorf("unknown report format %q", s)
+}
+
+// Write exports r to w
+func (r *Report) Write(w io.Writer, f Format) error {
+	switch f {
+	case CSV:
+		return r.writeCSV(w)
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case HTML:
+		return r.writeHTML(w)
+	}
+	return fmt.Errorf("unknown report format %q", f)
+}
+
+// WriteFile exports r to path in the format of its extension
+func (r *Report) WriteFile(path string) error {
+	f, err := ParseFormat(filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = r.Write(out, f)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Save exports r into dir as <kind>_<time>.<format> and returns the path
+func (r *Report) Save(dir string, f Format) (string, error) {
+	path := filepath.Join(dir, string(r.Kind)+"_"+r.Time.Format("20060102_150405")+"."+string(f))
+	return path, r.WriteFile(path)
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	// Excel needs the BOM to read UTF-8 Vietnamese names
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "size", "reason", "result", "error"})
+	for _, e := range r.Entries {
+		cw.Write([]string{csvText(e.Path), strconv.FormatInt(e.Size, 10), csvText(e.Reason), e.Result, csvText(e.Error)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText keeps Excel from running a cell as a formula: a file may well be
+// named =cmd|' /C calc'!A0.csv. Such text gets a leading quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ipcas2-scanner/cleaner"
+	"ipcas2-scanner/quarantine"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/update"
+)
+
+// results returns the path and result of every entry
+func results(r *Report) []string {
+	var out []string
+	for _, e := range r.Entries {
+		s := e.Path + " " + e.Result
+		if e.Error != "" {
+			s += " " + e.Error
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func check(t *testing.T, r *Report, kind Kind, want ...string) {
+	t.Helper()
+	if r.Kind != kind {
+		t.Errorf("kind = %s, want %s", r.Kind, kind)
+	}
+	if got := results(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestFromScan(t *testing.T) {
+	files := []scanner.FileInfo{
+		{Path: `C:\a\IPCAS2.ini`, Size: 10, Rule: "IPCAS2.ini ẩn"},
+		{Path: `C:\b\IPCAS2.ini`, Size: 20},
+		{Path: `C:\c\IPCAS2.ini`, Size: 30},
+	}
+	check(t, FromScan(files, nil), Scan,
+		`C:\a\IPCAS2.ini found`, `C:\b\IPCAS2.ini found`, `C:\c\IPCAS2.ini found`)
+
+	removed := map[string]error{`C:\a\IPCAS2.ini`: nil, `C:\b\IPCAS2.ini`: errors.New("access denied")}
+	r := FromScan(files, removed)
+	check(t, r, Scan,
+		`C:\a\IPCAS2.ini quarantined`, `C:\b\IPCAS2.ini failed access denied`, `C:\c\IPCAS2.ini found`)
+	if r.Entries[0].Reason != "IPCAS2.ini ẩn" || r.Entries[0].Size != 10 {
+		t.Errorf("entry = %+v", r.Entries[0])
+	}
+}
+
+func TestFromClean(t *testing.T) {
+	a := cleaner.Item{Path: `U:\a.env`, Size: 1, Reason: "file rác", Why: "đuôi .env"}
+	b := cleaner.Item{Path: `U:\b.jpg`, Size: 2, Reason: "ảnh cũ", Why: "đuôi .jpg"}
+	c := cleaner.Item{Path: `U:\c.jpg`, Size: 3, Reason: "ảnh cũ"}
+
+	preview := FromClean(&cleaner.Result{Root: `U:\`, Junk: []cleaner.Item{a, b}})
+	check(t, preview, Clean, `U:\a.env planned`, `U:\b.jpg planned`)
+	if preview.Entries[0].Reason != "file rác: đuôi .env" {
+		t.Errorf("reason = %q", preview.Entries[0].Reason)
+	}
+
+	failed := c
+	failed.Error = "in use"
+	done := FromClean(&cleaner.Result{Root: `U:\`, Junk: []cleaner.Item{a, b, c},
+		Deleted: []cleaner.Item{a}, Failed: []cleaner.Item{failed}})
+	check(t, done, Clean, `U:\a.env quarantined`, `U:\b.jpg skipped`, `U:\c.jpg failed in use`)
+}
+
+func TestFromUpdate(t *testing.T) {
+	changes := []update.Change{
+		{FileEntry: update.FileEntry{Path: "a.dll", Size: 1}, Reason: update.ReasonHash},
+		{FileEntry: update.FileEntry{Path: "b.dll", Size: 2}, Reason: update.ReasonMissing},
+		{FileEntry: update.FileEntry{Path: "c.dll", Size: 3}, Reason: update.ReasonSize},
+		{FileEntry: update.FileEntry{Path: "d.dll", Size: 4}, Reason: update.ReasonSize},
+	}
+	res := &update.Result{
+		Version:    "2024.10.1",
+		Updated:    []string{"a.dll"},
+		RolledBack: []string{"b.dll"},
+		Failed:     []update.Failure{{Path: "c.dll", Error: "hash mismatch"}},
+	}
+	r := FromUpdate(changes, res)
+	check(t, r, Update, "a.dll updated", "b.dll rolled_back", "c.dll failed hash mismatch", "d.dll skipped")
+	if !strings.HasSuffix(r.Title, "2024.10.1") || r.Entries[1].Reason != "missing" {
+		t.Errorf("report = %+v", r)
+	}
+
+	// A failed backup installs nothing and returns no result
+	check(t, FromUpdate(changes, nil), Update, "a.dll skipped", "b.dll skipped", "c.dll skipped", "d.dll skipped")
+}
+
+func TestFromQuarantine(t *testing.T) {
+	entries := []quarantine.Entry{
+		{ID: "1", Original: `U:\a.env`, Size: 5, Reason: "file rác"},
+		{ID: "2", Original: `U:\b.env`, Size: 6, Reason: "file rác"},
+	}
+	r := FromQuarantine(entries, map[string]error{"2": errors.New(`U:\b.env already exists`)})
+	check(t, r, Restore, `U:\a.env restored`, `U:\b.env failed U:\b.env already exists`)
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := New(Clean, "test")
+	names := []string{
+		`U:\plain.jpg`,
+		`U:\a,b.jpg`,
+		`U:\say "hi".jpg`,
+		"U:\\two\nlines.jpg",
+		`=cmd|' /C calc'!A0`,
+		`+1.jpg`,
+		`-1.jpg`,
+		`@SUM(A1).jpg`,
+	}
+	for _, n := range names {
+		r.Add(Entry{Path: n, Size: 7, Reason: "=HYPERLINK()", Result: Planned})
+	}
+	var buf bytes.Buffer
+	if err := r.Write(&buf, CSV); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("\uFEFF")) {
+		t.Fatal("CSV has no BOM")
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\uFEFF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(names)+1 || !reflect.DeepEqual(rows[0], []string{"path", "size", "reason", "result", "error"}) {
+		t.Fatalf("rows = %q", rows)
+	}
+	want := []string{
+		`U:\plain.jpg`,
+		`U:\a,b.jpg`,
+		`U:\say "hi".jpg`,
+		"U:\\two\nlines.jpg",
+		`'=cmd|' /C calc'!A0`,
+		`'+1.jpg`,
+		`'-1.jpg`,
+		`'@SUM(A1).jpg`,
+	}
+	for i, row := range rows[1:] {
+		if row[0] != want[i] {
+			t.Errorf("path %d = %q, want %q", i, row[0], want[i])
+		}
+		if row[1] != "7" || row[2] != "'=HYPERLINK()" {
+			t.Errorf("row %d = %q", i, row)
+		}
+	}
+}
+
+func TestWriteHTMLEscapes(t *testing.T) {
+	r := New(Scan, "Báo cáo <test>")
+	r.Add(Entry{Path: `U:\<script>alert("x")</script>&.jpg`, Reason: "<b>", Result: Failed, Error: "<img src=x>"})
+	var buf bytes.Buffer
+	if err := r.Write(&buf, HTML); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, raw := range []string{"<script>", "<b>", "<img", "<test>"} {
+		if strings.Contains(page, raw) {
+			t.Errorf("page contains unescaped %q", raw)
+		}
+	}
+	if !strings.Contains(page, "&lt;script&gt;") {
+		t.Error("file name missing from the page")
+	}
+}
@@ -0,0 +1,11 @@
+package scanner
+
+// Attributes reads and changes file attributes that fs.FS does not expose.
+// Tests can replace it to fake hidden files.
+type Attributes interface {
+	IsHidden(path string) bool
+	SetHidden(path string, hidden bool) error
+}
+
+// System is the Attributes implementation of the running platform
+var System Attributes = systemAttrs{}
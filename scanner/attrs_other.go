@@ -0,0 +1,19 @@
+//go:build !windows
+
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// systemAttrs treats dot files as hidden outside Windows
+type systemAttrs struct{}
+
+func (systemAttrs) IsHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+func (systemAttrs) SetHidden(path string, hidden bool) error {
+	return nil
+}
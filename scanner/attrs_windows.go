@@ -0,0 +1,41 @@
+package scanner
+
+import "syscall"
+
+const (
+	FILE_ATTRIBUTE_HIDDEN = 0x02
+)
+
+// systemAttrs reads attributes with GetFileAttributes
+type systemAttrs struct{}
+
+func (systemAttrs) IsHidden(path string) bool {
+	pointer, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	attrs, err := syscall.GetFileAttributes(pointer)
+	if err != nil {
+		return false
+	}
+	return attrs&FILE_ATTRIBUTE_HIDDEN != 0
+}
+
+func (systemAttrs) SetHidden(path string, hidden bool) error {
+	pointer, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attrs, err := syscall.GetFileAttributes(pointer)
+	if err != nil {
+		return err
+	}
+	want := attrs &^ FILE_ATTRIBUTE_HIDDEN
+	if hidden {
+		want |= FILE_ATTRIBUTE_HIDDEN
+	}
+	if want == attrs {
+		return nil
+	}
+	return syscall.SetFileAttributes(pointer, want)
+}
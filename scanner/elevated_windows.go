@@ -0,0 +1,14 @@
+package scanner
+
+import "os"
+
+// IsElevated reports whether the process runs as administrator. Opening the
+// first physical drive is only allowed to elevated processes.
+func IsElevated() bool {
+	f, err := os.Open(`\\.\PHYSICALDRIVE0`)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
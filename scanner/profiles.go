@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Profile is a local user profile directory
+type Profile struct {
+	User string `json:"user"`
+	Dir  string `json:"dir"`
+}
+
+// skipProfiles are the built-in profile folders that no teller logs into
+var skipProfiles = map[string]bool{
+	"default":      true,
+	"default user": true,
+	"public":       true,
+	"all users":    true,
+}
+
+// UsersRoot returns the folder holding the profiles, e.g. C:\Users
+func UsersRoot() string {
+	if p := os.Getenv("USERPROFILE"); p != "" {
+		return filepath.Dir(p)
+	}
+	return filepath.Join(os.Getenv("SystemDrive")+`\`, "Users")
+}
+
+// Profiles lists the user profiles under usersRoot, skipping Default and Public.
+// Reading other users' profiles requires running elevated.
+func Profiles(usersRoot string) ([]Profile, error) {
+	entries, err := os.ReadDir(usersRoot)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Profile
+	for _, e := range entries {
+		// Default User and All Users are junctions, not directories
+		if !e.IsDir() || skipProfiles[strings.ToLower(e.Name())] {
+			continue
+		}
+		profiles = append(profiles, Profile{User: e.Name(), Dir: filepath.Join(usersRoot, e.Name())})
+	}
+	return profiles, nil
+}
+
+// CurrentProfile returns the profile of the user running the scan
+func CurrentProfile() Profile {
+	dir := os.Getenv("USERPROFILE")
+	user := os.Getenv("USERNAME")
+	if user == "" {
+		user = filepath.Base(dir)
+	}
+	return Profile{User: user, Dir: dir}
+}
+
+// scanRoot is a rule root expanded for one profile
+type scanRoot struct {
+	path string
+	user string
+}
+
+// rootsFor expands the roots of a rule. Roots that reference %USERPROFILE%
+// are expanded once per profile; the others once for the current user.
+func rootsFor(rule *Rule, profiles []Profile) []scanRoot {
+	var roots []scanRoot
+	for _, r := range rule.Roots {
+		if len(profiles) == 0 || !strings.Contains(strings.ToUpper(r), "%USERPROFILE%") {
+			roots = append(roots, scanRoot{path: expandEnv(r), user: CurrentProfile().User})
+			continue
+		}
+		for _, p := range profiles {
+			path := expandEnvWith(r, map[string]string{"USERPROFILE": p.Dir, "USERNAME": p.User})
+			roots = append(roots, scanRoot{path: path, user: p.User})
+		}
+	}
+	return roots
+}
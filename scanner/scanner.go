@@ -1,140 +1,290 @@
 package scanner
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"time"
 )
 
 // FileInfo contains information about a found file
 type FileInfo struct {
-	Path     string
-	IsHidden bool
-	Size     int64
+	Path     string `json:"path"`
+	IsHidden bool   `json:"hidden"`
+	Size     int64  `json:"size"`
+	Rule     string `json:"rule"`
+	User     string `json:"user"`
 }
 
-const (
-	FILE_ATTRIBUTE_HIDDEN = 0x02
-)
+// Options configures a scan
+type Options struct {
+	Rules *RuleSet
+	// Attrs answers the hidden attribute check, System when nil
+	Attrs Attributes
+	// Open returns the filesystem rooted at a scan path, os.DirFS when nil
+	Open func(root string) fs.FS
+	// Profiles expands %USERPROFILE% roots for every listed user instead of
+	// only the current one
+	Profiles []Profile
+}
 
-// IsHidden checks if a file has the hidden attribute on Windows
-func IsHidden(path string) bool {
-	pointer, err := syscall.UTF16PtrFromString(path)
-	if err != nil {
-		return false
+// Progress counts what a scan has visited so far
+type Progress struct {
+	Dirs    int    `json:"dirs"`
+	Files   int    `json:"files"`
+	Errors  int    `json:"errors"`
+	Current string `json:"current"`
+}
+
+// Event is sent while a scan runs. Found is set when a file matched,
+// otherwise the event only carries updated counters.
+type Event struct {
+	Found    *FileInfo
+	Progress Progress
+}
+
+// DirError is a directory that could not be read
+type DirError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Summary is returned when a scan ends
+type Summary struct {
+	Files    []FileInfo    `json:"files"`
+	Progress Progress      `json:"progress"`
+	Errors   []DirError    `json:"errors"`
+	Canceled bool          `json:"canceled"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// ByUser groups the found files by profile
+func (s *Summary) ByUser() map[string][]FileInfo {
+	groups := make(map[string][]FileInfo)
+	for _, f := range s.Files {
+		groups[f.User] = append(groups[f.User], f)
+	}
+	return groups
+}
+
+// ruleRoot is one expanded root of a rule
+type ruleRoot struct {
+	rule *Rule
+	root scanRoot
+}
+
+// walkRoot is a folder walked once for every rule root at or below it
+type walkRoot struct {
+	path  string
+	rules []ruleRoot
+}
+
+// walkRoots expands the roots of every rule and folds roots that lie inside
+// another one into the outer walk, so that overlapping roots such as
+// VirtualStore and VirtualStore\Windows visit each file once
+func walkRoots(rules *RuleSet, profiles []Profile) []*walkRoot {
+	var all []ruleRoot
+	for i := range rules.Rules {
+		for _, root := range rootsFor(&rules.Rules[i], profiles) {
+			all = append(all, ruleRoot{&rules.Rules[i], root})
+		}
 	}
-	attrs, err := syscall.GetFileAttributes(pointer)
-	if err != nil {
-		return false
+
+	var walks []*walkRoot
+	for _, rr := range all {
+		outer := true
+		for _, other := range all {
+			if _, ok := relDepth(rr.root.path, other.root.path); ok && !samePath(rr.root.path, other.root.path) {
+				outer = false
+				break
+			}
+		}
+		if !outer {
+			continue
+		}
+		known := false
+		for _, w := range walks {
+			if samePath(w.path, rr.root.path) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			walks = append(walks, &walkRoot{path: rr.root.path})
+		}
+	}
+	for _, w := range walks {
+		for _, rr := range all {
+			if _, ok := relDepth(rr.root.path, w.path); ok {
+				w.rules = append(w.rules, rr)
+			}
+		}
 	}
-	return attrs&FILE_ATTRIBUTE_HIDDEN != 0
+	return walks
 }
 
-// shouldSkip determines if a directory should be skipped during scanning
-func shouldSkip(path string) bool {
-	lower := strings.ToLower(path)
-	
-	// Skip Windows directory
-	if strings.HasPrefix(lower, "c:\\windows") {
-		return true
+// relDepth reports whether path is root or lies below it, and how many
+// levels below. Paths are compared case-insensitively like Windows does.
+func relDepth(path, root string) (int, bool) {
+	rel, err := filepath.Rel(strings.ToLower(filepath.Clean(root)), strings.ToLower(filepath.Clean(path)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return 0, false
 	}
-	
-	// Skip other system directories that may cause issues
-	skipDirs := []string{
-		"c:\\$recycle.bin",
-		"c:\\system volume information",
-		"c:\\recovery",
-		"c:\\programdata\\microsoft\\windows",
+	if rel == "." {
+		return 0, true
 	}
-	
-	for _, skip := range skipDirs {
-		if strings.HasPrefix(lower, skip) {
+	return strings.Count(rel, string(filepath.Separator)) + 1, true
+}
+
+func samePath(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
+
+// enter reports whether a directory of the walk may still hold files of one
+// of its rule roots: it leads to a nested root or is within the depth limit
+func (w *walkRoot) enter(dir string) bool {
+	for _, rr := range w.rules {
+		if _, ok := relDepth(rr.root.path, dir); ok {
+			return true
+		}
+		depth, ok := relDepth(dir, rr.root.path)
+		if ok && (rr.rule.MaxDepth == 0 || depth < rr.rule.MaxDepth) {
 			return true
 		}
 	}
-	
 	return false
 }
 
-// GetScanPaths returns the paths to scan for IPCAS2.ini
-func GetScanPaths() []string {
-	userProfile := os.Getenv("USERPROFILE")
-	paths := []string{
-		filepath.Join(userProfile, "AppData", "Local", "VirtualStore", "Windows"),
-		filepath.Join(userProfile, "AppData", "Local", "VirtualStore"),
+// Scan walks the roots of every rule and reports matching files. Found
+// files and progress are sent on events, which may be nil, as they are
+// discovered. When ctx is canceled the partial summary is returned with
+// ctx.Err().
+func Scan(ctx context.Context, opts Options, events chan<- Event) (*Summary, error) {
+	start := time.Now()
+	sum := &Summary{Files: []FileInfo{}, Errors: []DirError{}}
+	rules := opts.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+	attrs := opts.Attrs
+	if attrs == nil {
+		attrs = System
+	}
+	open := opts.Open
+	if open == nil {
+		open = func(root string) fs.FS { return os.DirFS(root) }
 	}
-	return paths
-}
 
-// ScanForIPCAS2 scans specific folders for hidden IPCAS2.ini files
-// progressCallback is called with the current path being scanned
-func ScanForIPCAS2(progressCallback func(string), stopChan <-chan struct{}) ([]FileInfo, error) {
-	var results []FileInfo
-	targetName := "ipcas2.ini"
-	scanPaths := GetScanPaths()
+	emit := func(ev Event) {
+		if events == nil {
+			return
+		}
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	for _, w := range walkRoots(rules, opts.Profiles) {
+		rootPath := w.path
+		fsys := open(rootPath)
 
-	for _, scanRoot := range scanPaths {
 		// Check if path exists
-		if _, err := os.Stat(scanRoot); os.IsNotExist(err) {
+		if _, err := fs.Stat(fsys, "."); err != nil {
 			continue
 		}
 
-		filepath.Walk(scanRoot, func(path string, info os.FileInfo, err error) error {
+		fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
 			// Check if stop was requested
-			select {
-			case <-stopChan:
-				return filepath.SkipAll
-			default:
+			if ctx.Err() != nil {
+				return fs.SkipAll
 			}
 
+			path := filepath.Join(rootPath, filepath.FromSlash(name))
+
 			if err != nil {
+				sum.Progress.Errors++
+				sum.Errors = append(sum.Errors, DirError{Path: path, Error: err.Error()})
 				// Skip directories we can't access
-				if info != nil && info.IsDir() {
-					return filepath.SkipDir
+				if d != nil && d.IsDir() && name != "." {
+					return fs.SkipDir
 				}
 				return nil
 			}
 
-			// Report progress for directories
-			if info.IsDir() {
-				if progressCallback != nil {
-					progressCallback(path)
+			if d.IsDir() {
+				if shouldSkip(path, rules.Skip) || !w.enter(path) {
+					return fs.SkipDir
 				}
+				sum.Progress.Dirs++
+				sum.Progress.Current = path
+				emit(Event{Progress: sum.Progress})
 				return nil
 			}
 
-			// Check if this is the target file
-			if strings.ToLower(info.Name()) == targetName {
-				// Check if it's hidden
-				isHidden := IsHidden(path)
-				if isHidden {
-					results = append(results, FileInfo{
-						Path:     path,
-						IsHidden: isHidden,
-						Size:     info.Size(),
-					})
+			sum.Progress.Files++
+
+			var size int64
+			if info, err := d.Info(); err == nil {
+				size = info.Size()
+			}
+			// The attribute check is a system call; ask at most once per file
+			checked, isHidden := false, false
+			hidden := func() bool {
+				if !checked {
+					isHidden, checked = attrs.IsHidden(path), true
 				}
+				return isHidden
 			}
 
+			// The first rule that matches claims the file
+			for _, rr := range w.rules {
+				depth, ok := relDepth(path, rr.root.path)
+				if !ok || (rr.rule.MaxDepth > 0 && depth > rr.rule.MaxDepth) {
+					continue
+				}
+				if !rr.rule.match(d.Name(), size, hidden) {
+					continue
+				}
+				f := FileInfo{Path: path, IsHidden: hidden(), Size: size, Rule: rr.rule.Name, User: rr.root.user}
+				sum.Files = append(sum.Files, f)
+				emit(Event{Found: &f, Progress: sum.Progress})
+				break
+			}
 			return nil
 		})
 	}
 
-	return results, nil
+	sum.Elapsed = time.Since(start)
+	if err := ctx.Err(); err != nil {
+		sum.Canceled = true
+		return sum, err
+	}
+	return sum, nil
+}
+
+// FormatSize renders a byte count as B, KB or MB
+func FormatSize(s int64) string {
+	if s >= 1048576 {
+		return fmt.Sprintf("%.1f MB", float64(s)/1048576)
+	}
+	if s >= 1024 {
+		return fmt.Sprintf("%.1f KB", float64(s)/1024)
+	}
+	return fmt.Sprintf("%d B", s)
+}
+
+// IsHidden checks if a file has the hidden attribute
+func IsHidden(path string) bool {
+	return System.IsHidden(path)
 }
 
 // DeleteFile removes a file from the filesystem
 func DeleteFile(path string) error {
 	// Try to remove hidden attribute first
-	pointer, err := syscall.UTF16PtrFromString(path)
-	if err == nil {
-		attrs, err := syscall.GetFileAttributes(pointer)
-		if err == nil && attrs&FILE_ATTRIBUTE_HIDDEN != 0 {
-			// Remove hidden attribute
-			syscall.SetFileAttributes(pointer, attrs&^FILE_ATTRIBUTE_HIDDEN)
-		}
-	}
-
+	System.SetHidden(path, false)
 	return os.Remove(path)
 }
@@ -0,0 +1,173 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeAttrs marks the listed paths hidden and counts the lookups
+type fakeAttrs struct {
+	hidden map[string]bool
+	calls  map[string]int
+}
+
+func (a *fakeAttrs) IsHidden(path string) bool {
+	a.calls[filepath.ToSlash(path)]++
+	return a.hidden[filepath.ToSlash(path)]
+}
+
+func (a *fakeAttrs) SetHidden(path string, hidden bool) error { return nil }
+
+// scanMap runs rules over a MapFS whose top-level folders are the roots
+func scanMap(t *testing.T, ctx context.Context, fsys fstest.MapFS, rules *RuleSet, hidden ...string) (*Summary, *fakeAttrs, error) {
+	t.Helper()
+	attrs := &fakeAttrs{hidden: map[string]bool{}, calls: map[string]int{}}
+	for _, h := range hidden {
+		attrs.hidden[h] = true
+	}
+	opts := Options{
+		Rules: rules,
+		Attrs: attrs,
+		Open: func(root string) fs.FS {
+			sub, err := fs.Sub(fsys, filepath.ToSlash(root))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sub
+		},
+	}
+	sum, err := Scan(ctx, opts, nil)
+	return sum, attrs, err
+}
+
+func found(sum *Summary) map[string]string {
+	got := map[string]string{}
+	for _, f := range sum.Files {
+		got[filepath.ToSlash(f.Path)] = f.Rule
+	}
+	return got
+}
+
+func TestScanOverlappingRoots(t *testing.T) {
+	hidden := true
+	fsys := fstest.MapFS{
+		"vs/IPCAS2.ini":         {Data: []byte("a")},
+		"vs/Windows/IPCAS2.ini": {Data: []byte("b")},
+		"vs/Windows/other.txt":  {Data: []byte("c")},
+	}
+	rules := &RuleSet{Rules: []Rule{{
+		Name:    "ini",
+		Pattern: "ipcas2.ini",
+		Hidden:  &hidden,
+		Roots:   []string{"vs/Windows", "vs"},
+	}}}
+
+	sum, attrs, err := scanMap(t, context.Background(), fsys, rules, "vs/Windows/IPCAS2.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := found(sum); len(got) != 1 || got["vs/Windows/IPCAS2.ini"] != "ini" {
+		t.Errorf("found %v", got)
+	}
+	if sum.Progress.Files != 3 || sum.Progress.Dirs != 2 {
+		t.Errorf("progress = %+v, want each file and folder counted once", sum.Progress)
+	}
+	for path, n := range attrs.calls {
+		if n > 1 {
+			t.Errorf("IsHidden(%s) called %d times", path, n)
+		}
+	}
+	if attrs.calls["vs/Windows/other.txt"] != 0 {
+		t.Error("IsHidden called for a file the pattern already rejects")
+	}
+}
+
+func TestScanRuleFilters(t *testing.T) {
+	fsys := fstest.MapFS{
+		"c/IPCAS2.ini":                {Data: []byte("x")},
+		"c/deep/IPCAS2.ini":           {Data: []byte("x")},
+		"c/skipme/IPCAS2.ini":         {Data: []byte("x")},
+		"vs/Program Files/A.DLL":      {Data: []byte("x")},
+		"vs/Program Files/e.dll":      {},
+		"vs/Program Files/kebtmp.ini": {Data: []byte("x")},
+		"vs/Program Files/sub/b.dll":  {Data: []byte("x")},
+	}
+	rules := &RuleSet{
+		Rules: []Rule{
+			{Name: "kebtmp", Pattern: "kebtmp.ini", Roots: []string{"vs"}},
+			{Name: "dll", Pattern: "*.dll", Roots: []string{"vs/Program Files"}, MinSize: 1, MaxDepth: 1},
+			{Name: "shallow", Pattern: "ipcas2.ini", Roots: []string{"c"}, MaxDepth: 1},
+			{Name: "deep", Pattern: "ipcas2.ini", Roots: []string{"c/deep"}},
+		},
+		Skip: []string{filepath.FromSlash("c/skipme")},
+	}
+
+	sum, _, err := scanMap(t, context.Background(), fsys, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"c/IPCAS2.ini":                "shallow",
+		"c/deep/IPCAS2.ini":           "deep",
+		"vs/Program Files/A.DLL":      "dll",
+		"vs/Program Files/kebtmp.ini": "kebtmp",
+	}
+	got := found(sum)
+	if len(got) != len(want) {
+		t.Errorf("found %v, want %v", keys(got), keys(want))
+	}
+	for p, rule := range want {
+		if got[p] != rule {
+			t.Errorf("%s: rule %q, want %q", p, got[p], rule)
+		}
+	}
+}
+
+func TestScanCanceled(t *testing.T) {
+	fsys := fstest.MapFS{"vs/IPCAS2.ini": {Data: []byte("x")}}
+	rules := &RuleSet{Rules: []Rule{{Name: "ini", Pattern: "ipcas2.ini", Roots: []string{"vs"}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sum, _, err := scanMap(t, ctx, fsys, rules)
+	if !errors.Is(err, context.Canceled) || !sum.Canceled || len(sum.Files) != 0 {
+		t.Errorf("sum = %+v, err = %v", sum, err)
+	}
+}
+
+func TestScanEvents(t *testing.T) {
+	fsys := fstest.MapFS{"vs/IPCAS2.ini": {Data: []byte("x")}}
+	rules := &RuleSet{Rules: []Rule{{Name: "ini", Pattern: "ipcas2.ini", Roots: []string{"vs"}}}}
+	events := make(chan Event, 16)
+	opts := Options{Rules: rules, Attrs: &fakeAttrs{calls: map[string]int{}}, Open: func(root string) fs.FS {
+		sub, _ := fs.Sub(fsys, root)
+		return sub
+	}}
+	if _, err := Scan(context.Background(), opts, events); err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+	n := 0
+	for ev := range events {
+		if ev.Found != nil {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d found events, want 1", n)
+	}
+}
+
+func keys(m map[string]string) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ipcas2-scanner/ipcasini"
+	"ipcas2-scanner/netdrive"
+	"ipcas2-scanner/quarantine"
+	"ipcas2-scanner/region"
+	"ipcas2-scanner/scanner"
+	"ipcas2-scanner/shutdown"
+	"ipcas2-scanner/static"
+	"ipcas2-scanner/update"
+)
+
+// tokenCookie carries the access token after the page was opened once
+const tokenCookie = "ipc_token"
+
+// response is the envelope static/index.html expects
+type response struct {
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message"`
+}
+
+// Config locates the files the API works on
+type Config struct {
+	Update    update.Paths
+	ScanRules string
+	// Quarantine receives deleted files
+	Quarantine *quarantine.Store
+}
+
+// Server serves the browser UI and its JSON API
+type Server struct {
+	token    string
+	paths    update.Paths
+	rules    string
+	quar     *quarantine.Store
+	mux      *http.ServeMux
+	mu       sync.Mutex
+	lastScan map[string]string
+}
+
+// NewToken returns a random access token
+func NewToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// New returns a server that requires token on every request
+func New(token string, cfg Config) *Server {
+	s := &Server{token: token, paths: cfg.Update, rules: cfg.ScanRules, quar: cfg.Quarantine, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/api/scan", s.handleScan)
+	s.mux.HandleFunc("/api/delete", s.handleDelete)
+	s.mux.HandleFunc("/api/shutdown", s.handleShutdown)
+	s.mux.HandleFunc("/api/shutdown/cancel", s.handleShutdownCancel)
+	s.mux.HandleFunc("/api/network/list", s.handleNetworkList)
+	s.mux.HandleFunc("/api/network/map", s.handleNetworkMap)
+	s.mux.HandleFunc("/api/network/unmap", s.handleNetworkUnmap)
+	s.mux.HandleFunc("/api/update/check", s.handleUpdateCheck)
+	s.mux.HandleFunc("/api/update/apply", s.handleUpdateApply)
+	s.mux.HandleFunc("/api/ini", s.handleINI)
+	s.mux.HandleFunc("/api/region", s.handleRegion)
+	s.mux.HandleFunc("/api/region/apply", s.handleRegionApply)
+	return s
+}
+
+// Listen opens addr for Serve. Only loopback addresses are accepted.
+func Listen(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("refusing to listen on non-loopback address %s", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Serve handles requests on l until it fails
+func (s *Server) Serve(l net.Listener) error {
+	return http.Serve(l, s)
+}
+
+// ServeHTTP checks the token, then dispatches to the handlers. The token is
+// accepted from the X-Auth-Token header, the token query parameter or the
+// cookie set when the page is first opened with ?token=.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Auth-Token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		if c, err := r.Cookie(tokenCookie); err == nil {
+			token = c.Value
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    s.token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response{Data: data, Message: message})
+}
+
+// requirePost rejects requests that change state through GET
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, nil, "Chỉ hỗ trợ POST")
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := static.Files.ReadFile("index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+type scanItem struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SizeStr string `json:"sizeStr"`
+	User    string `json:"user"`
+}
+
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	rules, err := scanner.LoadRules(s.rules)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, nil, "Lỗi: "+err.Error())
+		return
+	}
+	opts := scanner.Options{Rules: rules}
+	if r.URL.Query().Get("all_users") == "1" {
+		if !scanner.IsElevated() {
+			writeJSON(w, http.StatusForbidden, nil, "Cần chạy với quyền Admin để quét tất cả người dùng")
+			return
+		}
+		if opts.Profiles, err = scanner.Profiles(scanner.UsersRoot()); err != nil {
+			writeJSON(w, http.StatusInternalServerError, nil, "Lỗi: "+err.Error())
+			return
+		}
+	}
+	sum, err := scanner.Scan(r.Context(), opts, nil)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, nil, "Lỗi: "+err.Error())
+		return
+	}
+
+	items := []scanItem{}
+	found := make(map[string]string)
+	for _, f := range sum.Files {
+		items = append(items, scanItem{f.Path, f.Size, scanner.FormatSize(f.Size), f.User})
+		found[f.Path] = f.Rule
+	}
+	s.mu.Lock()
+	s.lastScan = found
+	s.mu.Unlock()
+
+	if len(items) == 0 {
+		writeJSON(w, http.StatusOK, items, "Không tìm thấy file nào")
+		return
+	}
+	if len(opts.Profiles) > 0 {
+		writeJSON(w, http.StatusOK, items, fmt.Sprintf("Tìm thấy %d file / %d người dùng", len(items), len(sum.ByUser())))
+		return
+	}
+	writeJSON(w, http.StatusOK, items, fmt.Sprintf("Tìm thấy %d file", len(items)))
+}
+
+// handleDelete quarantines paths returned by the previous scan, and only those
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	var paths []string
+	if err := json.NewDecoder(r.Body).Decode(&paths); err != nil {
+		writeJSON(w, http.StatusBadRequest, nil, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, p := range paths {
+		rule, ok := s.lastScan[p]
+		if !ok {
+			continue
+		}
+		if _, err := s.quar.Add(p, rule); err == nil {
+			delete(s.lastScan, p)
+			deleted++
+		}
+	}
+	writeJSON(w, http.StatusOK, deleted, fmt.Sprintf("Đã chuyển %d file vào thư mục cách ly", deleted))
+}
+
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	m, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("minutes")))
+	if m <= 0 {
+		writeJSON(w, http.StatusBadRequest, nil, "Vui lòng nhập số phút hợp lệ")
+		return
+	}
+	at, err := shutdown.Schedule(m)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, nil, "Không thể đặt hẹn giờ: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, at, "Máy sẽ tắt lúc "+at.Format("15:04"))
+}
+
+func (s *Server) handleShutdownCancel(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if err := shutdown.Cancel(); err != nil {
+		writeJSON(w, http.StatusOK, nil, "Chưa có hẹn giờ nào")
+		return
+	}
+	writeJSON(w, http.StatusOK, nil, "Đã hủy hẹn giờ")
+}
+
+func (s *Server) handleNetworkList(w http.ResponseWriter, r *http.Request) {
+	drives := []string{}
+	for _, m := range netdrive.List() {
+		if m.Remote == "" {
+			drives = append(drives, m.Drive)
+			continue
+		}
+		drives = append(drives, m.Drive+" → "+m.Remote)
+	}
+	writeJSON(w, http.StatusOK, drives, "")
+}
+
+func (s *Server) handleNetworkMap(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	drive := r.URL.Query().Get("drive")
+	path := strings.TrimSpace(r.URL.Query().Get("path"))
+	if drive == "" || path == "" {
+		writeJSON(w, http.StatusBadRequest, nil, "Vui lòng nhập đường dẫn mạng")
+		return
+	}
+	if err := netdrive.Map(drive, path); err != nil {
+		writeJSON(w, http.StatusOK, nil, "Lỗi: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, nil, "Đã kết nối "+drive+" → "+path)
+}
+
+func (s *Server) handleNetworkUnmap(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	drive := r.URL.Query().Get("drive")
+	if err := netdrive.Unmap(drive); err != nil {
+		writeJSON(w, http.StatusOK, nil, "Lỗi: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, nil, "Đã ngắt "+drive)
+}
+
+func (s *Server) handleUpdateCheck(w http.ResponseWriter, r *http.Request) {
+	src := s.paths.SourcePath()
+	m, changes, published, err := update.Check(src, s.paths.Target, s.paths.KeyFile)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, nil, "Lỗi: "+err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"source":    src,
+		"installed": update.ReadInstalled(s.paths.StateFile).Version,
+		"available": m.Version,
+		"published": published,
+		"changes":   changes,
+	}
+	if len(changes) == 0 {
+		writeJSON(w, http.StatusOK, data, "Đã cập nhật mới nhất")
+		return
+	}
+	writeJSON(w, http.StatusOK, data, fmt.Sprintf("Có %d file cần cập nhật", len(changes)))
+}
+
+func (s *Server) handleUpdateApply(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	src := s.paths.SourcePath()
+	m, changes, _, err := update.Check(src, s.paths.Target, s.paths.KeyFile)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, nil, "Lỗi: "+err.Error())
+		return
+	}
+	if len(changes) == 0 {
+		writeJSON(w, http.StatusOK, &update.Result{Version: m.Version}, "Đã cập nhật mới nhất")
+		return
+	}
+
+	backup := r.URL.Query().Get("backup") == "1"
+	_, res, err := update.Install(m, changes, update.Options{SourceDir: src}, s.paths, backup)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, res, "Cập nhật thất bại: "+err.Error())
+		return
+	}
+	update.StartIPCAS(s.paths.Target)
+	writeJSON(w, http.StatusOK, res, fmt.Sprintf("Đã cập nhật %d file", len(res.Updated)))
+}
+
+func (s *Server) handleINI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		if !requirePost(w, r) {
+			return
+		}
+		var cfg ipcasini.Settings
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeJSON(w, http.StatusBadRequest, nil, "Dữ liệu không hợp lệ")
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, nil, "Lỗi: "+err.Error())
+			return
+		}
+		if err := ipcasini.Write(ipcasini.Path, cfg); err != nil {
+			writeJSON(w, http.StatusInternalServerError, nil, "Không thể ghi file. Chạy với quyền Admin!")
+			return
+		}
+		writeJSON(w, http.StatusOK, cfg, "Đã lưu cấu hình IPCAS2.ini")
+		return
+	}
+
+	cfg, err := ipcasini.Read(ipcasini.Path)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, nil, "File chưa tồn tại")
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg, "Đã tải cấu hình")
+}
+
+func (s *Server) handleRegion(w http.ResponseWriter, r *http.Request) {
+	cur := region.Read()
+	if cur == region.IPCAS2 {
+		writeJSON(w, http.StatusOK, cur, "Đúng chuẩn IPCAS2")
+		return
+	}
+	writeJSON(w, http.StatusOK, cur, "Chưa đúng chuẩn IPCAS2")
+}
+
+func (s *Server) handleRegionApply(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if err := region.ApplyIPCAS2(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, region.Read(), "Lỗi: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, region.Read(), "Đã cập nhật Region Format. Cần restart máy.")
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStateChangesRequirePost(t *testing.T) {
+	s := New("secret", Config{})
+	for _, path := range []string{
+		"/api/delete",
+		"/api/shutdown?minutes=5",
+		"/api/shutdown/cancel",
+		"/api/network/map?drive=U:&path=%5C%5Chost%5Cshare",
+		"/api/network/unmap?drive=U:",
+		"/api/update/apply",
+		"/api/region/apply",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Auth-Token", "secret")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, http.StatusMethodNotAllowed)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/ini", nil)
+	req.Header.Set("X-Auth-Token", "secret")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /api/ini = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestTokenRequired(t *testing.T) {
+	s := New("secret", Config{})
+	req := httptest.NewRequest(http.MethodPost, "/api/shutdown/cancel", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("no token = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
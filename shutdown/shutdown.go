@@ -0,0 +1,25 @@
+package shutdown
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Schedule asks Windows to shut down after the given number of minutes and
+// returns the planned time
+func Schedule(minutes int) (time.Time, error) {
+	if minutes <= 0 {
+		return time.Time{}, errors.New("minutes must be positive")
+	}
+	if err := exec.Command("shutdown", "/s", "/t", strconv.Itoa(minutes*60)).Run(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(time.Duration(minutes) * time.Minute), nil
+}
+
+// Cancel aborts a pending shutdown. It fails when none is scheduled.
+func Cancel() error {
+	return exec.Command("shutdown", "/a").Run()
+}
@@ -0,0 +1,9 @@
+// Package static holds the browser UI served by the HTTP mode
+package static
+
+import "embed"
+
+// Files contains index.html
+//
+//go:embed index.html
+var Files embed.FS
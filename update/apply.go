@@ -0,0 +1,208 @@
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Failure describes a file that could not be updated
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Result is the structured outcome of Apply
+type Result struct {
+	Version    string    `json:"version"`
+	Updated    []string  `json:"updated"`
+	Skipped    []string  `json:"skipped"`
+	Failed     []Failure `json:"failed"`
+	RolledBack []string  `json:"rolled_back"`
+	// Staging is set when a rollback failed and the staging directory was
+	// kept, because its old folder holds the only copy of the replaced files
+	Staging string `json:"staging,omitempty"`
+}
+
+// OK reports whether every change was applied
+func (r *Result) OK() bool {
+	return len(r.Failed) == 0
+}
+
+// ErrStagingKept refuses an update while the files of an earlier
+// incomplete rollback are still waiting in the staging directory
+var ErrStagingKept = errors.New("original files of a failed rollback are still in staging")
+
+// Options configures Apply
+type Options struct {
+	SourceDir string
+	TargetDir string
+	// StagingDir defaults to a Staging folder next to TargetDir so that the
+	// final swap is a rename on the same volume
+	StagingDir string
+	// Progress is called after each file of the "stage" and "swap" phases
+	Progress func(phase string, done, total int, path string)
+}
+
+func (o *Options) progress(phase string, done, total int, path string) {
+	if o.Progress != nil {
+		o.Progress(phase, done, total, path)
+	}
+}
+
+// Apply copies every change into a staging directory, verifies the hashes
+// against the manifest, then swaps the files into TargetDir with renames.
+// If any step of the swap fails the previous files are restored.
+func Apply(m *Manifest, changes []Change, opt Options) (*Result, error) {
+	res := &Result{Version: m.Version}
+
+	staging := opt.StagingDir
+	if staging == "" {
+		staging = filepath.Join(filepath.Dir(opt.TargetDir), "Staging")
+	}
+	newDir := filepath.Join(staging, "new")
+	oldDir := filepath.Join(staging, "old")
+
+	for _, c := range changes {
+		if _, err := localPath(c.Path); err != nil {
+			res.Failed = append(res.Failed, Failure{c.Path, err.Error()})
+			return res, err
+		}
+	}
+
+	// An old folder left by an incomplete rollback is the only copy of the
+	// files it holds: someone has to put them back before the next update
+	if _, err := os.Stat(oldDir); err == nil {
+		res.Staging = staging
+		return res, fmt.Errorf("%w: %s", ErrStagingKept, oldDir)
+	}
+	os.RemoveAll(staging)
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return res, err
+	}
+
+	pending := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		pending[c.Path] = true
+	}
+	for _, e := range m.Files {
+		if !pending[e.Path] {
+			res.Skipped = append(res.Skipped, e.Path)
+		}
+	}
+
+	// Stage and verify everything before touching TargetDir
+	for i, c := range changes {
+		rel := filepath.FromSlash(c.Path)
+		if err := stageFile(filepath.Join(opt.SourceDir, rel), filepath.Join(newDir, rel), c.FileEntry); err != nil {
+			res.Failed = append(res.Failed, Failure{c.Path, err.Error()})
+			os.RemoveAll(staging)
+			return res, fmt.Errorf("stage %s: %w", c.Path, err)
+		}
+		opt.progress("stage", i+1, len(changes), c.Path)
+	}
+
+	// Swap staged files in, remembering what was replaced
+	type swapped struct {
+		rel    string
+		hadOld bool
+		placed bool
+	}
+	var done []swapped
+	var swapErr error
+	for i, c := range changes {
+		rel := filepath.FromSlash(c.Path)
+		target := filepath.Join(opt.TargetDir, rel)
+		s := swapped{rel: rel}
+
+		if _, err := os.Stat(target); err == nil {
+			backup := filepath.Join(oldDir, rel)
+			os.MkdirAll(filepath.Dir(backup), 0755)
+			if err := os.Rename(target, backup); err != nil {
+				res.Failed = append(res.Failed, Failure{c.Path, err.Error()})
+				swapErr = fmt.Errorf("replace %s: %w", c.Path, err)
+				break
+			}
+			s.hadOld = true
+		}
+		done = append(done, s)
+
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if err := os.Rename(filepath.Join(newDir, rel), target); err != nil {
+			res.Failed = append(res.Failed, Failure{c.Path, err.Error()})
+			swapErr = fmt.Errorf("replace %s: %w", c.Path, err)
+			break
+		}
+		done[len(done)-1].placed = true
+		os.Chtimes(target, c.ModTime, c.ModTime)
+		opt.progress("swap", i+1, len(changes), c.Path)
+	}
+
+	if swapErr == nil {
+		for _, c := range changes {
+			res.Updated = append(res.Updated, c.Path)
+		}
+		os.RemoveAll(staging)
+		return res, nil
+	}
+
+	// Roll back in reverse order. Staging is only removed when every original
+	// file is back in place; otherwise staging/old holds the only copy.
+	kept := false
+	for i := len(done) - 1; i >= 0; i-- {
+		s := done[i]
+		target := filepath.Join(opt.TargetDir, s.rel)
+		if s.placed {
+			os.Remove(target)
+		}
+		if s.hadOld {
+			if err := os.Rename(filepath.Join(oldDir, s.rel), target); err != nil {
+				res.Failed = append(res.Failed, Failure{filepath.ToSlash(s.rel), "rollback: " + err.Error()})
+				kept = true
+				continue
+			}
+		}
+		res.RolledBack = append(res.RolledBack, filepath.ToSlash(s.rel))
+	}
+	if kept {
+		res.Staging = staging
+		return res, fmt.Errorf("%w; rollback incomplete, original files kept in %s", swapErr, oldDir)
+	}
+	os.RemoveAll(staging)
+	return res, swapErr
+}
+
+// stageFile copies src to dst and checks the copy against the manifest entry
+func stageFile(src, dst string, e FileEntry) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n != e.Size {
+		return fmt.Errorf("size mismatch: got %d, want %d", n, e.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != e.SHA256 {
+		return fmt.Errorf("hash mismatch: got %s, want %s", sum, e.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package update
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func applySetup(t *testing.T) (src, dst string, m *Manifest, changes []Change) {
+	t.Helper()
+	src, dst = t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "a.dll"), "new a")
+	writeFile(t, filepath.Join(src, "b.dll"), "new b")
+	writeFile(t, filepath.Join(dst, "a.dll"), "previous a")
+	writeFile(t, filepath.Join(dst, "b.dll"), "previous b")
+	m, err := BuildManifest(src, "2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src, dst, m, Diff(m, dst)
+}
+
+func TestApply(t *testing.T) {
+	src, dst, m, changes := applySetup(t)
+	staging := filepath.Join(t.TempDir(), "Staging")
+
+	res, err := Apply(m, changes, Options{SourceDir: src, TargetDir: dst, StagingDir: staging})
+	if err != nil || !res.OK() || len(res.Updated) != 2 {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "b.dll")); string(data) != "new b" {
+		t.Errorf("b.dll = %q", data)
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Error("staging left behind after a successful update")
+	}
+}
+
+func TestApplyRollsBack(t *testing.T) {
+	src, dst, m, changes := applySetup(t)
+	staging := filepath.Join(t.TempDir(), "Staging")
+
+	// Make the second swap fail
+	progress := func(phase string, done, total int, path string) {
+		if phase == "swap" && done == 1 {
+			os.Remove(filepath.Join(staging, "new", "b.dll"))
+		}
+	}
+	res, err := Apply(m, changes, Options{SourceDir: src, TargetDir: dst, StagingDir: staging, Progress: progress})
+	if err == nil {
+		t.Fatal("Apply succeeded although a swap failed")
+	}
+	if len(res.RolledBack) != 2 || res.Staging != "" {
+		t.Errorf("res = %+v", res)
+	}
+	for _, n := range []string{"a.dll", "b.dll"} {
+		if data, _ := os.ReadFile(filepath.Join(dst, n)); string(data) != "previous "+n[:1] {
+			t.Errorf("%s = %q after rollback", n, data)
+		}
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Error("staging left behind after a complete rollback")
+	}
+}
+
+func TestApplyKeepsStagingWhenRollbackFails(t *testing.T) {
+	src, dst, m, changes := applySetup(t)
+	staging := filepath.Join(t.TempDir(), "Staging")
+
+	// Make the second swap fail, and put a non-empty folder where a.dll has
+	// to be restored so that its rollback fails too
+	progress := func(phase string, done, total int, path string) {
+		if phase == "swap" && done == 1 {
+			os.Remove(filepath.Join(staging, "new", "b.dll"))
+			os.Remove(filepath.Join(dst, "a.dll"))
+			writeFile(t, filepath.Join(dst, "a.dll", "busy"), "")
+		}
+	}
+	res, err := Apply(m, changes, Options{SourceDir: src, TargetDir: dst, StagingDir: staging, Progress: progress})
+	if err == nil {
+		t.Fatal("Apply succeeded although a swap failed")
+	}
+	if res.Staging != staging {
+		t.Errorf("Staging = %q, want %q", res.Staging, staging)
+	}
+	if data, _ := os.ReadFile(filepath.Join(staging, "old", "a.dll")); string(data) != "previous a" {
+		t.Errorf("original a.dll lost: %q", data)
+	}
+}
+
+func TestApplyRefusesKeptStaging(t *testing.T) {
+	src, dst, m, changes := applySetup(t)
+	staging := filepath.Join(t.TempDir(), "Staging")
+	writeFile(t, filepath.Join(staging, "old", "a.dll"), "previous a")
+
+	res, err := Apply(m, changes, Options{SourceDir: src, TargetDir: dst, StagingDir: staging})
+	if !errors.Is(err, ErrStagingKept) || res.Staging != staging {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(staging, "old", "a.dll")); string(data) != "previous a" {
+		t.Errorf("kept a.dll = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "a.dll")); string(data) != "previous a" {
+		t.Errorf("target touched: a.dll = %q", data)
+	}
+}
+
+func TestInstallStopsOnBackupFailure(t *testing.T) {
+	src, dst, m, changes := applySetup(t)
+	blocked := filepath.Join(t.TempDir(), "Backup")
+	writeFile(t, blocked, "a file where the backup folder should be")
+
+	name, res, err := Install(m, changes, Options{SourceDir: src}, Paths{Target: dst, BackupDir: blocked}, true)
+	if err == nil || res != nil || name != "" {
+		t.Fatalf("name = %q, res = %+v, err = %v", name, res, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "a.dll")); string(data) != "previous a" {
+		t.Errorf("a.dll updated although the backup failed: %q", data)
+	}
+}
@@ -0,0 +1,151 @@
+package update
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxBackups is how many backup archives are kept
+const MaxBackups = 3
+
+// ListBackups returns the backup archives in dir, newest first
+func ListBackups(dir string) []string {
+	var backups []string
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), "BK_") && strings.HasSuffix(e.Name(), ".zip") {
+				backups = append(backups, e.Name())
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
+
+// Backup zips targetDir into backupDir and prunes archives beyond
+// MaxBackups. It returns the new archive name and the pruned ones. Older
+// archives are only pruned once the new one has been written completely; a
+// failed archive is removed.
+func Backup(targetDir, backupDir, version string) (name string, pruned []string, err error) {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", nil, err
+	}
+
+	name = fmt.Sprintf("BK_%s.zip", time.Now().Format("20060102_150405"))
+	if version != "" {
+		name = fmt.Sprintf("BK_%s_v%s.zip", time.Now().Format("20060102_150405"), safeName(version))
+	}
+	zipPath := filepath.Join(backupDir, name)
+
+	if err := writeZip(zipPath, targetDir); err != nil {
+		os.Remove(zipPath)
+		return "", nil, err
+	}
+
+	bkFiles := ListBackups(backupDir)
+	for i := MaxBackups; i < len(bkFiles); i++ {
+		if err := os.Remove(filepath.Join(backupDir, bkFiles[i])); err == nil {
+			pruned = append(pruned, bkFiles[i])
+		}
+	}
+	return name, pruned, nil
+}
+
+// writeZip archives every file under dir into zipPath
+func writeZip(zipPath, dir string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(zipFile)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := w.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(f, in)
+		return err
+	})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := zipFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Restore extracts a backup archive over targetDir and returns the restored
+// paths. Files that fail, or whose names would land outside targetDir, are
+// reported in errs and skipped.
+func Restore(zipPath, targetDir string, progress func(done, total int)) (restored []string, errs []Failure, err error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	total := len(r.File)
+	for i, f := range r.File {
+		rel, err := localPath(f.Name)
+		if err != nil {
+			errs = append(errs, Failure{f.Name, err.Error()})
+			continue
+		}
+		dstPath := filepath.Join(targetDir, rel)
+		os.MkdirAll(filepath.Dir(dstPath), 0755)
+
+		rc, err := f.Open()
+		if err != nil {
+			errs = append(errs, Failure{f.Name, err.Error()})
+			continue
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			errs = append(errs, Failure{f.Name, err.Error()})
+			continue
+		}
+
+		if err := os.WriteFile(dstPath, data, 0644); err != nil {
+			errs = append(errs, Failure{f.Name, err.Error()})
+			continue
+		}
+		restored = append(restored, f.Name)
+
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+	return restored, errs, nil
+}
+
+// safeName replaces characters that are not allowed in file names
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>| `, r) {
+			return '-'
+		}
+		return r
+	}, s)
+}
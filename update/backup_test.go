@@ -0,0 +1,67 @@
+package update
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	target, backups := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(target, "ipcas2.exe"), "exe")
+	writeFile(t, filepath.Join(target, "sub", "a.dll"), "dll")
+
+	name, _, err := Backup(target, backups, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreDir := t.TempDir()
+	restored, errs, err := Restore(filepath.Join(backups, name), restoreDir, nil)
+	if err != nil || len(errs) != 0 || len(restored) != 2 {
+		t.Fatalf("restored = %v, errs = %v, err = %v", restored, errs, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoreDir, "sub", "a.dll")); string(data) != "dll" {
+		t.Errorf("a.dll = %q", data)
+	}
+}
+
+func TestBackupKeepsOldArchivesOnFailure(t *testing.T) {
+	backups := t.TempDir()
+	for _, n := range []string{"BK_20240101_000000.zip", "BK_20240102_000000.zip", "BK_20240103_000000.zip"} {
+		writeFile(t, filepath.Join(backups, n), "zip")
+	}
+
+	if _, _, err := Backup(filepath.Join(t.TempDir(), "missing"), backups, ""); err == nil {
+		t.Fatal("backup of a missing folder succeeded")
+	}
+	if got := ListBackups(backups); len(got) != 3 {
+		t.Errorf("backups after failure = %v, want the 3 old archives", got)
+	}
+}
+
+func TestRestoreRejectsZipSlip(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "BK_evil.zip")
+	f, _ := os.Create(zipPath)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"../evil.dll", `..\evil.dll`, "ok.dll"} {
+		fw, _ := w.Create(name)
+		fw.Write([]byte("x"))
+	}
+	w.Close()
+	f.Close()
+
+	parent := t.TempDir()
+	target := filepath.Join(parent, "Bin")
+	restored, errs, err := Restore(zipPath, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0] != "ok.dll" || len(errs) != 2 {
+		t.Errorf("restored = %v, errs = %v", restored, errs)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.dll")); err == nil {
+		t.Error("archive entry escaped the target folder")
+	}
+}
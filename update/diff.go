@@ -0,0 +1,92 @@
+package update
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Reason explains why a file needs to be updated
+type Reason string
+
+const (
+	ReasonMissing Reason = "missing"
+	ReasonSize    Reason = "size"
+	ReasonHash    Reason = "hash"
+)
+
+// Change is a file whose local copy differs from the manifest
+type Change struct {
+	FileEntry
+	Reason Reason `json:"reason"`
+}
+
+// Diff compares the files in targetDir against the manifest. Files whose
+// size and modification time match the manifest are trusted without hashing,
+// everything else is hashed locally; the share is never read.
+func Diff(m *Manifest, targetDir string) []Change {
+	var changes []Change
+	for _, e := range m.Files {
+		local := filepath.Join(targetDir, filepath.FromSlash(e.Path))
+		info, err := os.Stat(local)
+		if err != nil {
+			changes = append(changes, Change{e, ReasonMissing})
+			continue
+		}
+		if info.Size() != e.Size {
+			changes = append(changes, Change{e, ReasonSize})
+			continue
+		}
+		if info.ModTime().UTC().Truncate(time.Second).Equal(e.ModTime) {
+			continue
+		}
+		sum, err := HashFile(local)
+		if err != nil || sum != e.SHA256 {
+			changes = append(changes, Change{e, ReasonHash})
+		}
+	}
+	return changes
+}
+
+// Installed records which release was last applied to a machine
+type Installed struct {
+	Version string    `json:"version"`
+	Updated time.Time `json:"updated"`
+}
+
+// ReadInstalled reads the installed state file. A missing file yields an
+// empty state so callers can show "unknown".
+func ReadInstalled(path string) Installed {
+	var st Installed
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &st)
+	}
+	return st
+}
+
+// WriteInstalled records the version that has just been applied
+func WriteInstalled(path, version string) error {
+	data, err := json.MarshalIndent(Installed{Version: version, Updated: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	return os.WriteFile(path, data, 0644)
+}
+
+// Check resolves the manifest of sourceDir and diffs targetDir against it.
+// The manifest must carry a valid signature for the key in keyFile; only an
+// empty keyFile skips verification.
+func Check(sourceDir, targetDir, keyFile string) (m *Manifest, changes []Change, published bool, err error) {
+	key, err := LoadKey(keyFile)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	m, published, err = ResolveManifest(sourceDir, key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return m, Diff(m, targetDir), published, nil
+}
@@ -0,0 +1,46 @@
+package update
+
+import "fmt"
+
+// Paths locates an IPCAS2 install and the files that track its updates
+type Paths struct {
+	// Source is the default update share, used until one is saved in ConfigFile
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	BackupDir  string `json:"backup_dir"`
+	ConfigFile string `json:"config_file"`
+	StateFile  string `json:"state_file"`
+	KeyFile    string `json:"key_file"`
+}
+
+// SourcePath returns the saved update source, falling back to p.Source
+func (p Paths) SourcePath() string {
+	return LoadSourcePath(p.ConfigFile, p.Source)
+}
+
+// Install stops ipcas2.exe, optionally backs up the current install, applies
+// the changes with opt and records the installed version on success. The
+// target defaults to p.Target. A failed backup installs nothing and returns
+// no result.
+func Install(m *Manifest, changes []Change, opt Options, p Paths, backup bool) (backupName string, res *Result, err error) {
+	if opt.TargetDir == "" {
+		opt.TargetDir = p.Target
+	}
+	if backup {
+		name, _, err := Backup(opt.TargetDir, p.BackupDir, ReadInstalled(p.StateFile).Version)
+		if err != nil {
+			return "", nil, fmt.Errorf("backup: %w", err)
+		}
+		backupName = name
+	}
+
+	StopIPCAS()
+	res, err = Apply(m, changes, opt)
+	if err != nil {
+		return backupName, res, err
+	}
+	if m.Version != "" {
+		WriteInstalled(p.StateFile, m.Version)
+	}
+	return backupName, res, nil
+}
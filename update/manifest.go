@@ -0,0 +1,242 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestName is the manifest file published next to the binaries on the share
+	ManifestName = "manifest.json"
+	// SignatureName holds the hex encoded ed25519 signature of ManifestName
+	SignatureName = "manifest.sig"
+)
+
+// ErrBadSignature is returned when the manifest signature does not verify
+var ErrBadSignature = errors.New("manifest signature is invalid")
+
+// ErrNoKey is returned when the configured public key file does not exist
+var ErrNoKey = errors.New("update public key not found")
+
+// FileEntry describes one file of a release
+type FileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Manifest describes a published IPCAS2 release
+type Manifest struct {
+	Version string      `json:"version"`
+	Created time.Time   `json:"created"`
+	Files   []FileEntry `json:"files"`
+}
+
+// HashFile returns the hex encoded SHA-256 of a file
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// publishedFiles sit next to the binaries on the share but are not part of
+// the install: the manifest, the branch catalog and their signatures. The
+// catalog is signed after the manifest is written and is fetched on its own.
+var publishedFiles = []string{ManifestName, SignatureName, "catalog.json", "catalog.sig"}
+
+// isManifestFile reports whether a relative path is one of publishedFiles
+func isManifestFile(rel string) bool {
+	for _, name := range publishedFiles {
+		if strings.EqualFold(rel, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildManifest hashes every file under dir and returns the resulting manifest
+func BuildManifest(dir, version string) (*Manifest, error) {
+	m := &Manifest{Version: version, Created: time.Now()}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if isManifestFile(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := HashFile(path)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, FileEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			SHA256:  sum,
+			ModTime: info.ModTime().UTC().Truncate(time.Second),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m, nil
+}
+
+// Marshal returns the canonical JSON encoding that is signed and published
+func (m *Manifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Publish writes the manifest, and its signature when key is set, into dir
+func (m *Manifest) Publish(dir string, key ed25519.PrivateKey) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestName), data, 0644); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	sig := hex.EncodeToString(ed25519.Sign(key, data))
+	return os.WriteFile(filepath.Join(dir, SignatureName), []byte(sig), 0644)
+}
+
+// ParseManifest decodes a manifest and rejects entries that would resolve
+// outside the install directory
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	for _, e := range m.Files {
+		if _, err := localPath(e.Path); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+	}
+	return &m, nil
+}
+
+// localPath converts a slash or backslash separated relative path from a
+// manifest or archive into an OS path. Absolute paths, drive letters and
+// paths that climb out of their root after cleaning are refused.
+func localPath(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" || clean == "." || path.IsAbs(clean) || strings.Contains(clean, ":") ||
+		!filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", fmt.Errorf("unsafe path %q", name)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+// LoadManifest reads the manifest published in dir. When key is not nil the
+// signature file must be present and valid.
+func LoadManifest(dir string, key ed25519.PublicKey) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		sig, err := os.ReadFile(filepath.Join(dir, SignatureName))
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+		raw, err := hex.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || !ed25519.Verify(key, data, raw) {
+			return nil, ErrBadSignature
+		}
+	}
+	return ParseManifest(data)
+}
+
+// ReadPublicKey reads a hex encoded ed25519 public key file
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key in %s", path)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// LoadKey reads the key manifests must be signed with. An empty keyFile
+// means verification was turned off on purpose and yields a nil key; a
+// configured key file that does not exist is an error, so removing it cannot
+// silently disable verification.
+func LoadKey(keyFile string) (ed25519.PublicKey, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+	key, err := ReadPublicKey(keyFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoKey, keyFile)
+	}
+	return key, err
+}
+
+// ReadPrivateKey reads a hex encoded ed25519 private key file
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	return ed25519.PrivateKey(raw), nil
+}
+
+// ResolveManifest loads the manifest published in dir. Shares that do not
+// publish one yet are hashed on the fly, unless a signing key is configured,
+// in which case an unsigned share is refused.
+func ResolveManifest(dir string, key ed25519.PublicKey) (m *Manifest, published bool, err error) {
+	m, err = LoadManifest(dir, key)
+	if err == nil {
+		return m, true, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || key != nil {
+		return nil, false, err
+	}
+	m, err = BuildManifest(dir, "")
+	return m, false, err
+}
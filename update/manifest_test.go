@@ -0,0 +1,226 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ipcas2-scanner/catalog"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// publishSigned builds and signs a manifest for dir and returns the public key file
+func publishSigned(t *testing.T, dir string) string {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := BuildManifest(dir, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Publish(dir, priv); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "update_key.pub")
+	writeFile(t, keyFile, hex.EncodeToString(pub))
+	return keyFile
+}
+
+func TestManifestSignVerify(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "ipcas2.exe"), "exe")
+	writeFile(t, filepath.Join(src, "sub", "a.dll"), "dll")
+	keyFile := publishSigned(t, src)
+
+	key, err := LoadKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(src, key)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if m.Version != "1.0" || len(m.Files) != 2 || m.Files[1].Path != "sub/a.dll" {
+		t.Errorf("manifest = %+v", m)
+	}
+
+	// Tampering with the manifest breaks the signature
+	data, _ := os.ReadFile(filepath.Join(src, ManifestName))
+	data[len(data)-2] = ' '
+	writeFile(t, filepath.Join(src, ManifestName), string(data))
+	if _, err := LoadManifest(src, key); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered manifest: err = %v, want ErrBadSignature", err)
+	}
+
+	// So does a missing signature
+	os.Remove(filepath.Join(src, SignatureName))
+	if _, err := LoadManifest(src, key); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("unsigned manifest: err = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestCheckRequiresKey(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "ipcas2.exe"), "exe")
+	m, _ := BuildManifest(src, "1.0")
+	m.Publish(src, nil)
+
+	missing := filepath.Join(t.TempDir(), "update_key.pub")
+	if _, _, _, err := Check(src, t.TempDir(), missing); !errors.Is(err, ErrNoKey) {
+		t.Errorf("missing key file: err = %v, want ErrNoKey", err)
+	}
+
+	// Only an empty key file skips verification
+	_, changes, published, err := Check(src, t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published || len(changes) != 1 || changes[0].Reason != ReasonMissing {
+		t.Errorf("published = %v, changes = %+v", published, changes)
+	}
+}
+
+func TestResolveManifestRefusesUnsignedShare(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "ipcas2.exe"), "exe")
+	pub, _, _ := ed25519.GenerateKey(nil)
+
+	if _, _, err := ResolveManifest(src, pub); err == nil {
+		t.Error("share without manifest accepted although a key is configured")
+	}
+	m, published, err := ResolveManifest(src, nil)
+	if err != nil || published || len(m.Files) != 1 {
+		t.Errorf("m = %+v, published = %v, err = %v", m, published, err)
+	}
+}
+
+func TestParseManifestRejectsUnsafePaths(t *testing.T) {
+	for _, p := range []string{
+		`../evil.dll`,
+		`..\evil.dll`,
+		`sub/../../evil.dll`,
+		`/etc/passwd`,
+		`\Windows\evil.dll`,
+		`C:\Windows\evil.dll`,
+		`C:evil.dll`,
+		``,
+		`.`,
+	} {
+		data := `{"version":"1","files":[{"path":` + jsonString(p) + `}]}`
+		if _, err := ParseManifest([]byte(data)); err == nil {
+			t.Errorf("path %q accepted", p)
+		}
+	}
+
+	m, err := ParseManifest([]byte(`{"files":[{"path":"sub/./a.dll"},{"path":"b.dll"}]}`))
+	if err != nil || len(m.Files) != 2 {
+		t.Errorf("local paths rejected: %v", err)
+	}
+}
+
+func jsonString(s string) string {
+	out := `"`
+	for _, r := range s {
+		if r == '\\' || r == '"' {
+			out += `\`
+		}
+		out += string(r)
+	}
+	return out + `"`
+}
+
+func TestDiff(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "same.dll"), "same")
+	writeFile(t, filepath.Join(src, "size.dll"), "longer")
+	writeFile(t, filepath.Join(src, "hash.dll"), "new!")
+	writeFile(t, filepath.Join(src, "missing.dll"), "x")
+	m, err := BuildManifest(src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dst, "same.dll"), "same")
+	writeFile(t, filepath.Join(dst, "size.dll"), "short")
+	writeFile(t, filepath.Join(dst, "hash.dll"), "old!")
+	// Same size, different time: hashed, and only hash.dll differs
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dst, "same.dll"), old, old)
+	os.Chtimes(filepath.Join(dst, "hash.dll"), old, old)
+
+	got := map[string]Reason{}
+	for _, c := range Diff(m, dst) {
+		got[c.Path] = c.Reason
+	}
+	want := map[string]Reason{"size.dll": ReasonSize, "hash.dll": ReasonHash, "missing.dll": ReasonMissing}
+	if len(got) != len(want) {
+		t.Fatalf("Diff = %v, want %v", got, want)
+	}
+	for p, r := range want {
+		if got[p] != r {
+			t.Errorf("%s: reason %q, want %q", p, got[p], r)
+		}
+	}
+}
+
+// TestPublishWithChangedCatalog publishes like ipcas2-manifest does: the
+// manifest first, then the catalog signature next to it
+func TestPublishWithChangedCatalog(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	writeFile(t, filepath.Join(src, "a.dll"), "new a")
+	writeFile(t, filepath.Join(dst, "a.dll"), "previous a")
+
+	c := catalog.Default()
+	c.Branches[0].Printer = "HP LaserJet Tầng 2"
+	data, _ := json.Marshal(c)
+	writeFile(t, filepath.Join(src, catalog.FileName), string(data))
+	// Signature of the catalog of the previous release
+	writeFile(t, filepath.Join(src, catalog.SignatureName), "00")
+
+	m, err := BuildManifest(src, "2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Publish(src, priv); err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Sign(src, priv); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "update_key.pub")
+	writeFile(t, keyFile, hex.EncodeToString(pub))
+
+	m, changes, published, err := Check(src, dst, keyFile)
+	if err != nil || !published {
+		t.Fatalf("Check: published = %v, err = %v", published, err)
+	}
+	if len(m.Files) != 1 || len(changes) != 1 || changes[0].Path != "a.dll" {
+		t.Fatalf("manifest = %+v, changes = %+v", m.Files, changes)
+	}
+	res, err := Apply(m, changes, Options{SourceDir: src, TargetDir: dst, StagingDir: filepath.Join(t.TempDir(), "Staging")})
+	if err != nil || !res.OK() {
+		t.Fatalf("res = %+v, err = %v", res, err)
+	}
+	for _, name := range []string{catalog.FileName, catalog.SignatureName} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("%s copied into the install", name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package update
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StopIPCAS kills any running ipcas2.exe so its files can be replaced
+func StopIPCAS() {
+	exec.Command("taskkill", "/F", "/IM", "ipcas2.exe").Run()
+	time.Sleep(500 * time.Millisecond)
+}
+
+// StartIPCAS launches ipcas2.exe from dir and reports whether it was found
+func StartIPCAS(dir string) bool {
+	exe := filepath.Join(dir, "ipcas2.exe")
+	if _, err := os.Stat(exe); err != nil {
+		return false
+	}
+	return exec.Command("cmd", "/C", "start", "", exe).Start() == nil
+}
+
+// LoadSourcePath returns the update source saved in configFile, or def
+func LoadSourcePath(configFile, def string) string {
+	if data, err := os.ReadFile(configFile); err == nil {
+		if p := strings.TrimSpace(string(data)); p != "" {
+			return p
+		}
+	}
+	return def
+}
+
+// SaveSourcePath stores the update source in configFile
+func SaveSourcePath(configFile, path string) error {
+	os.MkdirAll(filepath.Dir(configFile), 0755)
+	return os.WriteFile(configFile, []byte(path), 0644)
+}
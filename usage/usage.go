@@ -0,0 +1,224 @@
+// Package usage tells where the disk space of a folder goes: by subfolder,
+// by extension, by age and the largest files. It walks with the same
+// walker as the cleaner, so it can be run before a cleanup.
+package usage
+
+import (
+	"container/heap"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ipcas2-scanner/walk"
+)
+
+// Roots are the folders analyzed by default: the Picture share, the
+// IPCAS2 folder with TUXLOG, CACHE and Backup, and the VirtualStore where
+// Windows redirects writes of old programs
+func Roots() []string {
+	local := os.Getenv("LOCALAPPDATA")
+	if local == "" {
+		local = filepath.Join(os.Getenv("USERPROFILE"), `AppData\Local`)
+	}
+	return []string{`U:\`, `C:\IPCAS2`, filepath.Join(local, "VirtualStore")}
+}
+
+// RootFiles is the Folders name of the files directly in the root
+const RootFiles = "."
+
+// Group totals the files of a subfolder, an extension or an age
+type Group struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+func (g *Group) add(size int64) {
+	g.Files++
+	g.Bytes += size
+}
+
+// AgeBucket is a range of file ages
+type AgeBucket struct {
+	Name string
+	Max  time.Duration // 0 for the last bucket
+}
+
+// AgeBuckets are the age ranges of an analysis, by modification time
+var AgeBuckets = []AgeBucket{
+	{"Dưới 1 ngày", 24 * time.Hour},
+	{"1-7 ngày", 7 * 24 * time.Hour},
+	{"7-30 ngày", 30 * 24 * time.Hour},
+	{"1-12 tháng", 365 * 24 * time.Hour},
+	{"Trên 1 năm", 0},
+}
+
+// File is one of the largest files
+type File struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Analysis is the space used under Root
+type Analysis struct {
+	Root     string        `json:"root"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Dirs     int64         `json:"dirs"`
+	Errors   int64         `json:"errors"`
+	// Stopped is set when the analysis was cancelled; the totals then
+	// cover only the files seen so far
+	Stopped bool   `json:"stopped,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Folders, Extensions and Largest are sorted by size, largest first
+	Folders    []Group `json:"folders"`
+	Extensions []Group `json:"extensions"`
+	Ages       []Group `json:"ages"`
+	Largest    []File  `json:"largest"`
+}
+
+// DefaultTop is the number of largest files kept by default
+const DefaultTop = 20
+
+// Analyze walks fsys and totals its files as of now, keeping the top
+// largest ones. root is the OS path fsys was opened on.
+func Analyze(ctx context.Context, fsys fs.FS, root string, now time.Time, top int) *Analysis {
+	if top <= 0 {
+		top = DefaultTop
+	}
+	a := &Analysis{Root: root, Time: now}
+	var (
+		mu      sync.Mutex
+		folders = make(map[string]*Group)
+		exts    = make(map[string]*Group)
+		ages    = make([]Group, len(AgeBuckets))
+		largest = &fileHeap{}
+	)
+	for i, b := range AgeBuckets {
+		ages[i].Name = b.Name
+	}
+
+	st, err := walk.Walk(ctx, fsys, 0, func(f walk.File) {
+		size := f.Info.Size()
+		folder := RootFiles
+		if i := strings.IndexByte(f.Rel, '/'); i >= 0 {
+			folder = f.Rel[:i]
+		}
+		ext := strings.ToLower(path.Ext(f.Rel))
+		age := ageBucket(now.Sub(f.Info.ModTime()))
+
+		mu.Lock()
+		defer mu.Unlock()
+		a.Files++
+		a.Bytes += size
+		group(folders, folder).add(size)
+		group(exts, ext).add(size)
+		ages[age].add(size)
+		if largest.Len() < top || size > (*largest)[0].Size {
+			heap.Push(largest, File{
+				Path:    filepath.Join(root, filepath.FromSlash(f.Rel)),
+				Size:    size,
+				ModTime: f.Info.ModTime(),
+			})
+			if largest.Len() > top {
+				heap.Pop(largest)
+			}
+		}
+	})
+	a.Dirs, a.Errors = st.Dirs, st.Errors
+	if err != nil {
+		a.Stopped = true
+	}
+
+	a.Folders = sortGroups(folders)
+	a.Extensions = sortGroups(exts)
+	a.Ages = ages
+	a.Largest = append([]File(nil), *largest...)
+	sort.Slice(a.Largest, func(i, j int) bool { return a.Largest[i].Size > a.Largest[j].Size })
+	a.Duration = time.Since(now)
+	return a
+}
+
+// AnalyzeDir analyzes the folder root. An unreachable root is reported in
+// Error.
+func AnalyzeDir(ctx context.Context, root string, top int) *Analysis {
+	if _, err := os.Stat(root); err != nil {
+		return &Analysis{Root: root, Time: time.Now(), Error: err.Error()}
+	}
+	return Analyze(ctx, os.DirFS(root), root, time.Now(), top)
+}
+
+// AnalyzeAll analyzes the roots at the same time and returns the analyses
+// in the order of roots. done, when set, is called as each one finishes.
+func AnalyzeAll(ctx context.Context, roots []string, top int, done func(*Analysis)) []*Analysis {
+	out := make([]*Analysis, len(roots))
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+			out[i] = AnalyzeDir(ctx, root, top)
+			if done != nil {
+				done(out[i])
+			}
+		}(i, root)
+	}
+	wg.Wait()
+	return out
+}
+
+func ageBucket(age time.Duration) int {
+	for i, b := range AgeBuckets {
+		if b.Max == 0 || age < b.Max {
+			return i
+		}
+	}
+	return len(AgeBuckets) - 1
+}
+
+func group(m map[string]*Group, name string) *Group {
+	g, ok := m[name]
+	if !ok {
+		g = &Group{Name: name}
+		m[name] = g
+	}
+	return g
+}
+
+func sortGroups(m map[string]*Group) []Group {
+	groups := make([]Group, 0, len(m))
+	for _, g := range m {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Bytes != groups[j].Bytes {
+			return groups[i].Bytes > groups[j].Bytes
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// fileHeap is a min-heap by size, so the smallest of the largest files is
+// dropped first
+type fileHeap []File
+
+func (h fileHeap) Len() int            { return len(h) }
+func (h fileHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) { *h = append(*h, x.(File)) }
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
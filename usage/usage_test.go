@@ -0,0 +1,98 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2024, 10, 14, 9, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+	file := func(size int, age time.Duration) *fstest.MapFile {
+		return &fstest.MapFile{Data: make([]byte, size), ModTime: now.Add(-age)}
+	}
+	fsys := fstest.MapFS{
+		"root.ini":          file(10, time.Hour),
+		"TUXLOG/ULOG.1014":  file(300, 2*time.Hour),
+		"TUXLOG/ULOG.1001":  file(200, 13*day),
+		"Backup/a/bin.zip":  file(1000, 40*day),
+		"Backup/old.ZIP":    file(500, 400*day),
+		"CACHE/img.jpg":     file(50, 3*day),
+		"CACHE/sub/img.JPG": file(5, 3*day),
+	}
+	a := Analyze(context.Background(), fsys, `C:\IPCAS2`, now, 3)
+
+	if a.Files != 7 || a.Bytes != 2065 || a.Errors != 0 || a.Stopped {
+		t.Errorf("totals: %d files, %d bytes, %d errors, stopped %v", a.Files, a.Bytes, a.Errors, a.Stopped)
+	}
+	wantFolders := []Group{
+		{"Backup", 2, 1500},
+		{"TUXLOG", 2, 500},
+		{"CACHE", 2, 55},
+		{RootFiles, 1, 10},
+	}
+	if !reflect.DeepEqual(a.Folders, wantFolders) {
+		t.Errorf("folders = %+v", a.Folders)
+	}
+	wantExts := []Group{
+		{".zip", 2, 1500},
+		{".1014", 1, 300},
+		{".1001", 1, 200},
+		{".jpg", 2, 55},
+		{".ini", 1, 10},
+	}
+	if !reflect.DeepEqual(a.Extensions, wantExts) {
+		t.Errorf("extensions = %+v", a.Extensions)
+	}
+	wantAges := []Group{
+		{AgeBuckets[0].Name, 2, 310},
+		{AgeBuckets[1].Name, 2, 55},
+		{AgeBuckets[2].Name, 1, 200},
+		{AgeBuckets[3].Name, 1, 1000},
+		{AgeBuckets[4].Name, 1, 500},
+	}
+	if !reflect.DeepEqual(a.Ages, wantAges) {
+		t.Errorf("ages = %+v", a.Ages)
+	}
+
+	var largest []string
+	for _, f := range a.Largest {
+		largest = append(largest, f.Path)
+	}
+	wantLargest := []string{
+		filepath.Join(`C:\IPCAS2`, filepath.FromSlash("Backup/a/bin.zip")),
+		filepath.Join(`C:\IPCAS2`, filepath.FromSlash("Backup/old.ZIP")),
+		filepath.Join(`C:\IPCAS2`, filepath.FromSlash("TUXLOG/ULOG.1014")),
+	}
+	if !reflect.DeepEqual(largest, wantLargest) {
+		t.Errorf("largest = %v", largest)
+	}
+}
+
+func TestAnalyzeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := Analyze(ctx, fstest.MapFS{"a.txt": {Data: []byte("a")}, "b/c.txt": {}}, "root", time.Now(), 0)
+	if !a.Stopped {
+		t.Error("cancelled analysis not marked stopped")
+	}
+	if a.Files != 0 {
+		t.Errorf("cancelled analysis counted %d files", a.Files)
+	}
+}
+
+func TestAnalyzeAllUnreachable(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	out := AnalyzeAll(context.Background(), []string{dir, missing}, 0, nil)
+	if len(out) != 2 || out[0].Root != dir || out[0].Error != "" {
+		t.Fatalf("analyses = %+v", out)
+	}
+	if out[1].Root != missing || out[1].Error == "" {
+		t.Errorf("unreachable root not reported: %+v", out[1])
+	}
+}
@@ -0,0 +1,91 @@
+// Package walk lists the files of a folder tree with several goroutines,
+// so that slow network shares are read in parallel. The cleaner and the
+// usage analysis both walk through it.
+package walk
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// File is a regular file found by Walk
+type File struct {
+	Rel  string // slash separated, below the root
+	Info fs.FileInfo
+}
+
+// Func is called for every file. Calls come from several goroutines at
+// once.
+type Func func(f File)
+
+// Stats counts what a walk went through
+type Stats struct {
+	Dirs   int64 `json:"dirs"`
+	Files  int64 `json:"files"`
+	Errors int64 `json:"errors"` // unreadable folders and files, skipped
+}
+
+// DefaultWorkers is the number of folders read at once when Walk is given
+// no worker count
+var DefaultWorkers = 2 * runtime.NumCPU()
+
+// Walk calls fn for every file of fsys, reading up to workers folders at
+// once. It stops early when ctx is cancelled and then returns ctx.Err().
+func Walk(ctx context.Context, fsys fs.FS, workers int, fn Func) (Stats, error) {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	var (
+		st  Stats
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, workers)
+	)
+
+	var visit func(dir string)
+	visit = func(dir string) {
+		defer wg.Done()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-sem }()
+
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			atomic.AddInt64(&st.Errors, 1)
+			// ReadDir may still return the entries read before the error
+		}
+		atomic.AddInt64(&st.Dirs, 1)
+		for _, d := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			rel := path.Join(dir, d.Name())
+			if d.IsDir() {
+				wg.Add(1)
+				go visit(rel)
+				continue
+			}
+			if !d.Type().IsRegular() {
+				continue
+			}
+			info, err := d.Info()
+			if err != nil {
+				atomic.AddInt64(&st.Errors, 1)
+				continue
+			}
+			atomic.AddInt64(&st.Files, 1)
+			fn(File{Rel: rel, Info: info})
+		}
+	}
+
+	wg.Add(1)
+	visit(".")
+	wg.Wait()
+	return st, ctx.Err()
+}
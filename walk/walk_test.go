@@ -0,0 +1,91 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// brokenFS fails to list the folder bad
+type brokenFS struct {
+	fstest.MapFS
+	bad string
+}
+
+func (f brokenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.bad {
+		return nil, errors.New("access denied")
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestWalk(t *testing.T) {
+	fsys := brokenFS{MapFS: fstest.MapFS{
+		"a.txt":        {Data: []byte("a")},
+		"x/b.txt":      {Data: []byte("bb")},
+		"x/y/c.txt":    {Data: []byte("ccc")},
+		"x/y/z/d.txt":  {},
+		"locked/e.txt": {},
+		"empty":        {Mode: fs.ModeDir},
+		"link":         {Mode: fs.ModeSymlink},
+	}, bad: "locked"}
+
+	var (
+		mu   sync.Mutex
+		rels []string
+	)
+	st, err := Walk(context.Background(), fsys, 2, func(f File) {
+		mu.Lock()
+		rels = append(rels, f.Rel)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(rels)
+	want := []string{"a.txt", "x/b.txt", "x/y/c.txt", "x/y/z/d.txt"}
+	if len(rels) != len(want) {
+		t.Fatalf("walked %v, want %v", rels, want)
+	}
+	for i := range want {
+		if rels[i] != want[i] {
+			t.Fatalf("walked %v, want %v", rels, want)
+		}
+	}
+	// ., x, x/y, x/y/z, empty and the unreadable locked
+	if st != (Stats{Dirs: 6, Files: 4, Errors: 1}) {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestWalkCancelled(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, d := range []string{"a", "b", "c", "d"} {
+		for _, f := range []string{"1", "2", "3"} {
+			fsys[d+"/"+f+".txt"] = &fstest.MapFile{}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	_, err := Walk(ctx, fsys, 1, func(File) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if calls >= len(fsys) {
+		t.Errorf("walk went on after cancel: %d calls", calls)
+	}
+}